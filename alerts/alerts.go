@@ -0,0 +1,769 @@
+package alerts
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dghubble/go-twitter/twitter"
+	"github.com/dghubble/oauth1"
+)
+
+// ZipToLatLong defines the json structure of the input data.
+// The data comes from: https://public.opendatasoft.com/explore/dataset/us-zip-code-latitude-and-longitude/export/?refine.state=CA
+// It is "Flat file JSON".
+// Most fields are currently irrelevant, but was simple enough to just
+// define the exact structure of the data.
+type ZipToLatLong struct {
+	DatasetID string `json:"datasetid"`
+	RecordID string `json:"recordid"`
+	Fields struct {
+		City string `json:"city"`
+		Zip string `json:"zip"`
+		DST int `json:"dst"`
+		Geopoint [2]float64 `json:"geopoint"`
+		Latitude float64 `json:"latitude"`
+		Longitude float64 `json:"longitude"`
+		State string `json:"state"`
+		Timezone int `json:"timezone"`
+	} `json:"fields"`
+	Geometry struct{
+		Type string `json:"type"`
+		Coordinates [2]float64 `json:"coordinates"`
+	} `json:"geometry"`
+	RecordTimestamp string `json:"record_timestamp"`
+
+	// county is the county the zip is in, when a county file is loaded. It
+	// isn't part of the data file.
+	county string
+}
+
+// bundledData is the California extract in assets, built into the binary so
+// it runs without the repo around it.
+//go:embed assets/ca-zip-code-latitude-and-longitude.json
+var bundledData []byte
+
+// parseJSONData reads every record in the data file at path, which is in
+// the given format, and may be gzipped; an empty path reads the bundled
+// data. See dataFormat. A data file shaped
+// differently from the bundled one is decoded through fields; nil decodes
+// the bundled shape. JSON records are decoded across workers goroutines.
+// Records that don't decode or aren't valid, see validRecord, are skipped
+// with a warning rather than failing the whole file, and counted in
+// skipped.
+func parseJSONData(log *logger, path, format string, fields fieldMap, workers int) ([]*ZipToLatLong, int, error) {
+	var br, f, err = openData(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	format, err = dataFormat(format, br)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var decode = decodeRecord
+	if fields != nil {
+		decode = fields.decode
+	}
+	var out []*ZipToLatLong
+	var skipped int
+	if format == FormatNDJSON {
+		skipped, err = decodeNDJSON(log, br, decode, func(z *ZipToLatLong) error {
+			out = append(out, z)
+			return nil
+		})
+	} else {
+		// Records are decoded one by one, so a bad one only costs
+		// itself, which also lets them be spread over the workers.
+		var raw []json.RawMessage
+		raw, err = readJSONArray(br)
+		if err == nil {
+			out, skipped = decodeRecords(log, raw, workers, decode)
+		}
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var records, dupes = dedupRecords(out)
+	if dupes > 0 {
+		log.info("removed", dupes, "duplicate records from data")
+	}
+
+	return records, skipped, nil
+}
+
+// readJSONArray reads the elements of the JSON array in r one at a time,
+// without decoding them.
+func readJSONArray(r io.Reader) ([]json.RawMessage, error) {
+	var d = json.NewDecoder(r)
+	var t, err = d.Token()
+	if err != nil {
+		return nil, err
+	}
+	if t != json.Delim('[') {
+		return nil, errors.New("data is not a JSON array")
+	}
+
+	var raw []json.RawMessage
+	for d.More() {
+		var m json.RawMessage
+		err = d.Decode(&m)
+		if err != nil {
+			return nil, err
+		}
+		raw = append(raw, m)
+	}
+
+	_, err = d.Token()
+	if err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// streamJSONData decodes the records in the data file at path one at a time,
+// sending each to out as soon as it's parsed rather than holding the whole
+// file in memory. Duplicates and records that aren't valid are dropped as
+// with parseJSONData. out is closed once the file has been read, on the
+// first error, or when ctx is done.
+func streamJSONData(ctx context.Context, log *logger, path, format string, fields fieldMap, out chan<- *ZipToLatLong) error {
+	defer close(out)
+
+	var br, f, err = openData(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	format, err = dataFormat(format, br)
+	if err != nil {
+		return err
+	}
+
+	var decode = decodeRecord
+	if fields != nil {
+		decode = fields.decode
+	}
+	var seen = newRecordSet()
+	var emit = func(z *ZipToLatLong) error {
+		if !seen.add(z) {
+			return nil
+		}
+		select {
+		case out <- z:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if format == FormatNDJSON {
+		_, err = decodeNDJSON(log, br, decode, emit)
+		return err
+	}
+
+	var d = json.NewDecoder(br)
+	var t json.Token
+	t, err = d.Token()
+	if err != nil {
+		return err
+	}
+	if t != json.Delim('[') {
+		return errors.New("data is not a JSON array")
+	}
+
+	for n := 1; d.More(); n++ {
+		var raw json.RawMessage
+		err = d.Decode(&raw)
+		if err != nil {
+			return err
+		}
+		var z *ZipToLatLong
+		z, err = decodeValid(decode, raw)
+		if err != nil {
+			log.warn("skipping record", strconv.Itoa(n)+":", err)
+			continue
+		}
+		err = emit(z)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = d.Token()
+	return err
+}
+
+// newestRecord returns the most recent RecordTimestamp in data, ignoring
+// ones that don't parse.
+func newestRecord(data []*ZipToLatLong) time.Time {
+	var newest time.Time
+	for _, d := range data {
+		var t, err = time.Parse(time.RFC3339, d.RecordTimestamp)
+		if err == nil && t.After(newest) {
+			newest = t
+		}
+	}
+	return newest
+}
+
+// dedupRecords drops records that share a zip or exact coordinates with an
+// earlier record, since searching them again would return the same results.
+// It returns the remaining records and how many were dropped.
+func dedupRecords(data []*ZipToLatLong) ([]*ZipToLatLong, int) {
+	var seen = newRecordSet()
+	var out = make([]*ZipToLatLong, 0, len(data))
+
+	for _, d := range data {
+		if seen.add(d) {
+			out = append(out, d)
+		}
+	}
+
+	return out, len(data) - len(out)
+}
+
+// recordSet tracks the zips and coordinates of the records seen so far.
+type recordSet struct {
+	zips map[string]bool
+	points map[Location]bool
+}
+
+func newRecordSet() *recordSet {
+	return &recordSet{
+		zips: make(map[string]bool),
+		points: make(map[Location]bool),
+	}
+}
+
+// add adds d to the set, reporting false if it shares a zip or exact
+// coordinates with a record already in it.
+func (s *recordSet) add(d *ZipToLatLong) bool {
+	var p = Location{Lat: d.Fields.Latitude, Long: d.Fields.Longitude}
+	if s.zips[d.Fields.Zip] || s.points[p] {
+		return false
+	}
+	s.zips[d.Fields.Zip] = true
+	s.points[p] = true
+	return true
+}
+
+// PostData is the json data included in the POST request to the API.
+type PostData struct {
+	// From date is a date of the form YYYY-MM-DD.
+	FromDate string `json:"fromDate"`
+	// Location is the Lat/Long of the search location.
+	Location *Location `json:"location"`
+	// VaccineData appears to tbe a Basr64 encoded string containing some
+	// enum or other constant values collected during the web UI's survey
+	// for eligibility.
+	VaccineData string `json:"vaccineData"`
+}
+
+// Location is the Lat/Long passed in the POST request.
+type Location struct{
+	Lat float64 `json:"lat"`
+	Long float64 `json:"lng"`
+}
+
+// parseCoordinates parses a "lat,long" pair, e.g. "37.7749,-122.4194".
+func parseCoordinates(s string) (*Location, error) {
+	var parts = strings.Split(s, ",")
+	if len(parts) != 2 {
+		return nil, errors.New("coordinates must be of the form lat,long")
+	}
+
+	var lat, err = strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return nil, errors.New("invalid latitude: " + parts[0])
+	}
+
+	var long float64
+	long, err = strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return nil, errors.New("invalid longitude: " + parts[1])
+	}
+
+	if lat < -90 || lat > 90 {
+		return nil, errors.New("latitude out of range: " + parts[0])
+	}
+	if long < -180 || long > 180 {
+		return nil, errors.New("longitude out of range: " + parts[1])
+	}
+
+	return &Location{Lat: lat, Long: long}, nil
+}
+
+// searchDates returns the dates searched from: cfg.FromDate, or else
+// cfg.FromDateOffset days after today, and the days after it up to
+// cfg.DaysAhead in all.
+func searchDates(cfg *Config) []string {
+	var from = cfg.Now().AddDate(0, 0, cfg.FromDateOffset)
+	if cfg.FromDate != "" {
+		// LoadConfig has checked it parses.
+		from, _ = time.Parse(DateFormat, cfg.FromDate)
+	}
+	var dates = []string{from.Format(DateFormat)}
+	for i := 1; i < cfg.DaysAhead; i++ {
+		dates = append(dates, from.AddDate(0, 0, i).Format(DateFormat))
+	}
+	return dates
+}
+
+// newPostData builds the search request for the given point and profile.
+func newPostData(cfg *Config, loc *Location, p *Profile) *PostData {
+	if cfg.CoordinatePrecision >= 0 {
+		loc = &Location{
+			Lat: roundTo(loc.Lat, cfg.CoordinatePrecision),
+			Long: roundTo(loc.Long, cfg.CoordinatePrecision),
+		}
+	}
+
+	return &PostData{
+		FromDate: searchDates(cfg)[0],
+		Location: loc,
+		VaccineData: p.VaccineData,
+	}
+}
+
+type Response struct {
+	Eligible bool `json:"eligible"`
+	VaccineData string `json:"vaccineData"`
+	// Don't know what this looks like as we haven't gotten one back yet!
+	Locations []*VaccineLocation `json:"locations"`
+
+	// raw is the response body as received, kept for debugging.
+	raw []byte
+	// url is the API endpoint that answered.
+	url string
+}
+
+type SiteName string
+
+type VaccineLocation struct{
+	DisplayAddress string `json:"displayAddress"`
+	DistanceInMeters float64 `json:"distanceInMeters"`
+	ExtID string `json:"extId"`
+	Location *Location `json:"location"`
+	Name SiteName `json:"name"`
+	OpenHours []Hours `json:"openHours"`
+	Type string `json:"type"`
+	VaccineData string `json:"vaccineData"`
+	// Profiles aren't part of the API response, but are filled in with
+	// the name of every eligibility profile the site was found for.
+	Profiles []string `json:"profiles,omitempty"`
+	// Zone isn't part of the API response either, but is filled in with
+	// the timezone of the zip the site was found near.
+	Zone *SiteZone `json:"zone,omitempty"`
+	// OriginZip isn't part of the API response either, but is filled in
+	// with the zip whose search first found the site, to trace an
+	// announcement back to its search.
+	OriginZip string `json:"originZip,omitempty"`
+	// NewToday isn't part of the API response either, but is set with
+	// -mark-new if the site was first found today.
+	NewToday bool `json:"newToday,omitempty"`
+	// NearCity isn't part of the API response either, but is set with
+	// -nearest-city to the major city nearest the site.
+	NearCity string `json:"nearCity,omitempty"`
+	// AvailableFrom isn't part of the API response either, but is set with
+	// -days-ahead to the earliest date searched from that found the site.
+	AvailableFrom string `json:"availableFrom,omitempty"`
+	// DistanceUnknown isn't part of the API response either, but is set
+	// when the API left DistanceInMeters out and the site has no
+	// coordinates to work it out from, so its zero isn't taken as near.
+	DistanceUnknown bool `json:"distanceUnknown,omitempty"`
+
+	// hoursChanged is set when a site that was already announced is being
+	// announced again because its hours changed.
+	hoursChanged bool
+	// county is the county the site is in, if a county file is loaded and
+	// has it.
+	county string
+}
+
+func (v *VaccineLocation) String() string {
+	var open = v.displayHours()
+	var hours = make([]string, len(open))
+	for i, h := range open {
+		hours[i] = h.String()
+	}
+	return string(v.Name) + "\n" +
+		normalizeAddress(v.DisplayAddress) + "\n" +
+		strings.Join(hours, "\n")
+}
+
+// addProfile tags v as found for the named eligibility profile.
+func (v *VaccineLocation) addProfile(name string) {
+	for _, p := range v.Profiles {
+		if p == name {
+			return
+		}
+	}
+	v.Profiles = append(v.Profiles, name)
+}
+
+// normalizeAddress tidies an address up for display on a single line:
+// whitespace is collapsed, and line breaks become commas, without leaving
+// empty or doubled up parts behind.
+func normalizeAddress(s string) string {
+	var parts []string
+	for _, line := range strings.Split(s, "\n") {
+		for _, p := range strings.Split(line, ",") {
+			p = strings.Join(strings.Fields(p), " ")
+			if p != "" {
+				parts = append(parts, p)
+			}
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+type Hours struct {
+	Days []string `json:"days"`
+	LocalStart string `json:"localStart"`
+	LocalEnd string `json:"localEnd"`
+}
+
+// duration returns how long the site is open on each of h's days. Hours
+// ending at or before they start run past midnight.
+func (h *Hours) duration() time.Duration {
+	var start, err = time.Parse("15:04:05", h.LocalStart)
+	if err != nil {
+		return 0
+	}
+	var end time.Time
+	end, err = time.Parse("15:04:05", h.LocalEnd)
+	if err != nil {
+		return 0
+	}
+
+	var d = end.Sub(start)
+	if d <= 0 {
+		d += 24 * time.Hour
+	}
+	return d
+}
+
+// weeklyHours sums how long v is open over a week.
+func (v *VaccineLocation) weeklyHours() time.Duration {
+	var total time.Duration
+	for _, h := range v.OpenHours {
+		for _, d := range h.Days {
+			if d != "" {
+				total += h.duration()
+			}
+		}
+	}
+	return total
+}
+
+func (h *Hours) String() string {
+	return h.format(0)
+}
+
+// format renders h with its times rounded to every round minutes, the start
+// down and the end up so the hours shown are never narrower than the real
+// ones. Zero leaves the times exact. Hours listing no days show only the
+// times.
+func (h *Hours) format(round int) string {
+	var days = make([]string, 0, len(h.Days))
+	for _, d := range h.Days {
+		if d == "" {
+			continue
+		}
+		days = append(days, strings.ToUpper(d[:1]) + d[1:])
+	}
+	var start, startErr = time.Parse("15:04:05", h.LocalStart)
+	var end, endErr = time.Parse("15:04:05", h.LocalEnd)
+	if round > 0 {
+		start = roundClock(start, round, false)
+		end = roundClock(end, round, true)
+	}
+	var span = clockString(start, startErr, h.LocalStart) + "-" + clockString(end, endErr, h.LocalEnd)
+	if len(days) == 0 {
+		return span
+	}
+	return strings.Join(days, ",") + " - " + span
+}
+
+const (
+	DateFormat = "2006-01-02"
+	URL = "https://api.myturn.ca.gov/public/locations/search"
+	// VaccineData was generated when I filled out the form as if I was 70+.
+	// It base64 decodes to:
+	// ["a3qt00000001AdLAAU","a3qt00000001AdMAAU","a3qt00000001AgUAAU","a3qt00000001AgVAAU"]
+	// It's the encoding of the "70+" eligibility profile.
+	VaccineData = "WyJhM3F0MDAwMDAwMDFBZExBQVUiLCJhM3F0MDAwMDAwMDFBZE1BQVUiLCJhM3F0MDAwMDAwMDFBZ1VBQVUiLCJhM3F0MDAwMDAwMDFBZ1ZBQVUiXQ=="
+	JSONMimeType = "application/json"
+
+	EnvAPIKey = "API_KEY"
+	EnvAPISecret = "API_SECRET"
+	EnvAccessToken = "ACCESS_TOKEN"
+	EnvAccessSecret = "ACCESS_SECRET"
+)
+
+// twitterClient returns a client for the account configured in the
+// environment, sending its requests through transport.
+func twitterClient(transport http.RoundTripper) (*twitter.Client, error) {
+	var apiKey, apiSecret, accessToken, accessSecret string
+	var ok bool
+
+	apiKey, ok = os.LookupEnv(EnvAPIKey)
+	if !ok {
+		return nil, errors.New("missing env variable " + EnvAPIKey)
+	}
+
+	apiSecret, ok = os.LookupEnv(EnvAPISecret)
+	if !ok {
+		return nil, errors.New("missing env variable " + EnvAPISecret)
+	}
+
+	accessToken, ok = os.LookupEnv(EnvAccessToken)
+	if !ok {
+		return nil, errors.New("missing env variable " + EnvAccessToken)
+	}
+
+	accessSecret, ok = os.LookupEnv(EnvAccessSecret)
+	if !ok {
+		return nil, errors.New("missing env variable " + EnvAccessSecret)
+	}
+
+	var cfg = oauth1.NewConfig(apiKey, apiSecret)
+	var token = oauth1.NewToken(accessToken, accessSecret)
+	var ctx = context.WithValue(oauth1.NoContext, oauth1.HTTPClient, &http.Client{Transport: transport})
+	var c = cfg.Client(ctx, token)
+
+	return twitter.NewClient(c), nil
+}
+
+// SignalContext returns a context derived from parent that the first
+// SIGINT or SIGTERM cancels. Given to Run, that stops the scan under way
+// early, as its deadline would, so the sites found so far are still
+// notified and saved, but for tweets that would have to wait for their
+// turn. A second signal kills the process as usual.
+func SignalContext(parent context.Context) context.Context {
+	var ctx, shutdown = context.WithCancel(parent)
+	var signals = make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case s := <-signals:
+			processLog.warn("received", s.String()+", stopping once the sites found so far are notified")
+		case <-ctx.Done():
+		}
+		signal.Stop(signals)
+		shutdown()
+	}()
+	return ctx
+}
+
+// Run carries out the run cfg describes, as the command does, until it's
+// done or ctx is: a search at cfg.Coordinates, a single scan, or, in
+// daemon mode, a scan every cfg.Interval until ctx is cancelled. It
+// returns the summary of the last scan, which is empty if there wasn't
+// one. Notifiers are configured from cfg and the environment.
+//
+// cfg should come from LoadConfig or DefaultConfig, since a Config's zero
+// value isn't its defaults; e.g. zero Workers search nothing. Its
+// unexported parts are set up from the rest, and Now defaults to time.Now.
+func Run(ctx context.Context, cfg Config) (Summary, error) {
+	var err = cfg.decodeProfiles()
+	if err != nil {
+		return Summary{}, err
+	}
+	cfg.derive()
+	var summary *Summary
+	summary, err = run(ctx, &cfg, deps{stdin: os.Stdin, stdout: os.Stdout})
+	if summary == nil {
+		return Summary{}, err
+	}
+	return *summary, err
+}
+
+// deps are what a run talks to besides the API and the data file, which
+// cfg points at. Tests can swap them out.
+type deps struct {
+	// notifiers, if set, are sent through instead of the ones configured
+	// in cfg and the environment.
+	notifiers []Notifier
+	// stdin is where -stdin reads coordinates from.
+	stdin io.Reader
+	// stdout is where a search at -coordinates prints the sites found.
+	stdout io.Writer
+}
+
+// run carries out Run with d, returning the last scan's summary, if any.
+// Cancelling ctx stops the scan under way early, as its deadline would.
+func run(ctx context.Context, cfg *Config, d deps) (*Summary, error) {
+	cfg.ctx = ctx
+	if cfg.log == nil {
+		cfg.log = newLogger(cfg)
+	}
+	if cfg.LogSyslog {
+		var err error
+		cfg.log.sink, err = syslogSink(cfg.SyslogFacility, cfg.SyslogTag)
+		if err != nil {
+			cfg.log.warn("logging to stderr, as syslog can't be used:", err)
+		}
+	}
+	if cfg.InsecureSkipVerify {
+		cfg.log.warn("the API's TLS certificate is not being verified, -insecure-skip-verify is only for testing")
+	}
+
+	for _, p := range cfg.Profiles {
+		cfg.log.debug("searching", p.Name, "with vaccine data", p.answerIDs)
+	}
+
+	if cfg.Coordinates != nil {
+		return nil, searchPoint(ctx, cfg, d.stdout)
+	}
+
+	var r, err = newRunner(ctx, cfg, d)
+	if err != nil {
+		return nil, err
+	}
+
+	var stopProfiling func()
+	stopProfiling, err = startProfiling(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("starting profiling: %w", err)
+	}
+
+	// The global source isn't seeded, so every instance would otherwise
+	// draw the same delay.
+	var jitter = rand.New(rand.NewSource(time.Now().UnixNano() ^ int64(os.Getpid())))
+	if delay := startupDelay(cfg, d.stdout, jitter.Int63n); delay > 0 {
+		cfg.log.info("waiting", delay, "before the first scan")
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			stopProfiling()
+			return nil, nil
+		}
+	}
+
+	var l *lease
+	if cfg.LockFile != "" {
+		l = newLease(cfg.LockFile, cfg.LockTTL, cfg.Now, cfg.log)
+		r.lease = l
+	}
+
+	if cfg.Once || cfg.Interval <= 0 {
+		// A single scan keeps the lease, for the replica's next run to
+		// renew, so that scheduled runs stay with one replica.
+		if l.standby() {
+			stopProfiling()
+			return nil, nil
+		}
+		cfg.log.info("running a single scan")
+		var held, stop = l.hold(ctx)
+		var scanCtx, cancel = scanContext(held, cfg)
+		var summary *Summary
+		summary, err = r.scan(scanCtx)
+		cancel()
+		stop()
+		stopProfiling()
+		if err != nil {
+			return nil, err
+		}
+		if ctx.Err() != nil {
+			return summary, errors.New("interrupted after " + strconv.Itoa(summary.ZipsSearched) + " zips")
+		}
+		// Finding nothing is a successful scan, but failing to search is
+		// worth a nonzero exit, for monitoring to tell the two apart.
+		if cfg.FailErrorRate > 0 && summary.errorRate() >= cfg.FailErrorRate {
+			return summary, fmt.Errorf("%d of %d searches failed", summary.SearchErrors, summary.Searches)
+		}
+		return summary, nil
+	}
+
+	cfg.log.info("running as a daemon, scanning every", cfg.Interval)
+	var wd = newWatchdog(cfg)
+	var last *Summary
+	for {
+		if !l.standby() {
+			var held, stop = l.hold(ctx)
+			var scanCtx, cancel = scanContext(held, cfg)
+			var summary *Summary
+			summary, err = r.scan(scanCtx)
+			cancel()
+			stop()
+			if err != nil {
+				cfg.log.error(err)
+			} else {
+				wd.observe(summary)
+				last = summary
+			}
+		}
+
+		select {
+		case <-time.After(cfg.Interval):
+		case <-ctx.Done():
+			stopProfiling()
+			return last, l.release()
+		}
+	}
+}
+
+// startupDelay returns how long to wait before the first scan: a random
+// duration of up to cfg.StartupJitter, drawn with n, or zero if there's no
+// jitter or it's skipped for this run.
+func startupDelay(cfg *Config, stdout io.Writer, n func(int64) int64) time.Duration {
+	if cfg.StartupJitter <= 0 {
+		return 0
+	}
+	if cfg.JitterDaemonOnly {
+		if cfg.Once || cfg.Interval <= 0 {
+			return 0
+		}
+		if f, ok := stdout.(*os.File); ok && isTerminal(f) {
+			return 0
+		}
+	}
+	return time.Duration(n(int64(cfg.StartupJitter) + 1))
+}
+
+// scanContext returns the context a single scan runs under, derived from
+// parent, which expires after cfg.ScanDeadline if one is set.
+func scanContext(parent context.Context, cfg *Config) (context.Context, context.CancelFunc) {
+	if cfg.ScanDeadline > 0 {
+		return context.WithTimeout(parent, cfg.ScanDeadline)
+	}
+	return context.WithCancel(parent)
+}
+
+// searchPoint runs a single search at cfg.Coordinates and prints the sites
+// found to w, without loading the data or tweeting.
+func searchPoint(ctx context.Context, cfg *Config, w io.Writer) error {
+	var client = newHTTPClient(cfg)
+	for i, p := range cfg.Profiles {
+		var resp, err = searchLocations(ctx, cfg, client, newPostData(cfg, cfg.Coordinates, p))
+		if err != nil {
+			return fmt.Errorf("searching coordinates: %w", err)
+		}
+
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, "profile:", p.Name, "eligible:", resp.Eligible, "locations:", len(resp.Locations))
+		for _, loc := range resp.Locations {
+			fmt.Fprintln(w)
+			fmt.Fprintln(w, loc.String())
+			fmt.Fprintln(w, formatDistance(cfg, loc.DistanceInMeters), "away")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,362 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingNotifier keeps every message it's asked to send.
+type recordingNotifier struct {
+	cfg *Config
+
+	mu   sync.Mutex
+	sent []string
+}
+
+func (n *recordingNotifier) Name() string { return "recording" }
+
+func (n *recordingNotifier) Format(loc *VaccineLocation) string { return formatTweet(n.cfg, loc) }
+
+func (n *recordingNotifier) Post(text string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sent = append(n.sent, text)
+	return nil
+}
+
+// testZips are the zip records the run tests scan.
+const testZips = `[
+	{"recordid": "1", "fields": {"zip": "94103", "city": "San Francisco", "state": "CA", "latitude": 37.7725, "longitude": -122.4147, "timezone": -8, "dst": 1}, "record_timestamp": "2018-02-09T08:33:38.603-08:00"},
+	{"recordid": "2", "fields": {"zip": "94110", "city": "San Francisco", "state": "CA", "latitude": 37.7485, "longitude": -122.4184, "timezone": -8, "dst": 1}, "record_timestamp": "2018-02-09T08:33:38.603-08:00"}
+]`
+
+// testSearchAPI answers every search with the same sites, counting the
+// searches it gets.
+func testSearchAPI(t *testing.T, searches *int) *httptest.Server {
+	var mu sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var pd PostData
+		var err = json.NewDecoder(r.Body).Decode(&pd)
+		if err != nil || pd.Location == nil || pd.VaccineData == "" {
+			t.Errorf("bad search request: %v %+v", err, pd)
+		}
+		mu.Lock()
+		*searches++
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", JSONMimeType)
+		w.Write([]byte(`{"eligible": true, "vaccineData": "", "locations": [
+			{"extId": "a", "name": "Moscone Center", "displayAddress": "747 Howard St, San Francisco, CA 94103", "location": {"lat": 37.7842, "lng": -122.4016},
+			 "openHours": [{"days": ["monday"], "localStart": "09:00:00", "localEnd": "17:00:00"}], "type": "Store"},
+			{"extId": "b", "name": "SF General", "displayAddress": "1001 Potrero Ave, San Francisco, CA 94110", "location": {"lat": 37.7557, "lng": -122.4052}, "type": "Hospital"}
+		]}`))
+	}))
+}
+
+func TestRunNotifiesOnceAndKeepsState(t *testing.T) {
+	var dir = t.TempDir()
+	var data = filepath.Join(dir, "zips.json")
+	var err = ioutil.WriteFile(data, []byte(testZips), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statePath = filepath.Join(dir, "state.json")
+
+	var searches int
+	var api = testSearchAPI(t, &searches)
+	defer api.Close()
+
+	var exports = map[string]string{
+		"-export-json":    filepath.Join(dir, "sites.json"),
+		"-export-csv":     filepath.Join(dir, "sites.csv"),
+		"-export-geojson": filepath.Join(dir, "sites.geojson"),
+		"-export-html":    filepath.Join(dir, "sites.html"),
+	}
+	var args = []string{"-api-urls", api.URL, "-data-file", data, "-state-file", statePath}
+	for flag, path := range exports {
+		args = append(args, flag, path)
+	}
+	var cfg *Config
+	cfg, err = parseConfig(args, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n = &recordingNotifier{cfg: cfg}
+	var short = &shortNotifier{}
+
+	var summary *Summary
+	summary, err = run(context.Background(), cfg, deps{notifiers: []Notifier{n, short}, stdout: ioutil.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if summary.ZipsSearched != 2 || summary.Searches != 2 || searches != 2 {
+		t.Errorf("searched %d zips in %d searches, the API got %d, want 2 of each", summary.ZipsSearched, summary.Searches, searches)
+	}
+	if summary.SitesFound != 2 {
+		t.Errorf("found %d sites, want the 2 both searches found", summary.SitesFound)
+	}
+	if summary.Notifications != 4 || summary.NotifyErrors != 0 {
+		t.Errorf("sent %d notifications with %d errors, want 2 per notifier and none", summary.Notifications, summary.NotifyErrors)
+	}
+	sort.Strings(n.sent)
+	if len(n.sent) != 2 || !strings.HasPrefix(n.sent[0], "Moscone Center\n747 Howard St") || !strings.HasPrefix(n.sent[1], "SF General\n1001 Potrero Ave") {
+		t.Errorf("sent %q", n.sent)
+	}
+	sort.Strings(short.sent)
+	if len(short.sent) != 2 || short.sent[0] != "Moscone" || short.sent[1] != "SF" {
+		t.Errorf("short notifier sent %q, want each site in its own format", short.sent)
+	}
+	for flag, path := range exports {
+		var b, err = ioutil.ReadFile(path)
+		if err != nil {
+			t.Errorf("%s: %v", flag, err)
+			continue
+		}
+		if !strings.Contains(string(b), "Moscone Center") || !strings.Contains(string(b), "SF General") {
+			t.Errorf("%s wrote %s, want both sites", flag, b)
+		}
+	}
+	var fc struct{ Features []json.RawMessage }
+	if b, _ := ioutil.ReadFile(exports["-export-geojson"]); json.Unmarshal(b, &fc) != nil || len(fc.Features) != 2 {
+		t.Errorf("GeoJSON export has %d features, want 2", len(fc.Features))
+	}
+
+	var state *State
+	state, err = loadState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"a", "b"} {
+		if s := state.Sites[id]; s == nil || s.LastNotified.IsZero() {
+			t.Errorf("state has no notification of site %s: %+v", id, state.Sites)
+		}
+	}
+
+	// The next run finds the same sites, but they were just announced.
+	// They're still exported.
+	n.sent, short.sent = nil, nil
+	for _, path := range exports {
+		os.Remove(path)
+	}
+	summary, err = run(context.Background(), cfg, deps{notifiers: []Notifier{n, short}, stdout: ioutil.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.SitesFound != 2 || summary.Notifications != 0 || len(n.sent) != 0 || len(short.sent) != 0 {
+		t.Errorf("second run found %d sites and sent %q and %q, want 2 found and none sent", summary.SitesFound, n.sent, short.sent)
+	}
+	for flag, path := range exports {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s not written on the second run: %v", flag, err)
+		}
+	}
+}
+
+// testDuplicateZips repeats testZips' records, once by zip and once by
+// coordinates under another zip.
+const testDuplicateZips = `[
+	{"recordid": "1", "fields": {"zip": "94103", "city": "San Francisco", "state": "CA", "latitude": 37.7725, "longitude": -122.4147, "timezone": -8, "dst": 1}, "record_timestamp": "2018-02-09T08:33:38.603-08:00"},
+	{"recordid": "2", "fields": {"zip": "94110", "city": "San Francisco", "state": "CA", "latitude": 37.7485, "longitude": -122.4184, "timezone": -8, "dst": 1}, "record_timestamp": "2018-02-09T08:33:38.603-08:00"},
+	{"recordid": "3", "fields": {"zip": "94103", "city": "San Francisco", "state": "CA", "latitude": 37.7725, "longitude": -122.4147, "timezone": -8, "dst": 1}, "record_timestamp": "2018-02-09T08:33:38.603-08:00"},
+	{"recordid": "4", "fields": {"zip": "94199", "city": "San Francisco", "state": "CA", "latitude": 37.7485, "longitude": -122.4184, "timezone": -8, "dst": 1}, "record_timestamp": "2018-02-09T08:33:38.603-08:00"}
+]`
+
+func TestRunSkipsDuplicateRecords(t *testing.T) {
+	var dir = t.TempDir()
+	var data = filepath.Join(dir, "zips.json")
+	var err = ioutil.WriteFile(data, []byte(testDuplicateZips), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var records []*ZipToLatLong
+	var skipped int
+	records, skipped, err = parseJSONData(nil, data, "", nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || skipped != 0 || records[0].RecordID != "1" || records[1].RecordID != "2" {
+		t.Errorf("got %d records, %d skipped, want the first 2 and none skipped", len(records), skipped)
+	}
+
+	var searches int
+	var api = testSearchAPI(t, &searches)
+	defer api.Close()
+
+	var cfg *Config
+	cfg, err = parseConfig([]string{"-api-urls", api.URL, "-data-file", data, "-state-file="}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n = &recordingNotifier{cfg: cfg}
+	var summary *Summary
+	summary, err = run(context.Background(), cfg, deps{notifiers: []Notifier{n}, stdout: ioutil.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.ZipsSearched != 2 || searches != 2 {
+		t.Errorf("searched %d zips, the API got %d searches, want 2 of each", summary.ZipsSearched, searches)
+	}
+	if len(n.sent) != 2 || summary.Notifications != 2 {
+		t.Errorf("sent %q, want one alert per site", n.sent)
+	}
+}
+
+func TestRunSkipsIneligibleResponses(t *testing.T) {
+	var dir = t.TempDir()
+	var data = filepath.Join(dir, "zips.json")
+	var err = ioutil.WriteFile(data, []byte(testZips), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The search near 94103 isn't eligible, but lists a site anyway.
+	var api = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var pd PostData
+		json.NewDecoder(r.Body).Decode(&pd)
+		w.Header().Set("Content-Type", JSONMimeType)
+		if pd.Location != nil && pd.Location.Lat > 37.76 {
+			w.Write([]byte(`{"eligible": false, "locations": [{"extId": "a", "name": "Moscone Center", "displayAddress": "747 Howard St"}]}`))
+			return
+		}
+		w.Write([]byte(`{"eligible": true, "locations": [{"extId": "b", "name": "SF General", "displayAddress": "1001 Potrero Ave"}]}`))
+	}))
+	defer api.Close()
+
+	var cases = []struct {
+		name  string
+		flags []string
+		sites []string
+	}{
+		{"skipped by default", nil, []string{"SF General"}},
+		{"with -notify-ineligible", []string{"-notify-ineligible"}, []string{"Moscone Center", "SF General"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var cfg, err = parseConfig(append([]string{"-api-urls", api.URL, "-data-file", data, "-state-file="}, c.flags...), false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var n = &recordingNotifier{cfg: cfg}
+			var summary *Summary
+			summary, err = run(context.Background(), cfg, deps{notifiers: []Notifier{n}, stdout: ioutil.Discard})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var sent []string
+			for _, text := range n.sent {
+				sent = append(sent, strings.SplitN(text, "\n", 2)[0])
+			}
+			sort.Strings(sent)
+			if summary.SitesFound != len(c.sites) || !reflect.DeepEqual(sent, c.sites) {
+				t.Errorf("found %d sites and sent %q, want %q", summary.SitesFound, sent, c.sites)
+			}
+			if summary.IneligibleResponses != 1 {
+				t.Errorf("counted %d ineligible responses, want 1 either way", summary.IneligibleResponses)
+			}
+		})
+	}
+}
+
+func TestRunCountsFailedSearches(t *testing.T) {
+	var dir = t.TempDir()
+	var data = filepath.Join(dir, "zips.json")
+	var err = ioutil.WriteFile(data, []byte(testZips), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var api = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer api.Close()
+
+	var cfg *Config
+	cfg, err = parseConfig([]string{"-api-urls", api.URL, "-data-file", data, "-state-file", filepath.Join(dir, "state.json")}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n = &recordingNotifier{cfg: cfg}
+	var summary *Summary
+	summary, _ = run(context.Background(), cfg, deps{notifiers: []Notifier{n}, stdout: ioutil.Discard})
+	if summary == nil {
+		t.Fatal("no summary")
+	}
+	if summary.SearchErrors != 2 || summary.SitesFound != 0 || len(n.sent) != 0 {
+		t.Errorf("summary %+v, sent %q, want both searches failed and nothing sent", summary, n.sent)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "state.json")); err == nil {
+		var state, _ = loadState(filepath.Join(dir, "state.json"))
+		if len(state.Sites) != 0 {
+			t.Errorf("state remembers %v after nothing was found", state.Sites)
+		}
+	}
+}
+
+func TestRunSlicesCoverEveryZipOnce(t *testing.T) {
+	var dir = t.TempDir()
+	var records []string
+	for i := 0; i < 6; i++ {
+		records = append(records, `{"recordid": "`+strconv.Itoa(i)+`", "fields": {"zip": "9000`+strconv.Itoa(i)+`", "state": "CA", "latitude": `+strconv.Itoa(33+i)+`, "longitude": -118, "timezone": -8, "dst": 1}}`)
+	}
+	var data = filepath.Join(dir, "zips.json")
+	var err = ioutil.WriteFile(data, []byte("["+strings.Join(records, ",")+"]"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var searched = make(map[float64]int)
+	var api = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var pd PostData
+		json.NewDecoder(r.Body).Decode(&pd)
+		mu.Lock()
+		searched[pd.Location.Lat]++
+		mu.Unlock()
+		w.Write([]byte(`{"eligible": true, "locations": []}`))
+	}))
+	defer api.Close()
+
+	for _, order := range [][]string{nil, {"-shuffle", "-shuffle-seed", "7"}} {
+		searched = make(map[float64]int)
+		var cfg *Config
+		cfg, err = parseConfig(append([]string{"-api-urls", api.URL, "-data-file", data, "-state-file=",
+			"-slice-size", "2", "-cursor-file", filepath.Join(dir, "cursor"+strconv.Itoa(len(order)))}, order...), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Each run shuffles afresh, as separate cron runs would.
+		for i := 0; i < 3; i++ {
+			_, err = run(context.Background(), cfg, deps{notifiers: []Notifier{&recordingNotifier{cfg: cfg}}, stdout: ioutil.Discard})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if len(searched) != 6 {
+			t.Errorf("%v: 3 runs searched %d of the 6 zips: %v", order, len(searched), searched)
+		}
+		for lat, n := range searched {
+			if n != 1 {
+				t.Errorf("%v: zip at %v searched %d times", order, lat, n)
+			}
+		}
+	}
+
+	_, err = parseConfig([]string{"-slice-size", "2", "-cursor-file", "c", "-shuffle"}, false)
+	if err == nil {
+		t.Error("-slice-size with an unseeded -shuffle allowed")
+	}
+}
@@ -0,0 +1,68 @@
+package alerts
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+)
+
+// apiProfile holds the API specifics, which were worked out from the web UI
+// and change with it, so they can be updated in a file without a rebuild.
+// Anything it leaves out keeps the compiled in default.
+type apiProfile struct {
+	// URLs are the API endpoints to search, as with -api-urls.
+	URLs []string `json:"urls"`
+	// Headers are added to every API request.
+	Headers map[string]string `json:"headers"`
+	// Eligibility maps eligibility profile names to the survey answer IDs
+	// their vaccineData encodes, replacing or adding to the known ones.
+	Eligibility map[string][]string `json:"eligibility"`
+}
+
+// loadAPIProfile reads the API profile file at path.
+func loadAPIProfile(path string) (*apiProfile, error) {
+	var b, err = ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p = &apiProfile{}
+	err = json.Unmarshal(b, p)
+	if err != nil {
+		return nil, errors.New("invalid API profile " + path + ": " + err.Error())
+	}
+	for name, ids := range p.Eligibility {
+		if len(ids) == 0 {
+			return nil, errors.New("invalid API profile " + path + ": eligibility profile " + name + " has no answers")
+		}
+	}
+	return p, nil
+}
+
+// eligibility returns the known eligibility profiles with p's on top.
+func (p *apiProfile) eligibility() map[string][]string {
+	var out = make(map[string][]string, len(eligibilityProfiles)+len(p.Eligibility))
+	for name, ids := range eligibilityProfiles {
+		out[name] = ids
+	}
+	for name, ids := range p.Eligibility {
+		out[name] = ids
+	}
+	return out
+}
+
+// addHeaders sets p's headers on h, except the ones h already has, so
+// headers given as options win.
+func (p *apiProfile) addHeaders(h http.Header) {
+	addMissingHeaders(h, p.Headers)
+}
+
+// addMissingHeaders sets each of add on h that h doesn't have at all. A
+// header h has empty is kept, leaving it out of requests.
+func addMissingHeaders(h http.Header, add map[string]string) {
+	for k, v := range add {
+		if _, ok := h[http.CanonicalHeaderKey(k)]; !ok {
+			h.Set(k, v)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package alerts
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// runArtifacts writes the files recording what a single run did, under a
+// directory named for the time the run started. A nil *runArtifacts writes
+// nothing, so callers don't need to check whether artifacts are enabled.
+type runArtifacts struct {
+	dir string
+}
+
+// newRunArtifacts creates root/<RFC3339 start>/ and removes the oldest run
+// directories under root beyond keep. Zero keeps every run.
+func newRunArtifacts(root string, start time.Time, keep int) (*runArtifacts, error) {
+	var dir = filepath.Join(root, start.UTC().Format(time.RFC3339))
+	var err error
+	for _, sub := range []string{"requests", "responses"} {
+		err = os.MkdirAll(filepath.Join(dir, sub), 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if keep > 0 {
+		err = pruneRuns(root, keep)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &runArtifacts{dir: dir}, nil
+}
+
+// pruneRuns removes all but the newest keep run directories under root.
+func pruneRuns(root string, keep int) error {
+	var entries, err = ioutil.ReadDir(root)
+	if err != nil {
+		return err
+	}
+
+	var runs []string
+	for _, e := range entries {
+		var _, perr = time.Parse(time.RFC3339, e.Name())
+		if e.IsDir() && perr == nil {
+			runs = append(runs, e.Name())
+		}
+	}
+	// UTC RFC3339 names sort chronologically.
+	sort.Strings(runs)
+
+	for len(runs) > keep {
+		err = os.RemoveAll(filepath.Join(root, runs[0]))
+		if err != nil {
+			return err
+		}
+		runs = runs[1:]
+	}
+
+	return nil
+}
+
+// writeJSON writes v to name in the run directory.
+func (a *runArtifacts) writeJSON(name string, v interface{}) error {
+	if a == nil {
+		return nil
+	}
+
+	var b, err = json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(a.dir, name), b, 0644)
+}
+
+// writeResponse saves the raw API response for a searched zip.
+func (a *runArtifacts) writeResponse(zip string, raw []byte) error {
+	if a == nil {
+		return nil
+	}
+
+	return ioutil.WriteFile(filepath.Join(a.dir, "responses", zip+".json"), raw, 0644)
+}
+
+// writeRequest saves the request a zip was searched with.
+func (a *runArtifacts) writeRequest(zip string, req *requestDump) error {
+	return a.writeJSON(filepath.Join("requests", zip+".json"), req)
+}
+
+// requestDump is a search request, as sent, for reproducing it by hand.
+type requestDump struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header"`
+	Body   *PostData   `json:"body"`
+	// VaccineIDs are the eligibility IDs Body.VaccineData decodes to.
+	VaccineIDs []string `json:"vaccineIds"`
+	// Curl is the request as a curl command line.
+	Curl string `json:"curl"`
+}
+
+// newRequestDump describes the search for pd sent to url, with the headers
+// newHTTPClient's client adds. The Authorization header is redacted, as run
+// directories get shared when reporting problems.
+func newRequestDump(cfg *Config, url string, pd *PostData) *requestDump {
+	var h = http.Header{
+		"Content-Type":    {JSONMimeType},
+		"Accept-Encoding": {"gzip"},
+	}
+	for k, v := range cfg.APIHeaders {
+		h[k] = v
+	}
+	if h.Get("Authorization") != "" {
+		h.Set("Authorization", "REDACTED")
+	}
+
+	var ids, _ = decodeVaccineData(pd.VaccineData)
+	var body, _ = json.Marshal(pd)
+
+	var curl = []string{"curl", "-X", http.MethodPost, shellQuote(url), "--compressed"}
+	var keys = make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		// curl sets Accept-Encoding itself for --compressed.
+		if k == "Accept-Encoding" {
+			continue
+		}
+		for _, v := range h[k] {
+			curl = append(curl, "-H", shellQuote(k+": "+v))
+		}
+	}
+	curl = append(curl, "--data", shellQuote(string(body)))
+
+	return &requestDump{
+		Method:     http.MethodPost,
+		URL:        url,
+		Header:     h,
+		Body:       pd,
+		VaccineIDs: ids,
+		Curl:       strings.Join(curl, " "),
+	}
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
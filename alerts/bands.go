@@ -0,0 +1,93 @@
+package alerts
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The policies a distance band can have.
+const (
+	// BandImmediate announces a band's sites as they're found.
+	BandImmediate = "immediate"
+	// BandDigest saves a band's sites for the daily digest.
+	BandDigest = "digest"
+	// BandIgnore never announces a band's sites.
+	BandIgnore = "ignore"
+)
+
+// distanceBand is how sites up to miles away from the -near zip are
+// announced.
+type distanceBand struct {
+	miles  float64
+	policy string
+}
+
+// parseDistanceBands parses comma separated miles=policy pairs, e.g.
+// "10=immediate,50=digest", into bands sorted nearest first.
+func parseDistanceBands(s string) ([]*distanceBand, error) {
+	var bands []*distanceBand
+	for _, kv := range strings.Split(s, ",") {
+		if strings.TrimSpace(kv) == "" {
+			continue
+		}
+		var parts = strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.New("invalid distance band " + kv + ", expected miles=policy")
+		}
+		var miles, err = strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+		if err != nil || miles <= 0 {
+			return nil, errors.New("invalid distance band " + kv + ", miles must be a positive number")
+		}
+		var policy = strings.TrimSpace(parts[1])
+		if policy != BandImmediate && policy != BandDigest && policy != BandIgnore {
+			return nil, errors.New("invalid distance band " + kv + ", policy must be immediate, digest or ignore")
+		}
+		bands = append(bands, &distanceBand{miles: miles, policy: policy})
+	}
+	sort.Slice(bands, func(i, j int) bool { return bands[i].miles < bands[j].miles })
+	return bands, nil
+}
+
+// hasBandPolicy reports whether any of bands has policy.
+func hasBandPolicy(bands []*distanceBand, policy string) bool {
+	for _, b := range bands {
+		if b.policy == policy {
+			return true
+		}
+	}
+	return false
+}
+
+// bandPolicy returns the policy of the nearest band loc is within, from
+// home. Sites beyond every band are ignored, and sites without coordinates
+// take the farthest band's policy, as the most cautious guess.
+func bandPolicy(bands []*distanceBand, home Location, loc *VaccineLocation) string {
+	if loc.Location == nil {
+		return bands[len(bands)-1].policy
+	}
+	var d = haversine(home, *loc.Location)
+	for _, b := range bands {
+		if d <= b.miles*MetersPerMile {
+			return b.policy
+		}
+	}
+	return BandIgnore
+}
+
+// splitBands splits the sites found by the policy of their distance band
+// from r.home.
+func (r *runner) splitBands(found []*VaccineLocation) (immediate, digest []*VaccineLocation) {
+	for _, v := range found {
+		switch bandPolicy(r.cfg.DistanceBands, r.home, v) {
+		case BandImmediate:
+			immediate = append(immediate, v)
+		case BandDigest:
+			digest = append(digest, v)
+		default:
+			r.cfg.log.debug("not notifying", v.Name, "as its distance band is ignored")
+		}
+	}
+	return immediate, digest
+}
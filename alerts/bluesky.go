@@ -0,0 +1,295 @@
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	EnvBlueskyHandle      = "BLUESKY_HANDLE"
+	EnvBlueskyAppPassword = "BLUESKY_APP_PASSWORD"
+	// EnvBlueskyHost optionally points at a PDS other than bsky.social.
+	EnvBlueskyHost = "BLUESKY_HOST"
+
+	DefaultBlueskyHost = "https://bsky.social"
+	// BlueskyLimit is the maximum length of a post. Unlike Twitter, links
+	// count for their full length.
+	BlueskyLimit = 300
+)
+
+func init() {
+	registerNotifier("bluesky", newBlueskyNotifier)
+}
+
+// BlueskyNotifier posts sites to Bluesky through the AT Protocol.
+type BlueskyNotifier struct {
+	cfg      *Config
+	client   *http.Client
+	host     string
+	handle   string
+	password string
+
+	mu      sync.Mutex
+	session *blueskySession
+}
+
+type blueskySession struct {
+	AccessJwt  string `json:"accessJwt"`
+	RefreshJwt string `json:"refreshJwt"`
+	DID        string `json:"did"`
+}
+
+// blueskyError is returned for an XRPC call answered with an error status,
+// naming the error the body gives, e.g. ExpiredToken.
+type blueskyError struct {
+	method string
+	code   int
+	status string
+	name   string
+}
+
+func (e *blueskyError) Error() string {
+	var s = e.method + ": unexpected status " + e.status
+	if e.name != "" {
+		s += " (" + e.name + ")"
+	}
+	return s
+}
+
+// sessionExpired reports whether err is Bluesky refusing a session's access
+// token, which expires after a few hours.
+func sessionExpired(err error) bool {
+	var be *blueskyError
+	if !errors.As(err, &be) {
+		return false
+	}
+	return be.code == http.StatusUnauthorized || be.name == "ExpiredToken" || be.name == "InvalidToken"
+}
+
+// newBlueskyNotifier returns a notifier for the account configured in the
+// environment, or nil if there isn't one.
+func newBlueskyNotifier(cfg *Config) (Notifier, error) {
+	var handle, ok = os.LookupEnv(EnvBlueskyHandle)
+	if !ok {
+		return nil, nil
+	}
+
+	var password string
+	password, ok = os.LookupEnv(EnvBlueskyAppPassword)
+	if !ok {
+		return nil, errors.New("missing env variable " + EnvBlueskyAppPassword)
+	}
+
+	var host string
+	host, ok = os.LookupEnv(EnvBlueskyHost)
+	if !ok {
+		host = DefaultBlueskyHost
+	}
+
+	return &BlueskyNotifier{
+		cfg:      cfg,
+		client:   &http.Client{Transport: baseTransport(cfg)},
+		host:     strings.TrimSuffix(host, "/"),
+		handle:   handle,
+		password: password,
+	}, nil
+}
+
+func (b *BlueskyNotifier) Name() string {
+	return "bluesky"
+}
+
+func (b *BlueskyNotifier) Format(loc *VaccineLocation) string {
+	return formatMessage(b.cfg, loc, BlueskyLimit, utf8.RuneCountInString)
+}
+
+// Verify checks the handle and app password by logging in.
+func (b *BlueskyNotifier) Verify() error {
+	var _, err = b.login()
+	return err
+}
+
+// Post posts text. If the session's token has expired, it's refreshed and
+// the post tried once more.
+func (b *BlueskyNotifier) Post(text string) error {
+	var s, err = b.login()
+	if err != nil {
+		return err
+	}
+
+	err = b.createPost(s, text)
+	if !sessionExpired(err) {
+		return err
+	}
+	b.cfg.log.info("bluesky session expired, refreshing it")
+	s, err = b.refresh(s)
+	if err != nil {
+		return err
+	}
+	return b.createPost(s, text)
+}
+
+// createPost posts text in session s.
+func (b *BlueskyNotifier) createPost(s *blueskySession, text string) error {
+	var record = map[string]interface{}{
+		"$type":     "app.bsky.feed.post",
+		"text":      text,
+		"createdAt": b.cfg.Now().UTC().Format(time.RFC3339),
+	}
+	var facets = linkFacets(text)
+	if len(facets) > 0 {
+		record["facets"] = facets
+	}
+
+	return b.call("com.atproto.repo.createRecord", s.AccessJwt, map[string]interface{}{
+		"repo":       s.DID,
+		"collection": "app.bsky.feed.post",
+		"record":     record,
+	}, nil)
+}
+
+// login creates a session on first use and reuses it afterwards, until
+// refresh replaces it.
+func (b *BlueskyNotifier) login() (*blueskySession, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.session != nil {
+		return b.session, nil
+	}
+
+	var s, err = b.createSession()
+	if err != nil {
+		return nil, err
+	}
+
+	b.session = s
+	return s, nil
+}
+
+// refresh replaces the expired session old with a new one, through its
+// refresh token, or by logging in again if that fails too. Should another
+// post have replaced old already, its session is used.
+func (b *BlueskyNotifier) refresh(old *blueskySession) (*blueskySession, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.session != old && b.session != nil {
+		return b.session, nil
+	}
+	b.session = nil
+
+	var s = &blueskySession{}
+	var err = b.call("com.atproto.server.refreshSession", old.RefreshJwt, struct{}{}, s)
+	if err != nil {
+		b.cfg.log.info("logging in to bluesky again, as refreshing the session failed:", err)
+		s, err = b.createSession()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	b.session = s
+	return s, nil
+}
+
+// createSession logs in with the handle and app password.
+func (b *BlueskyNotifier) createSession() (*blueskySession, error) {
+	var s = &blueskySession{}
+	var err = b.call("com.atproto.server.createSession", "", map[string]string{
+		"identifier": b.handle,
+		"password":   b.password,
+	}, s)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// call POSTs in to the XRPC method and decodes the response into out, if
+// it's non-nil.
+func (b *BlueskyNotifier) call(method, token string, in, out interface{}) error {
+	var body, err = json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	var req *http.Request
+	req, err = http.NewRequest(http.MethodPost, b.host+"/xrpc/"+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", JSONMimeType)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	var r *http.Response
+	r, err = doWithRetry(b.cfg, b.client, req, NotifyAttempts)
+	if r != nil {
+		defer drainAndClose(r.Body)
+	}
+	if err != nil {
+		return err
+	}
+
+	if r.StatusCode >= http.StatusBadRequest {
+		var e = &blueskyError{method: method, code: r.StatusCode, status: r.Status}
+		var body struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(r.Body).Decode(&body) == nil {
+			e.name = body.Error
+		}
+		return e
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(r.Body).Decode(out)
+}
+
+// blueskyFacet marks a range of a post's text as rich text, here a link.
+// Bluesky doesn't detect links in post text itself.
+type blueskyFacet struct {
+	Index struct {
+		ByteStart int `json:"byteStart"`
+		ByteEnd   int `json:"byteEnd"`
+	} `json:"index"`
+	Features []blueskyLink `json:"features"`
+}
+
+type blueskyLink struct {
+	Type string `json:"$type"`
+	URI  string `json:"uri"`
+}
+
+// linkFacets returns a link facet for every URL in text. Facet indexes are
+// UTF-8 byte offsets.
+func linkFacets(text string) []*blueskyFacet {
+	var facets []*blueskyFacet
+	var offset int
+	for _, w := range strings.Fields(text) {
+		var start = offset + strings.Index(text[offset:], w)
+		offset = start + len(w)
+		if !strings.HasPrefix(w, "http://") && !strings.HasPrefix(w, "https://") {
+			continue
+		}
+
+		var f = &blueskyFacet{
+			Features: []blueskyLink{{Type: "app.bsky.richtext.facet#link", URI: w}},
+		}
+		f.Index.ByteStart = start
+		f.Index.ByteEnd = offset
+		facets = append(facets, f)
+	}
+	return facets
+}
@@ -0,0 +1,122 @@
+package alerts
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeBluesky is a PDS whose access tokens expire after one post.
+type fakeBluesky struct {
+	calls  []string
+	logins int
+	used   map[string]bool
+	// refreshFails makes refreshSession fail, as it does once the refresh
+	// token has expired too.
+	refreshFails bool
+}
+
+func (f *fakeBluesky) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var method = strings.TrimPrefix(r.URL.Path, "/xrpc/")
+	var token = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	f.calls = append(f.calls, strings.TrimSpace(method+" "+token))
+
+	switch method {
+	case "com.atproto.server.createSession":
+		f.logins++
+		var n = strconv.Itoa(f.logins)
+		json.NewEncoder(w).Encode(map[string]string{"accessJwt": "access" + n, "refreshJwt": "refresh" + n, "did": "did:plc:x"})
+	case "com.atproto.server.refreshSession":
+		if f.refreshFails {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "ExpiredToken"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"accessJwt": "refreshed", "refreshJwt": "refresh", "did": "did:plc:x"})
+	case "com.atproto.repo.createRecord":
+		if f.used[token] {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "ExpiredToken", "message": "Token has expired"})
+			return
+		}
+		f.used[token] = true
+		w.Write([]byte(`{}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestBlueskyRefreshesExpiredSession(t *testing.T) {
+	var cases = []struct {
+		name         string
+		refreshFails bool
+		want         []string
+	}{
+		{"refreshed", false, []string{
+			"com.atproto.server.createSession",
+			"com.atproto.repo.createRecord access1",
+			"com.atproto.repo.createRecord access1",
+			"com.atproto.server.refreshSession refresh1",
+			"com.atproto.repo.createRecord refreshed",
+		}},
+		{"logged in again", true, []string{
+			"com.atproto.server.createSession",
+			"com.atproto.repo.createRecord access1",
+			"com.atproto.repo.createRecord access1",
+			"com.atproto.server.refreshSession refresh1",
+			"com.atproto.server.createSession",
+			"com.atproto.repo.createRecord access2",
+		}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var f = &fakeBluesky{used: make(map[string]bool), refreshFails: c.refreshFails}
+			var srv = httptest.NewServer(f)
+			defer srv.Close()
+
+			var b = &BlueskyNotifier{
+				cfg:    &Config{Now: time.Now},
+				client: srv.Client(),
+				host:   srv.URL,
+				handle: "alerts.example",
+			}
+			for _, text := range []string{"first", "second"} {
+				var err = b.Post(text)
+				if err != nil {
+					t.Fatalf("posting %s: %v", text, err)
+				}
+			}
+
+			var got, want = strings.Join(f.calls, "\n"), strings.Join(c.want, "\n")
+			if got != want {
+				t.Errorf("calls:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestBlueskyKeepsOtherErrors(t *testing.T) {
+	var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "createSession") {
+			w.Write([]byte(`{"accessJwt": "a", "refreshJwt": "r", "did": "did:plc:x"}`))
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": "InvalidRequest"}`))
+	}))
+	defer srv.Close()
+
+	var b = &BlueskyNotifier{cfg: &Config{Now: time.Now}, client: srv.Client(), host: srv.URL}
+	var err = b.Post("text")
+	if err == nil || sessionExpired(err) {
+		t.Fatal("want a plain error, got", err)
+	}
+	if !strings.Contains(err.Error(), "InvalidRequest") {
+		t.Error("error doesn't name the XRPC error:", err)
+	}
+}
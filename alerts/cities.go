@@ -0,0 +1,55 @@
+package alerts
+
+// city is a well known place to describe where sites are relative to.
+type city struct {
+	name string
+	at   Location
+}
+
+// majorCities are California's largest cities, and the biggest town of
+// each region without one, so every site has somewhere familiar nearby.
+var majorCities = []city{
+	{"Anaheim", Location{Lat: 33.8366, Long: -117.9143}},
+	{"Bakersfield", Location{Lat: 35.3733, Long: -119.0187}},
+	{"Chico", Location{Lat: 39.7285, Long: -121.8375}},
+	{"El Centro", Location{Lat: 32.7920, Long: -115.5631}},
+	{"Eureka", Location{Lat: 40.8021, Long: -124.1637}},
+	{"Fresno", Location{Lat: 36.7378, Long: -119.7871}},
+	{"Long Beach", Location{Lat: 33.7701, Long: -118.1937}},
+	{"Los Angeles", Location{Lat: 34.0522, Long: -118.2437}},
+	{"Merced", Location{Lat: 37.3022, Long: -120.4830}},
+	{"Modesto", Location{Lat: 37.6391, Long: -120.9969}},
+	{"Oakland", Location{Lat: 37.8044, Long: -122.2712}},
+	{"Palm Springs", Location{Lat: 33.8303, Long: -116.5453}},
+	{"Redding", Location{Lat: 40.5865, Long: -122.3917}},
+	{"Riverside", Location{Lat: 33.9533, Long: -117.3962}},
+	{"Sacramento", Location{Lat: 38.5816, Long: -121.4944}},
+	{"Salinas", Location{Lat: 36.6777, Long: -121.6555}},
+	{"San Bernardino", Location{Lat: 34.1083, Long: -117.2898}},
+	{"San Diego", Location{Lat: 32.7157, Long: -117.1611}},
+	{"San Francisco", Location{Lat: 37.7749, Long: -122.4194}},
+	{"San Jose", Location{Lat: 37.3382, Long: -121.8863}},
+	{"San Luis Obispo", Location{Lat: 35.2828, Long: -120.6596}},
+	{"Santa Barbara", Location{Lat: 34.4208, Long: -119.6982}},
+	{"Santa Rosa", Location{Lat: 38.4404, Long: -122.7141}},
+	{"South Lake Tahoe", Location{Lat: 38.9399, Long: -119.9772}},
+	{"Stockton", Location{Lat: 37.9577, Long: -121.2908}},
+	{"Visalia", Location{Lat: 36.3302, Long: -119.2921}},
+}
+
+// nearestCity returns the name of the major city closest to at, or "" if
+// at isn't known.
+func nearestCity(at *Location) string {
+	if at == nil {
+		return ""
+	}
+	var best string
+	var bestDist float64
+	for _, c := range majorCities {
+		var d = haversine(*at, c.at)
+		if best == "" || d < bestDist {
+			best, bestDist = c.name, d
+		}
+	}
+	return best
+}
@@ -0,0 +1,356 @@
+package alerts
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// newHTTPClient returns the client shared by every API request in a run.
+func newHTTPClient(cfg *Config) *http.Client {
+	var transport = apiBaseTransport(cfg)
+	if cfg.HTTPTimeout > 0 {
+		transport = &timeoutTransport{next: transport, timeout: cfg.HTTPTimeout}
+	}
+	if len(cfg.APIHeaders) > 0 {
+		transport = &headerTransport{next: transport, header: cfg.APIHeaders}
+	}
+	if cfg.RateLimit > 0 {
+		transport = newAdaptiveLimiter(transport, cfg.RateLimit, cfg.Now)
+	}
+	transport = newCrawlDelayer(transport, cfg.CrawlDelay, cfg.Now, cfg.log)
+
+	return &http.Client{Transport: transport}
+}
+
+// baseTransport returns the transport the notifiers' HTTP clients, and
+// every other but the API's, are built on. When cfg.MaxHTTPRequests is set,
+// it's a concurrencyLimiter sharing its cap with the API's.
+func baseTransport(cfg *Config) http.RoundTripper {
+	if cfg.transport != nil {
+		return cfg.transport
+	}
+	return http.DefaultTransport
+}
+
+// apiBaseTransport returns the transport the API client is built on. It's
+// baseTransport's, unless cfg.InsecureSkipVerify has it skip certificate
+// checks.
+func apiBaseTransport(cfg *Config) http.RoundTripper {
+	if cfg.apiTransport != nil {
+		return cfg.apiTransport
+	}
+	return baseTransport(cfg)
+}
+
+// timeoutTransport fails requests that take longer than timeout, counting
+// from when they're sent until their body is closed. It sits under the rate
+// limiting transports, so time spent waiting in them isn't counted, unlike
+// with http.Client's Timeout.
+type timeoutTransport struct {
+	next    http.RoundTripper
+	timeout time.Duration
+}
+
+func (t *timeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var ctx, cancel = context.WithTimeout(req.Context(), t.timeout)
+	var r, err = t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	r.Body = &cancelBody{ReadCloser: r.Body, cancel: cancel}
+	return r, nil
+}
+
+// cancelBody releases its request's context once it's closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	var err = b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// warmConnections opens n connections to the API at once, with a HEAD
+// request on each, which the transport then keeps alive for the scan.
+// Failures don't matter, they only leave fewer connections warm.
+func warmConnections(ctx context.Context, log *logger, client *http.Client, url string, n int) {
+	var start = time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var req, err = http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+			if err != nil {
+				return
+			}
+			var r *http.Response
+			r, err = client.Do(req)
+			if err != nil {
+				log.debug("warming connection:", err)
+				return
+			}
+			drainAndClose(r.Body)
+		}()
+	}
+	wg.Wait()
+	log.debug("warmed", n, "connections to", url, "in", time.Since(start))
+}
+
+// concurrencyLimiter is an http.RoundTripper that allows at most cap(sem)
+// requests in flight at once. A request counts until its response body is
+// closed, since the connection is held until then.
+type concurrencyLimiter struct {
+	next http.RoundTripper
+	sem  chan struct{}
+}
+
+func newConcurrencyLimiter(next http.RoundTripper, max int) *concurrencyLimiter {
+	return &concurrencyLimiter{next: next, sem: make(chan struct{}, max)}
+}
+
+func (l *concurrencyLimiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	select {
+	case l.sem <- struct{}{}:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+
+	var resp, err = l.next.RoundTrip(req)
+	if err != nil {
+		<-l.sem
+		return nil, err
+	}
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: func() { <-l.sem }}
+	return resp, nil
+}
+
+// releaseBody calls release once, when the body is first closed.
+type releaseBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	var err = b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// browserHeaders are the headers the web UI's requests to the API are sent
+// with by a desktop browser, for -browser-headers.
+var browserHeaders = map[string]string{
+	"Accept":          "application/json, text/plain, */*",
+	"Accept-Language": "en-US,en;q=0.9",
+	"Origin":          "https://myturn.ca.gov",
+	"Referer":         "https://myturn.ca.gov/",
+	"Sec-Fetch-Dest":  "empty",
+	"Sec-Fetch-Mode":  "cors",
+	"Sec-Fetch-Site":  "same-site",
+	"User-Agent":      "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/89.0.4389.114 Safari/537.36",
+}
+
+// headerTransport is an http.RoundTripper that adds header to every request.
+// A header set empty is removed instead.
+type headerTransport struct {
+	next   http.RoundTripper
+	header http.Header
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the caller's request.
+	req = req.Clone(req.Context())
+	for k, v := range t.header {
+		if len(v) == 1 && v[0] == "" {
+			req.Header.Del(k)
+			continue
+		}
+		req.Header[k] = v
+	}
+	return t.next.RoundTrip(req)
+}
+
+// maxDrain bounds how much of an unread body drainAndClose will read before
+// giving up on reusing the connection.
+const maxDrain = 64 << 10
+
+// drainAndClose reads whatever is left of body and closes it. The transport
+// only returns a connection to the keep-alive pool once its body has been
+// fully read, so every response should be released through here, including
+// ones we bail out on without reading.
+func drainAndClose(body io.ReadCloser) {
+	io.Copy(ioutil.Discard, io.LimitReader(body, maxDrain))
+	body.Close()
+}
+
+// minRate is the slowest an adaptiveLimiter will go, in requests per second.
+const minRate = 0.1
+
+// adaptiveLimiter is an http.RoundTripper that paces requests AIMD-style:
+// it starts at the maximum rate, halves it on every 429 and adds back a
+// small step after each successful response.
+type adaptiveLimiter struct {
+	next http.RoundTripper
+	now  func() time.Time
+	max  float64
+	step float64
+
+	mu   sync.Mutex
+	rate float64
+	last time.Time
+}
+
+func newAdaptiveLimiter(next http.RoundTripper, rps float64, now func() time.Time) *adaptiveLimiter {
+	return &adaptiveLimiter{
+		next: next,
+		now:  now,
+		max:  rps,
+		step: rps / 20,
+		rate: rps,
+	}
+}
+
+func (l *adaptiveLimiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	var t = time.NewTimer(l.reserve())
+	select {
+	case <-t.C:
+	case <-req.Context().Done():
+		t.Stop()
+		return nil, req.Context().Err()
+	}
+
+	var resp, err = l.next.RoundTrip(req)
+	if err == nil {
+		l.adapt(resp.StatusCode)
+	}
+	return resp, err
+}
+
+// reserve claims the next request slot and returns how long to wait for it.
+func (l *adaptiveLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var now = l.now()
+	var slot = l.last.Add(time.Duration(float64(time.Second) / l.rate))
+	if slot.Before(now) {
+		slot = now
+	}
+	l.last = slot
+
+	return slot.Sub(now)
+}
+
+// adapt adjusts the rate based on a response status.
+func (l *adaptiveLimiter) adapt(status int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch {
+	case status == http.StatusTooManyRequests:
+		l.rate /= 2
+		if l.rate < minRate {
+			l.rate = minRate
+		}
+	case status < http.StatusBadRequest:
+		l.rate += l.step
+		if l.rate > l.max {
+			l.rate = l.max
+		}
+	}
+}
+
+// CrawlDelayHeader is the response header the API can send to ask for at
+// least this many seconds between requests.
+const CrawlDelayHeader = "Crawl-Delay"
+
+// crawlDelayer is an http.RoundTripper that spaces the start of requests
+// at least delay apart, across every goroutine sharing it. A Crawl-Delay
+// header in a response raises the spacing to what it asks for, until a
+// later response asks for something else.
+type crawlDelayer struct {
+	next  http.RoundTripper
+	now   func() time.Time
+	delay time.Duration
+	log   *logger
+
+	mu   sync.Mutex
+	hint time.Duration
+	last time.Time
+}
+
+func newCrawlDelayer(next http.RoundTripper, delay time.Duration, now func() time.Time, log *logger) *crawlDelayer {
+	return &crawlDelayer{next: next, now: now, delay: delay, log: log}
+}
+
+func (c *crawlDelayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if wait := c.reserve(); wait > 0 {
+		var t = time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-req.Context().Done():
+			t.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+
+	var resp, err = c.next.RoundTrip(req)
+	if err == nil {
+		c.observe(resp.Header.Get(CrawlDelayHeader))
+	}
+	return resp, err
+}
+
+// reserve claims the next request slot and returns how long to wait for it.
+func (c *crawlDelayer) reserve() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var delay = c.delay
+	if c.hint > delay {
+		delay = c.hint
+	}
+
+	var now = c.now()
+	var slot = now
+	if !c.last.IsZero() && c.last.Add(delay).After(now) {
+		slot = c.last.Add(delay)
+	}
+	c.last = slot
+
+	return slot.Sub(now)
+}
+
+// observe takes up the crawl delay hinted at by a Crawl-Delay header value,
+// in seconds, capped at maxRetryAfter. Values that don't parse are ignored.
+func (c *crawlDelayer) observe(v string) {
+	if v == "" {
+		return
+	}
+	var secs, err = strconv.ParseFloat(v, 64)
+	if err != nil || secs < 0 {
+		return
+	}
+
+	var hint = time.Duration(secs * float64(time.Second))
+	if hint > maxRetryAfter {
+		hint = maxRetryAfter
+	}
+
+	c.mu.Lock()
+	if hint != c.hint {
+		c.log.info("API asked for", hint, "between requests")
+	}
+	c.hint = hint
+	c.mu.Unlock()
+}
@@ -0,0 +1,244 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInsecureSkipVerifyOnlyForAPI(t *testing.T) {
+	var srv = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	var get = func(c *http.Client) error {
+		var r, err = c.Get(srv.URL)
+		if err == nil {
+			r.Body.Close()
+		}
+		return err
+	}
+
+	var cases = []struct {
+		insecure bool
+		max      int
+	}{
+		{false, 0},
+		{true, 0},
+		{true, 4},
+	}
+	for _, c := range cases {
+		t.Run("insecure "+strconv.FormatBool(c.insecure)+" max "+strconv.Itoa(c.max), func(t *testing.T) {
+			var cfg = &Config{InsecureSkipVerify: c.insecure, MaxHTTPRequests: c.max}
+			cfg.derive()
+
+			var err = get(newHTTPClient(cfg))
+			if c.insecure && err != nil {
+				t.Error("API request to a self-signed server failed:", err)
+			}
+			if !c.insecure && err == nil {
+				t.Error("API request to a self-signed server verified")
+			}
+			err = get(&http.Client{Transport: baseTransport(cfg)})
+			if err == nil {
+				t.Error("notifier request to a self-signed server verified")
+			}
+		})
+	}
+}
+
+func TestHTTPTimeoutEndsSlowSearches(t *testing.T) {
+	var cases = []struct {
+		name string
+		// headers sends the status and the start of the body before
+		// stalling, so it's reading the body that has to time out.
+		headers bool
+	}{
+		{"before the headers", false},
+		{"reading the body", true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var release = make(chan struct{})
+			var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if c.headers {
+					w.Header().Set("Content-Type", JSONMimeType)
+					w.Write([]byte(`{"locations": [`))
+					w.(http.Flusher).Flush()
+				}
+				select {
+				case <-release:
+				case <-r.Context().Done():
+				}
+			}))
+			defer srv.Close()
+			defer close(release)
+
+			var cfg, err = parseConfig([]string{"-http-timeout", "50ms", "-search-attempts", "1", "-state-file="}, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var start = time.Now()
+			_, err = postSearch(context.Background(), cfg, newHTTPClient(cfg), srv.URL, &PostData{})
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("err = %v, want the request to time out", err)
+			}
+			if took := time.Since(start); took > 5*time.Second {
+				t.Errorf("took %v to give up, want about 50ms", took)
+			}
+		})
+	}
+}
+
+// roundTripFunc is an http.RoundTripper calling itself.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestAdaptiveLimiterBacksOffAndRecovers(t *testing.T) {
+	var now = time.Date(2021, 4, 15, 9, 0, 0, 0, time.UTC)
+	var cfg = &Config{RateLimit: 10, Now: func() time.Time { return now }}
+	var status int
+	var l = newAdaptiveLimiter(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: status, Body: http.NoBody}, nil
+	}), cfg.RateLimit, cfg.Now)
+
+	// do sends a request answered with code, moving the clock well past
+	// its slot so it doesn't wait.
+	var do = func(code int) {
+		now = now.Add(time.Hour)
+		status = code
+		var req, _ = http.NewRequest(http.MethodPost, "http://api.test", nil)
+		var r, err = l.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Body.Close()
+	}
+	// spacing is how far apart back to back requests are started now.
+	var spacing = func() time.Duration {
+		now = now.Add(time.Hour)
+		l.reserve()
+		return l.reserve()
+	}
+
+	if got := spacing(); got != 100*time.Millisecond {
+		t.Fatalf("got requests %v apart, want 100ms at 10 a second", got)
+	}
+	do(http.StatusTooManyRequests)
+	if got := spacing(); got != 200*time.Millisecond {
+		t.Errorf("got requests %v apart after a 429, want the rate halved to 200ms", got)
+	}
+	do(http.StatusTooManyRequests)
+	if got := spacing(); got != 400*time.Millisecond {
+		t.Errorf("got requests %v apart after two 429s, want 400ms", got)
+	}
+	do(http.StatusInternalServerError)
+	if got := spacing(); got != 400*time.Millisecond {
+		t.Errorf("got requests %v apart after a 500, want it left at 400ms", got)
+	}
+
+	var last = spacing()
+	for i := 0; i < 30; i++ {
+		do(http.StatusOK)
+		var got = spacing()
+		if got > last {
+			t.Fatalf("got requests %v apart after success %d, up from %v", got, i+1, last)
+		}
+		last = got
+	}
+	if last != 100*time.Millisecond {
+		t.Errorf("got requests %v apart once recovered, want back to 100ms and no less", last)
+	}
+}
+
+func TestMaxHTTPRequestsSharedByAPIAndNotifiers(t *testing.T) {
+	var most int32
+	var srv = inFlightServer(3, &most)
+	defer srv.Close()
+
+	var cfg, err = parseConfig([]string{"-max-http-requests", "3", "-search-attempts", "1", "-state-file="}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var api = newHTTPClient(cfg)
+	var w = &WebhookNotifier{cfg: cfg, client: &http.Client{Transport: baseTransport(cfg)}, url: srv.URL}
+
+	var wg sync.WaitGroup
+	var errs = make(chan error, 16)
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			var _, err = postSearch(context.Background(), cfg, api, srv.URL, &PostData{})
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			errs <- w.Post("site")
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("request over the cap: %v", err)
+		}
+	}
+	if most > 3 || most < 2 {
+		t.Errorf("got up to %d requests in flight, want 3", most)
+	}
+}
+
+// BenchmarkWarmConnections times the first burst of API requests of a
+// scan, with and without the connections warmed beforehand.
+func BenchmarkWarmConnections(b *testing.B) {
+	const burst = 16
+	var srv = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	for _, warm := range []bool{false, true} {
+		var name = "cold"
+		if warm {
+			name = "warm"
+		}
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				var transport = srv.Client().Transport.(*http.Transport).Clone()
+				transport.MaxIdleConnsPerHost = burst
+				var client = &http.Client{Transport: transport}
+				if warm {
+					warmConnections(context.Background(), nil, client, srv.URL, burst)
+				}
+				b.StartTimer()
+
+				var wg sync.WaitGroup
+				for j := 0; j < burst; j++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						var r, err = client.Post(srv.URL, JSONMimeType, nil)
+						if err != nil {
+							b.Error(err)
+							return
+						}
+						drainAndClose(r.Body)
+					}()
+				}
+				wg.Wait()
+
+				b.StopTimer()
+				transport.CloseIdleConnections()
+				b.StartTimer()
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package alerts
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// version and commit identify the build. They're set at build time with
+// e.g.
+//
+//	go build -ldflags "-X github.com/adayNU/ca-vaccine-alerts/alerts.version=v1.2.0 -X github.com/adayNU/ca-vaccine-alerts/alerts.commit=$(git rev-parse --short HEAD)"
+var (
+	version = "dev"
+	commit  = "unknown"
+)
+
+// Program is the name of the binary, as completions are registered for.
+const Program = "ca-vaccine-alerts"
+
+// subcommands can be given as the first argument instead of flags.
+var subcommands = []string{"completion", "diff", "doctor", "encode-vaccine-data", "list-eligibility", "version"}
+
+// RunSubcommand runs the subcommand named by args[0], writing its output to
+// w. It reports false if args don't start with a subcommand, in which case
+// they're flags for a scan.
+func RunSubcommand(w io.Writer, args []string) (bool, error) {
+	if len(args) == 0 {
+		return false, nil
+	}
+
+	switch args[0] {
+	case "list-eligibility":
+		return true, listEligibility(w)
+	case "version":
+		return true, printVersion(w)
+	case "completion":
+		return true, writeCompletion(w, args[1:])
+	case "diff":
+		return true, runDiff(w, args[1:])
+	case "doctor":
+		return true, runDoctor(w, args[1:])
+	case "encode-vaccine-data":
+		return true, runEncodeVaccineData(w, args[1:])
+	}
+	return false, nil
+}
+
+func printVersion(w io.Writer) error {
+	var _, err = fmt.Fprintln(w, Program, version, "("+commit+")")
+	return err
+}
+
+// flagNames returns every flag name, sorted and with its leading dash.
+func flagNames() []string {
+	var names = make([]string, 0, len(flagEnv))
+	for name := range flagEnv {
+		names = append(names, "-"+name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeCompletion writes a completion script for the shell named in args,
+// one of bash, zsh or fish.
+func writeCompletion(w io.Writer, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: " + Program + " completion bash|zsh|fish")
+	}
+
+	var cmds = strings.Join(subcommands, " ")
+	var flags = strings.Join(flagNames(), " ")
+
+	var err error
+	switch args[0] {
+	case "bash":
+		_, err = fmt.Fprintf(w, bashCompletion, cmds, flags, Program)
+	case "zsh":
+		// zsh can run the bash completion through bashcompinit.
+		_, err = fmt.Fprintf(w, "autoload -U +X bashcompinit && bashcompinit\n"+bashCompletion, cmds, flags, Program)
+	case "fish":
+		_, err = fmt.Fprintf(w, "complete -c %s -f -n __fish_use_subcommand -a '%s'\n", Program, cmds)
+		for _, name := range flagNames() {
+			if err != nil {
+				break
+			}
+			_, err = fmt.Fprintf(w, "complete -c %s -o %s\n", Program, strings.TrimPrefix(name, "-"))
+		}
+	default:
+		return errors.New("unsupported shell " + args[0] + ", want bash, zsh or fish")
+	}
+	return err
+}
+
+const bashCompletion = `_ca_vaccine_alerts() {
+	local cur=${COMP_WORDS[COMP_CWORD]}
+	if [[ $COMP_CWORD -eq 1 && $cur != -* ]]; then
+		COMPREPLY=($(compgen -W "%s" -- "$cur"))
+		return
+	fi
+	COMPREPLY=($(compgen -W "%s" -- "$cur"))
+}
+complete -F _ca_vaccine_alerts %s
+`
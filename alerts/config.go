@@ -0,0 +1,1448 @@
+package alerts
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Config holds the settings that control a run.
+type Config struct {
+	// Now returns the current time. It defaults to time.Now, but tests can
+	// replace it to freeze the clock for time-sensitive logic.
+	Now func() time.Time
+
+	// PopulationFile is an optional JSON file mapping zip codes to their
+	// population. When set, the most populous zips are scanned first.
+	PopulationFile string
+
+	// MapsLink adds a Google Maps link for the site's coordinates, or its
+	// address when they aren't known, to each tweet.
+	MapsLink bool
+	// NearestCity tells which major city each site is nearest to, in its
+	// messages and exports.
+	NearestCity bool
+
+	// GeoTag tags each tweet of a single site with the site's coordinates.
+	GeoTag bool
+
+	// RoundMinutes rounds the hours shown in messages to every RoundMinutes
+	// minutes, opening times down and closing times up. Zero shows them as
+	// listed.
+	RoundMinutes int
+
+	// MessagePrefix and MessageSuffix are extra text put before and after
+	// each site's message, e.g. a note to book quickly. MessageTimestamp
+	// adds the time the message was written, so followers can tell how
+	// fresh it is.
+	MessagePrefix    string
+	MessageSuffix    string
+	MessageTimestamp bool
+
+	// MarkNew marks the sites first found today, going by the state file,
+	// in their messages and exports.
+	MarkNew bool
+
+	// AppendTimestamp ends each message with the time it was written, so
+	// repeat messages about the same sites aren't rejected as duplicates.
+	AppendTimestamp bool
+
+	// ShortenerURL, when set, is a Bitly-compatible endpoint the signup
+	// link is shortened through, authenticated with ShortenerToken. The
+	// full link is used whenever shortening fails.
+	ShortenerURL   string
+	ShortenerToken string
+	shortener      *shortener
+
+	// Shuffle randomizes the order zips are scanned in. ShuffleSeed fixes
+	// the order for reproducibility; zero picks a seed from the clock.
+	Shuffle     bool
+	ShuffleSeed int64
+
+	// Coordinates, when set, skips the data file and runs a single search
+	// at this point, printing the results.
+	Coordinates *Location
+
+	// FailedZipsFile, when set, is where each scan writes the zips whose
+	// search failed. RetryFailed searches only the zips in such a file.
+	FailedZipsFile string
+	RetryFailed    string
+
+	// Stdin searches the "lat,long" pairs read from stdin, one per line,
+	// instead of the zips in the data file.
+	Stdin bool
+
+	// Near limits the scan to zips within Radius miles of this zip, and
+	// Center to zips within Radius miles of these coordinates.
+	Near   string
+	Center *Location
+	Radius float64
+	// Cities limits the scan to the zips in these cities, matched without
+	// regard to case.
+	Cities []string
+
+	// RateLimit caps API requests per second. The rate is halved whenever
+	// the API responds 429 and recovers gradually afterwards. Zero means
+	// unlimited.
+	RateLimit float64
+
+	// RetryBudget caps the retries of failed requests over a whole scan.
+	// Once it's spent, failures aren't retried until the next scan. Zero
+	// means unlimited.
+	RetryBudget int
+	retries     *retryBudget
+	// SearchAttempts is how many times a search is tried in all when the
+	// API fails with a 429, a 5xx or a network error, backing off between
+	// attempts.
+	SearchAttempts int
+	// HTTPTimeout bounds each API request, from connecting to reading the
+	// last of the response, so a hung connection fails the search instead
+	// of stalling the scan. Zero waits forever.
+	HTTPTimeout time.Duration
+
+	// RetryNonJSON retries a search once when the API answers it with
+	// something other than JSON, such as an HTML error page sent with a 200.
+	RetryNonJSON bool
+
+	// RetrySearches retries each failed search once at the end of a scan,
+	// those of zips with the highest ZipPriority first, as long as the
+	// retry budget lasts. Zips not in ZipPriority have priority 0.
+	RetrySearches bool
+	ZipPriority   map[string]int
+
+	// CrawlDelay is the least time between the start of two API requests,
+	// across the whole scan. The API can ask for more with a Crawl-Delay
+	// header.
+	CrawlDelay time.Duration
+
+	// Workers is how many zips are searched at once. The rate limits and
+	// MaxHTTPRequests still apply across all of them.
+	Workers int
+
+	// MaxHTTPRequests caps how many HTTP requests may be in flight at once
+	// across the whole process, API searches and notifiers together. Zero
+	// means no cap.
+	MaxHTTPRequests int
+
+	// WarmConnections opens this many connections to the API before the
+	// first scan, and keeps them alive between requests, so the scan
+	// doesn't start with a burst of connection setups.
+	WarmConnections int
+
+	// InsecureSkipVerify turns off TLS certificate verification on API
+	// requests, for testing against a mock API with a self-signed
+	// certificate. Notifiers and the link shortener still verify theirs.
+	InsecureSkipVerify bool
+
+	// transport is what every HTTP client but the API's is built on. See
+	// baseTransport.
+	transport http.RoundTripper
+	// apiTransport is what the API client is built on. See
+	// apiBaseTransport.
+	apiTransport http.RoundTripper
+	// ctx is the context of the run cfg is for, which ends the waits its
+	// notifiers make between messages when it's cancelled. Nil waits them
+	// out.
+	ctx context.Context
+	// log logs the run's messages with its log settings.
+	log *logger
+
+	// Probe issues one known-good search at startup, warning if the API
+	// no longer answers the way the scan expects. It's an extra search
+	// every run, so it's off unless asked for.
+	Probe bool
+
+	// SimulateAvailability, when set, searches nothing and instead makes up
+	// a site at each of the first SimulateAvailability zips, labelled as
+	// simulated, to exercise notifying without the API.
+	SimulateAvailability int
+	// DryRun searches as usual, but prints the messages that would be sent
+	// to stdout instead of sending them, and saves no state, cursor or dead
+	// letters, so the next real run is unaffected.
+	DryRun bool
+	// FromDateOffset searches for appointments from this many days after
+	// today.
+	FromDateOffset int
+	// FromDate, in DateFormat, searches for appointments from that date
+	// instead of today.
+	FromDate string
+	// DaysAhead searches every zip from each of this many days, starting
+	// with the from date, and tells when each site is available from.
+	DaysAhead int
+
+	// StateFile is where already-notified sites are remembered between
+	// runs. Sites are only notified again once DedupWindow has passed, or
+	// when NotifyHoursChanges is set and their hours change. It defaults
+	// to a file in the user's cache directory; empty disables it.
+	StateFile          string
+	DedupWindow        time.Duration
+	NotifyHoursChanges bool
+	// MinSiteInterval is the least time between two notifications of the
+	// same site, through any notifier and for any reason, hours changes
+	// included.
+	MinSiteInterval time.Duration
+	// ReplyClosed replies to a site's tweet once a full scan no longer
+	// finds it, saying it's stopped showing availability.
+	ReplyClosed bool
+
+	// StateMaxAge and StateMaxSites bound the state file: sites last
+	// notified longer than StateMaxAge ago are forgotten, then the oldest
+	// are, down to StateMaxSites. Zero keeps them all.
+	StateMaxAge   time.Duration
+	StateMaxSites int
+
+	// NotifyIneligible notifies the sites in responses the API marks as
+	// not eligible, which normally means the eligibility profile is off
+	// and the sites aren't taking people like us.
+	NotifyIneligible bool
+
+	// MinWeeklyHours drops sites open for less than this in total over a
+	// week, as summed from their OpenHours. Zero keeps every site.
+	MinWeeklyHours time.Duration
+
+	// MaxPerZip keeps only the nearest MaxPerZip sites of each search. Zero
+	// keeps them all.
+	MaxPerZip int
+	// MaxTweets caps the sites announced by a scan, keeping the nearest.
+	// The rest are held back for a later scan. Zero announces them all.
+	MaxTweets int
+	// MaxDistanceMeters drops sites further than this from the zip they
+	// were searched from, and those of unknown distance. Zero keeps them
+	// all.
+	MaxDistanceMeters float64
+
+	// ExcludeTypes are site types that are never notified, e.g. placeholder
+	// entries that don't have real availability. Matching ignores case.
+	ExcludeTypes []string
+	// ExcludeSites matches, ignoring case, the names and addresses of test
+	// and placeholder sites, which are never notified. Nil keeps them all.
+	ExcludeSites *regexp.Regexp
+	// VaccineProducts, when set, keeps only the sites whose vaccineData
+	// lists one of these products, matched ignoring case against part of
+	// each entry. Sites that list no products are kept.
+	VaccineProducts []string
+
+	// VerifyBeforeTweet searches again at each site's own coordinates
+	// right before announcing it, and drops sites that are no longer
+	// listed.
+	VerifyBeforeTweet bool
+
+	// ExportGeoJSON is a path to write the sites found to as GeoJSON.
+	ExportGeoJSON string
+	// ExportHTML is a path to write an HTML page listing the sites found
+	// to, e.g. for a community website to serve.
+	ExportHTML string
+	// ExportJSON and ExportCSV are paths to write the sites found to as
+	// JSON and CSV. Every export is independent of the others, and of
+	// notifying.
+	ExportJSON string
+	ExportCSV  string
+	// ExportSort orders the sites in the JSON, CSV and GeoJSON exports: by
+	// "distance", "name" or "type", ties broken by name and then ID, so
+	// exports of the same sites are identical. The HTML page is always
+	// sorted by name, for people to scan.
+	ExportSort string
+	// ExportOnly only exports the sites found, notifying no one, so no
+	// notifier needs configuring.
+	ExportOnly bool
+
+	// CountyFile is a JSON file mapping zips to counties. With
+	// TweetByCounty, sites are tweeted as one summary per county instead of
+	// one tweet each.
+	CountyFile    string
+	TweetByCounty bool
+
+	// HistoryFile, when set, gets a JSON line appended after every scan
+	// counting the sites found, in total and by county. It's moved aside
+	// to HistoryFile.1 once it's grown to HistoryMaxSize bytes.
+	HistoryFile    string
+	HistoryMaxSize int64
+
+	// AlertThreshold, when set, replaces a tweet per site with a summary
+	// tweet whenever the number of sites open within AlertRadius miles of
+	// one of the AlertAreas zips reaches AlertThreshold.
+	AlertThreshold int
+	AlertAreas     []string
+	AlertRadius    float64
+
+	// APIHeaders are added to every API request, in case the API starts
+	// requiring authentication. One set empty is left out of requests.
+	// BrowserHeaders fills in the ones the web UI sends that aren't set.
+	APIHeaders     http.Header
+	BrowserHeaders bool
+
+	// OutputDir, when set, gets a directory per run named for its start
+	// time, holding the run summary and the sites notified. Only the newest
+	// OutputRetention runs are kept; zero keeps them all.
+	OutputDir       string
+	OutputRetention int
+
+	// Debug turns on debug logs, and additionally saves each raw API
+	// response to the run's output directory.
+	Debug bool
+
+	// StaleDataAfter is how old the newest zip record can be before we warn
+	// that the data may be out of date. Zero disables the warning.
+	StaleDataAfter time.Duration
+
+	// Quiet only logs errors, for cron jobs that should stay silent unless
+	// something goes wrong.
+	Quiet bool
+	// LogLevel is the least severe level logged, debug, info, warn or
+	// error, overriding Debug and Quiet's. Empty leaves it to them.
+	LogLevel string
+	// LogJSON writes log messages as JSON lines, with their context in
+	// fields of their own, instead of text.
+	LogJSON bool
+	// LogSyslog sends log messages to the local syslog daemon, under
+	// SyslogFacility and SyslogTag, instead of stderr. Where there's no
+	// syslog they stay on stderr.
+	LogSyslog      bool
+	SyslogFacility string
+	SyslogTag      string
+	// Progress draws a progress bar of each scan when stdout is a
+	// terminal. It's off when Quiet is set.
+	Progress bool
+
+	// MastodonVisibility is the visibility of toots, e.g. public or
+	// unlisted. MastodonLimit is the instance's character limit.
+	MastodonVisibility string
+	MastodonLimit      int
+
+	// DistanceUnit is the unit distances are shown in, mi or km, rounded to
+	// DistancePrecision decimal places.
+	DistanceUnit      string
+	DistancePrecision int
+
+	// CoordinatePrecision rounds the coordinates sent to the API to this
+	// many decimal places, so nearby searches look the same to caches.
+	// Negative sends them as they are.
+	CoordinatePrecision int
+	// GridPrecision searches only one zip of each cell of a grid of
+	// coordinates rounded to this many decimal places. Negative searches
+	// every zip.
+	GridPrecision int
+
+	// Profiles are the eligibility profiles searched with. Every zip is
+	// searched once per profile, and each site is tagged with the profiles
+	// it was found for.
+	Profiles []*Profile
+
+	// Interval, when set, keeps the process running as a daemon, scanning
+	// every Interval. Once overrides it, forcing a single scan.
+	Interval time.Duration
+	Once     bool
+
+	// ScanDeadline bounds how long a scan may run. Zips still unsearched
+	// when it passes are skipped, and the sites already found notified.
+	// Zero means no deadline.
+	ScanDeadline time.Duration
+
+	// SliceSize, when set, scans only this many zips each run, starting
+	// where the last one stopped as kept in CursorFile and wrapping around,
+	// so runs too short for a full scan still cover every zip in turn.
+	SliceSize  int
+	CursorFile string
+
+	// StartupJitter, when set, delays the first scan by a random duration
+	// of up to this long, so instances started together don't all search
+	// at once. JitterDaemonOnly skips it for single scans and runs from a
+	// terminal.
+	StartupJitter    time.Duration
+	JitterDaemonOnly bool
+
+	// FailErrorRate, when set, makes a single scan exit nonzero if at least
+	// this fraction of its searches failed, telling an API outage apart
+	// from a scan that found nothing.
+	FailErrorRate float64
+
+	// LockFile, when set, is a lease shared between replicas, so that only
+	// the one holding it scans and notifies. It's renewed before each scan
+	// and every third of LockTTL during one, and a lease not renewed
+	// within LockTTL is taken over.
+	LockFile string
+	LockTTL  time.Duration
+
+	// WatchdogRuns is how many scans in a row may find nothing in daemon
+	// mode before the maintainers are alerted at WatchdogWebhook. Zero
+	// disables the watchdog.
+	WatchdogRuns    int
+	WatchdogWebhook string
+
+	// DeadLetterFile, when set, is where messages that failed to send are
+	// appended as JSON lines. ReplayDeadLetters retries them at the start
+	// of each scan's notifications.
+	DeadLetterFile    string
+	ReplayDeadLetters bool
+
+	// CPUProfile and MemProfile are files to write pprof CPU and heap
+	// profiles of a single scan to. PprofAddr serves net/http/pprof on
+	// that address instead, for profiling a daemon while it runs.
+	CPUProfile string
+	MemProfile string
+	PprofAddr  string
+
+	// DataFile is the file of zip records to scan, opendatasoft's US zip
+	// code export. Empty scans the California extract built into the
+	// binary.
+	DataFile string
+	// StreamData decodes the data file record by record while scanning,
+	// instead of loading it all up front, to bound memory on big inputs.
+	// Options that need every record first can't be used with it.
+	StreamData bool
+	// PrepWorkers is how many goroutines decoding and filtering the data
+	// file are spread over, which speeds up loading big ones. The records
+	// keep their order either way.
+	PrepWorkers int
+	// DataFormat is the format of the data file: FormatJSON, FormatNDJSON
+	// or FormatAuto to detect it.
+	DataFormat string
+	// DataFields maps the fields of records to where they are in a data
+	// file shaped differently from the bundled one. Nil decodes the
+	// bundled shape, strictly.
+	DataFields fieldMap
+
+	// NotifyConcurrency is how many messages each notifier, by name, may
+	// send at once. Notifiers not listed, Twitter included, send one at a
+	// time so their order is kept.
+	NotifyConcurrency map[string]int
+	// NotifyBuffer is how many messages each notifier may have rendered
+	// ahead of those it's sending. Once that many are waiting, rendering
+	// pauses until it catches up, and so does the scan, which only carries
+	// on once they're all sent. Zero renders each message as it's sent.
+	NotifyBuffer int
+
+	// TweetInterval is the least time between tweets, to stay under
+	// Twitter's rate limits when many sites are found at once.
+	TweetInterval time.Duration
+	// TweetAttempts is how many times a tweet is tried in all while
+	// Twitter answers that the rate limit is exceeded.
+	TweetAttempts int
+
+	// QuietHours are the daily spans each notifier, by name, doesn't send
+	// in, in QuietTimezone. Messages due in them are dropped, leaving
+	// realtime sites to be announced by a later scan if they're still
+	// available, or with QuietQueue queued as dead letters for the first
+	// replay after the span ends.
+	QuietHours    map[string]*quietHours
+	QuietTimezone string
+	QuietQueue    bool
+
+	// APIURLs are the API endpoints searches are sent to, in order of
+	// preference. A search that fails at one is tried at the next, and the
+	// failed endpoint is passed over for EndpointDownFor.
+	APIURLs   []string
+	endpoints *endpoints
+	// APIProfile is a JSON file of API specifics, endpoints, headers and
+	// eligibility survey answers, overriding the compiled in ones. Options
+	// given explicitly still win.
+	APIProfile string
+
+	// Notifiers names the notifiers to send through. Empty means every
+	// notifier that's configured in the environment.
+	Notifiers []string
+
+	// DigestAt, when set, switches a daemon from announcing sites as
+	// they're found to posting one digest of every site seen each day at
+	// this "HH:MM" time in DigestTimezone.
+	DigestAt       string
+	DigestTimezone string
+	// ThreadFile, when set, keeps the ID of the last digest tweet, which
+	// the next digest replies to so a daemon's digests form one thread.
+	ThreadFile string
+	// Thread posts the sites a scan finds as one thread, a lead tweet
+	// counting them with a reply per site, rather than a tweet each.
+	Thread bool
+	// DistanceBands, when set, announce sites by their distance from the
+	// Near zip: each band's sites as they're found, in the digest, or not
+	// at all. Only the digest bands' sites wait for DigestAt.
+	DistanceBands []*distanceBand
+}
+
+const (
+	EnvPopulationFile       = "POPULATION_FILE"
+	EnvMapsLink             = "MAPS_LINK"
+	EnvNearestCity          = "NEAREST_CITY"
+	EnvGeoTag               = "GEO_TAG"
+	EnvMessagePrefix        = "MESSAGE_PREFIX"
+	EnvRoundMinutes         = "ROUND_MINUTES"
+	EnvMessageSuffix        = "MESSAGE_SUFFIX"
+	EnvMessageTimestamp     = "MESSAGE_TIMESTAMP"
+	EnvMarkNew              = "MARK_NEW"
+	EnvAppendTimestamp      = "APPEND_TIMESTAMP"
+	EnvShortenerURL         = "SHORTENER_URL"
+	EnvShortenerToken       = "SHORTENER_TOKEN"
+	EnvShuffle              = "SHUFFLE"
+	EnvShuffleSeed          = "SHUFFLE_SEED"
+	EnvCoordinates          = "COORDINATES"
+	EnvStdin                = "STDIN"
+	EnvFailedZipsFile       = "FAILED_ZIPS_FILE"
+	EnvRetryFailed          = "RETRY_FAILED"
+	EnvNear                 = "NEAR"
+	EnvCenter               = "CENTER"
+	EnvCities               = "CITIES"
+	EnvRadius               = "RADIUS"
+	EnvRateLimit            = "RATE_LIMIT"
+	EnvRetryBudget          = "RETRY_BUDGET"
+	EnvSearchAttempts       = "SEARCH_ATTEMPTS"
+	EnvHTTPTimeout          = "HTTP_TIMEOUT"
+	EnvRetryNonJSON         = "RETRY_NON_JSON"
+	EnvRetrySearches        = "RETRY_SEARCHES"
+	EnvZipPriority          = "ZIP_PRIORITY"
+	EnvCrawlDelay           = "CRAWL_DELAY"
+	EnvMaxHTTPRequests      = "MAX_HTTP_REQUESTS"
+	EnvWorkers              = "WORKER_COUNT"
+	EnvWarmConnections      = "WARM_CONNECTIONS"
+	EnvInsecureSkipVerify   = "INSECURE_SKIP_VERIFY"
+	EnvProbe                = "PROBE"
+	EnvSimulateAvailability = "SIMULATE_AVAILABILITY"
+	EnvDryRun               = "DRY_RUN"
+	EnvFromDateOffset       = "FROM_DATE_OFFSET"
+	EnvFromDate             = "FROM_DATE"
+	EnvDaysAhead            = "DAYS_AHEAD"
+	EnvStateFile            = "STATE_FILE"
+	EnvDedupWindow          = "DEDUP_WINDOW"
+	EnvStateMaxAge          = "STATE_MAX_AGE"
+	EnvStateMaxSites        = "STATE_MAX_SITES"
+	EnvNotifyHoursChanges   = "NOTIFY_HOURS_CHANGES"
+	EnvReplyClosed          = "REPLY_CLOSED"
+	EnvMinSiteInterval      = "MIN_SITE_INTERVAL"
+	EnvNotifyIneligible     = "NOTIFY_INELIGIBLE"
+	EnvMinWeeklyHours       = "MIN_WEEKLY_HOURS"
+	EnvExcludeTypes         = "EXCLUDE_TYPES"
+	EnvExcludeSites         = "EXCLUDE_SITES"
+	EnvVaccineProduct       = "VACCINE_PRODUCT"
+	EnvMaxPerZip            = "MAX_PER_ZIP"
+	EnvMaxTweets            = "MAX_TWEETS"
+	EnvMaxDistanceMeters    = "MAX_DISTANCE_METERS"
+	EnvVerifyBeforeTweet    = "VERIFY_BEFORE_TWEET"
+	EnvExportGeoJSON        = "EXPORT_GEOJSON"
+	EnvExportHTML           = "EXPORT_HTML"
+	EnvExportJSON           = "EXPORT_JSON"
+	EnvExportCSV            = "EXPORT_CSV"
+	EnvExportSort           = "EXPORT_SORT"
+	EnvExportOnly           = "EXPORT_ONLY"
+	EnvCountyFile           = "COUNTY_FILE"
+	EnvHistoryFile          = "HISTORY_FILE"
+	EnvHistoryMaxSize       = "HISTORY_MAX_SIZE"
+	EnvTweetByCounty        = "TWEET_BY_COUNTY"
+	EnvAlertThreshold       = "ALERT_THRESHOLD"
+	EnvAlertAreas           = "ALERT_AREAS"
+	EnvAlertRadius          = "ALERT_RADIUS"
+	EnvAPIHeaders           = "API_HEADERS"
+	EnvBrowserHeaders       = "BROWSER_HEADERS"
+	EnvAPIToken             = "API_TOKEN"
+	EnvOutputDir            = "OUTPUT_DIR"
+	EnvOutputRetention      = "OUTPUT_RETENTION"
+	EnvDebug                = "DEBUG"
+	EnvStaleDataAfter       = "STALE_DATA_AFTER"
+	EnvQuiet                = "QUIET"
+	EnvLogLevel             = "LOG_LEVEL"
+	EnvLogJSON              = "LOG_JSON"
+	EnvLogSyslog            = "LOG_SYSLOG"
+	EnvSyslogFacility       = "SYSLOG_FACILITY"
+	EnvSyslogTag            = "SYSLOG_TAG"
+	EnvProgress             = "PROGRESS"
+	EnvMastodonVisibility   = "MASTODON_VISIBILITY"
+	EnvMastodonLimit        = "MASTODON_LIMIT"
+	EnvDistanceUnit         = "DISTANCE_UNIT"
+	EnvDistancePrecision    = "DISTANCE_PRECISION"
+	EnvCoordinatePrecision  = "COORDINATE_PRECISION"
+	EnvGridPrecision        = "GRID_PRECISION"
+	EnvVaccineProfile       = "VACCINE_PROFILE"
+	EnvVaccineData          = "VACCINE_DATA"
+	EnvInterval             = "SCAN_INTERVAL"
+	EnvScanDeadline         = "SCAN_DEADLINE"
+	EnvSliceSize            = "SLICE_SIZE"
+	EnvCursorFile           = "CURSOR_FILE"
+	EnvStartupJitter        = "STARTUP_JITTER"
+	EnvJitterDaemonOnly     = "JITTER_DAEMON_ONLY"
+	EnvFailErrorRate        = "FAIL_ERROR_RATE"
+	EnvOnce                 = "ONCE"
+	EnvLockFile             = "LOCK_FILE"
+	EnvLockTTL              = "LOCK_TTL"
+	EnvWatchdogRuns         = "WATCHDOG_RUNS"
+	EnvWatchdogWebhook      = "WATCHDOG_WEBHOOK"
+	EnvDeadLetterFile       = "DEAD_LETTER_FILE"
+	EnvReplayDeadLetters    = "REPLAY_DEAD_LETTERS"
+	EnvCPUProfile           = "CPU_PROFILE"
+	EnvMemProfile           = "MEM_PROFILE"
+	EnvPprofAddr            = "PPROF_ADDR"
+	EnvStreamData           = "STREAM_DATA"
+	EnvPrepWorkers          = "PREP_WORKERS"
+	EnvDataFormat           = "DATA_FORMAT"
+	EnvDataFile             = "DATA_FILE"
+	EnvDataFields           = "DATA_FIELDS"
+	EnvNotifyConcurrency    = "NOTIFY_CONCURRENCY"
+	EnvNotifyBuffer         = "NOTIFY_BUFFER"
+	EnvTweetInterval        = "TWEET_INTERVAL"
+	EnvTweetAttempts        = "TWEET_ATTEMPTS"
+	EnvQuietHours           = "QUIET_HOURS"
+	EnvQuietTimezone        = "QUIET_TIMEZONE"
+	EnvQuietQueue           = "QUIET_QUEUE"
+	EnvNotifiers            = "NOTIFIERS"
+	EnvAPIURLs              = "API_URLS"
+	EnvAPIProfile           = "API_PROFILE"
+	EnvDigestAt             = "DIGEST_AT"
+	EnvDigestTimezone       = "DIGEST_TIMEZONE"
+	EnvThreadFile           = "THREAD_FILE"
+	EnvThread               = "THREAD"
+	EnvDistanceBands        = "DISTANCE_BANDS"
+)
+
+// flagEnv maps flag names to the environment variable used as a fallback
+// when the flag isn't given on the command line.
+var flagEnv = map[string]string{
+	"population-file":       EnvPopulationFile,
+	"maps-link":             EnvMapsLink,
+	"nearest-city":          EnvNearestCity,
+	"geo-tag":               EnvGeoTag,
+	"message-prefix":        EnvMessagePrefix,
+	"round-minutes":         EnvRoundMinutes,
+	"message-suffix":        EnvMessageSuffix,
+	"message-timestamp":     EnvMessageTimestamp,
+	"mark-new":              EnvMarkNew,
+	"append-timestamp":      EnvAppendTimestamp,
+	"shortener-url":         EnvShortenerURL,
+	"shortener-token":       EnvShortenerToken,
+	"shuffle":               EnvShuffle,
+	"shuffle-seed":          EnvShuffleSeed,
+	"coordinates":           EnvCoordinates,
+	"stdin":                 EnvStdin,
+	"failed-zips-file":      EnvFailedZipsFile,
+	"retry-failed":          EnvRetryFailed,
+	"near":                  EnvNear,
+	"center":                EnvCenter,
+	"cities":                EnvCities,
+	"radius":                EnvRadius,
+	"rate-limit":            EnvRateLimit,
+	"retry-budget":          EnvRetryBudget,
+	"search-attempts":       EnvSearchAttempts,
+	"http-timeout":          EnvHTTPTimeout,
+	"retry-non-json":        EnvRetryNonJSON,
+	"retry-searches":        EnvRetrySearches,
+	"zip-priority":          EnvZipPriority,
+	"crawl-delay":           EnvCrawlDelay,
+	"max-http-requests":     EnvMaxHTTPRequests,
+	"workers":               EnvWorkers,
+	"warm-connections":      EnvWarmConnections,
+	"insecure-skip-verify":  EnvInsecureSkipVerify,
+	"probe":                 EnvProbe,
+	"simulate-availability": EnvSimulateAvailability,
+	"dry-run":               EnvDryRun,
+	"from-date-offset":      EnvFromDateOffset,
+	"from-date":             EnvFromDate,
+	"days-ahead":            EnvDaysAhead,
+	"state-file":            EnvStateFile,
+	"dedup-window":          EnvDedupWindow,
+	"state-max-age":         EnvStateMaxAge,
+	"state-max-sites":       EnvStateMaxSites,
+	"notify-hours-changes":  EnvNotifyHoursChanges,
+	"reply-closed":          EnvReplyClosed,
+	"min-site-interval":     EnvMinSiteInterval,
+	"notify-ineligible":     EnvNotifyIneligible,
+	"min-weekly-hours":      EnvMinWeeklyHours,
+	"exclude-types":         EnvExcludeTypes,
+	"exclude-sites":         EnvExcludeSites,
+	"vaccine-product":       EnvVaccineProduct,
+	"max-per-zip":           EnvMaxPerZip,
+	"max-tweets":            EnvMaxTweets,
+	"max-distance-meters":   EnvMaxDistanceMeters,
+	"verify-before-tweet":   EnvVerifyBeforeTweet,
+	"export-geojson":        EnvExportGeoJSON,
+	"export-html":           EnvExportHTML,
+	"export-json":           EnvExportJSON,
+	"export-csv":            EnvExportCSV,
+	"export-sort":           EnvExportSort,
+	"export-only":           EnvExportOnly,
+	"county-file":           EnvCountyFile,
+	"history-file":          EnvHistoryFile,
+	"history-max-size":      EnvHistoryMaxSize,
+	"tweet-by-county":       EnvTweetByCounty,
+	"alert-threshold":       EnvAlertThreshold,
+	"alert-areas":           EnvAlertAreas,
+	"alert-radius":          EnvAlertRadius,
+	"api-headers":           EnvAPIHeaders,
+	"browser-headers":       EnvBrowserHeaders,
+	"api-token":             EnvAPIToken,
+	"output-dir":            EnvOutputDir,
+	"output-retention":      EnvOutputRetention,
+	"debug":                 EnvDebug,
+	"stale-data-after":      EnvStaleDataAfter,
+	"quiet":                 EnvQuiet,
+	"log-level":             EnvLogLevel,
+	"log-json":              EnvLogJSON,
+	"log-syslog":            EnvLogSyslog,
+	"syslog-facility":       EnvSyslogFacility,
+	"syslog-tag":            EnvSyslogTag,
+	"progress":              EnvProgress,
+	"mastodon-visibility":   EnvMastodonVisibility,
+	"mastodon-limit":        EnvMastodonLimit,
+	"distance-unit":         EnvDistanceUnit,
+	"distance-precision":    EnvDistancePrecision,
+	"coordinate-precision":  EnvCoordinatePrecision,
+	"grid-precision":        EnvGridPrecision,
+	"vaccine-profile":       EnvVaccineProfile,
+	"vaccine-data":          EnvVaccineData,
+	"interval":              EnvInterval,
+	"scan-deadline":         EnvScanDeadline,
+	"slice-size":            EnvSliceSize,
+	"cursor-file":           EnvCursorFile,
+	"startup-jitter":        EnvStartupJitter,
+	"jitter-daemon-only":    EnvJitterDaemonOnly,
+	"fail-error-rate":       EnvFailErrorRate,
+	"once":                  EnvOnce,
+	"lock-file":             EnvLockFile,
+	"lock-ttl":              EnvLockTTL,
+	"watchdog-runs":         EnvWatchdogRuns,
+	"watchdog-webhook":      EnvWatchdogWebhook,
+	"dead-letter-file":      EnvDeadLetterFile,
+	"replay-dead-letters":   EnvReplayDeadLetters,
+	"cpu-profile":           EnvCPUProfile,
+	"mem-profile":           EnvMemProfile,
+	"pprof-addr":            EnvPprofAddr,
+	"stream-data":           EnvStreamData,
+	"prep-workers":          EnvPrepWorkers,
+	"data-format":           EnvDataFormat,
+	"data-file":             EnvDataFile,
+	"data-fields":           EnvDataFields,
+	"notify-concurrency":    EnvNotifyConcurrency,
+	"notify-buffer":         EnvNotifyBuffer,
+	"tweet-interval":        EnvTweetInterval,
+	"tweet-attempts":        EnvTweetAttempts,
+	"quiet-hours":           EnvQuietHours,
+	"quiet-timezone":        EnvQuietTimezone,
+	"quiet-queue":           EnvQuietQueue,
+	"notifiers":             EnvNotifiers,
+	"api-urls":              EnvAPIURLs,
+	"api-profile":           EnvAPIProfile,
+	"digest-at":             EnvDigestAt,
+	"digest-timezone":       EnvDigestTimezone,
+	"thread-file":           EnvThreadFile,
+	"thread":                EnvThread,
+	"distance-bands":        EnvDistanceBands,
+}
+
+// DefaultConfig returns a Config with every setting at its default, as
+// LoadConfig would with no flags or environment variables set, ready to
+// adjust and pass to Run.
+func DefaultConfig() *Config {
+	var cfg, err = parseConfig(nil, false)
+	if err != nil {
+		panic("invalid default config: " + err.Error())
+	}
+	return cfg
+}
+
+// LoadConfig builds the run Config from the command line arguments, falling
+// back to environment variables for anything not set by a flag.
+func LoadConfig(args []string) (*Config, error) {
+	return parseConfig(args, true)
+}
+
+// parseConfig builds a Config from args, and from environment variables
+// for anything not set by a flag if env is set.
+func parseConfig(args []string, env bool) (*Config, error) {
+	var cfg = &Config{Now: time.Now}
+
+	var fs = flag.NewFlagSet(Program, flag.ContinueOnError)
+	fs.StringVar(&cfg.PopulationFile, "population-file", "", "JSON file mapping zip to population, used to scan dense areas first")
+	fs.BoolVar(&cfg.MapsLink, "maps-link", false, "include a Google Maps link to each site in tweets")
+	fs.BoolVar(&cfg.NearestCity, "nearest-city", false, "name the major city each site is nearest to in messages and exports")
+	fs.BoolVar(&cfg.GeoTag, "geo-tag", false, "geo-tag each site's tweet with its coordinates; needs geo-tagging enabled on the account")
+	fs.IntVar(&cfg.RoundMinutes, "round-minutes", 0, "round the hours shown in messages to every N minutes, e.g. 5; 0 shows them exactly")
+	fs.StringVar(&cfg.MessagePrefix, "message-prefix", "", "text to put before each site's message")
+	fs.StringVar(&cfg.MessageSuffix, "message-suffix", "", "text to put after each site's message, e.g. \"Book ASAP, appointments go fast\"")
+	fs.BoolVar(&cfg.MessageTimestamp, "message-timestamp", false, "add an \"As of\" time to each site's message")
+	fs.BoolVar(&cfg.MarkNew, "mark-new", false, "mark sites first found today in messages and exports; needs -state-file")
+	fs.BoolVar(&cfg.AppendTimestamp, "append-timestamp", false, "end each message with the time, e.g. \"· 3:42PM\", so repeats aren't rejected as duplicates")
+	fs.StringVar(&cfg.ShortenerURL, "shortener-url", "", "Bitly-compatible endpoint to shorten the signup link with, e.g. "+BitlyShortenURL)
+	fs.StringVar(&cfg.ShortenerToken, "shortener-token", "", "bearer token for -shortener-url")
+	fs.BoolVar(&cfg.Shuffle, "shuffle", false, "scan zips in a random order")
+	fs.Int64Var(&cfg.ShuffleSeed, "shuffle-seed", 0, "seed for -shuffle; 0 picks one from the clock")
+
+	var headers, token string
+	fs.StringVar(&headers, "api-headers", "", "comma separated Key=Value headers added to API requests; an empty value leaves the header out")
+	fs.BoolVar(&cfg.BrowserHeaders, "browser-headers", false, "send API requests with the headers a browser using the web UI does")
+	fs.StringVar(&token, "api-token", "", "bearer token sent as the Authorization header on API requests")
+
+	fs.StringVar(&cfg.OutputDir, "output-dir", "", "write a timestamped directory of artifacts for each run here")
+	fs.IntVar(&cfg.OutputRetention, "output-retention", 0, "number of run directories to keep in -output-dir; 0 keeps all")
+	fs.BoolVar(&cfg.Debug, "debug", false, "log debug messages and save raw API responses to the run's output directory")
+
+	fs.DurationVar(&cfg.StaleDataAfter, "stale-data-after", 365*24*time.Hour, "warn if the newest zip record is older than this; 0 disables")
+
+	fs.BoolVar(&cfg.Quiet, "quiet", false, "only log errors")
+	fs.StringVar(&cfg.LogLevel, "log-level", "", "least severe level logged: debug, info, warn or error; overrides -debug and -quiet")
+	fs.BoolVar(&cfg.LogJSON, "log-json", false, "log JSON lines instead of text")
+	fs.BoolVar(&cfg.LogSyslog, "log-syslog", false, "log to the local syslog daemon instead of stderr")
+	fs.StringVar(&cfg.SyslogFacility, "syslog-facility", "daemon", "syslog facility for -log-syslog: kern, user, daemon or local0 to local7")
+	fs.StringVar(&cfg.SyslogTag, "syslog-tag", Program, "syslog tag for -log-syslog")
+	fs.BoolVar(&cfg.Progress, "progress", false, "show a progress bar of each scan when stdout is a terminal")
+
+	fs.StringVar(&cfg.MastodonVisibility, "mastodon-visibility", "public", "visibility of Mastodon posts: public, unlisted, private or direct")
+	fs.IntVar(&cfg.MastodonLimit, "mastodon-limit", 500, "character limit of the Mastodon instance")
+
+	fs.StringVar(&cfg.DistanceUnit, "distance-unit", UnitMiles, "unit distances are shown in: mi or km")
+	fs.IntVar(&cfg.DistancePrecision, "distance-precision", 1, "decimal places distances are rounded to")
+	fs.IntVar(&cfg.CoordinatePrecision, "coordinate-precision", -1, "decimal places coordinates sent to the API are rounded to; negative doesn't round")
+	fs.IntVar(&cfg.GridPrecision, "grid-precision", -1, "search one zip per grid cell of coordinates rounded to this many decimal places; negative searches every zip")
+
+	fs.DurationVar(&cfg.Interval, "interval", 0, "keep running, scanning every interval; 0 scans once and exits")
+	fs.BoolVar(&cfg.Once, "once", false, "scan once and exit, even if -interval or SCAN_INTERVAL is set")
+	fs.StringVar(&cfg.LockFile, "lock-file", "", "lease file shared between replicas, so only its holder scans")
+	fs.DurationVar(&cfg.LockTTL, "lock-ttl", 30*time.Minute, "how long a lease lasts without being renewed before another replica takes it over")
+	fs.DurationVar(&cfg.ScanDeadline, "scan-deadline", 0, "abandon the zips left after a scan has run this long and notify what was found; 0 disables")
+	fs.IntVar(&cfg.SliceSize, "slice-size", 0, "scan only this many zips per run, resuming from -cursor-file; 0 scans them all")
+	fs.StringVar(&cfg.CursorFile, "cursor-file", "", "file keeping where the last -slice-size scan stopped")
+	fs.DurationVar(&cfg.StartupJitter, "startup-jitter", 0, "wait a random duration of up to this long before the first scan; 0 disables")
+	fs.BoolVar(&cfg.JitterDaemonOnly, "jitter-daemon-only", false, "skip -startup-jitter for single scans and runs from a terminal")
+	fs.Float64Var(&cfg.FailErrorRate, "fail-error-rate", 0, "exit nonzero after a scan if at least this fraction of its searches failed, e.g. 0.9; 0 disables")
+	fs.IntVar(&cfg.WatchdogRuns, "watchdog-runs", 0, "alert -watchdog-webhook after this many scans in a row find nothing; 0 disables")
+	fs.StringVar(&cfg.WatchdogWebhook, "watchdog-webhook", "", "maintainer webhook URL for watchdog alerts")
+	fs.StringVar(&cfg.DeadLetterFile, "dead-letter-file", "", "append messages that failed to send to this file as JSON lines")
+	fs.BoolVar(&cfg.ReplayDeadLetters, "replay-dead-letters", false, "retry the messages in -dead-letter-file before sending new ones")
+
+	fs.StringVar(&cfg.CPUProfile, "cpu-profile", "", "write a CPU profile of the scan to this file")
+	fs.StringVar(&cfg.MemProfile, "mem-profile", "", "write a heap profile to this file after the scan")
+	fs.StringVar(&cfg.PprofAddr, "pprof-addr", "", "serve net/http/pprof on this address, e.g. localhost:6060")
+
+	fs.BoolVar(&cfg.StreamData, "stream-data", false, "decode the data file while scanning instead of loading it up front")
+	fs.IntVar(&cfg.PrepWorkers, "prep-workers", 1, "goroutines to decode and filter the data file across")
+	fs.StringVar(&cfg.DataFile, "data-file", "", "file of zip records to scan; the bundled California extract if empty")
+	fs.StringVar(&cfg.DataFormat, "data-format", FormatAuto, "format of the data file: json, ndjson or auto to detect it")
+	var dataFields string
+	fs.StringVar(&dataFields, "data-fields", "", "comma separated field=path pairs locating record fields in a differently shaped data file, e.g. zip=postal_code")
+
+	fs.StringVar(&cfg.DigestAt, "digest-at", "", "in daemon mode, post a daily digest at this HH:MM instead of announcing sites as they're found")
+	fs.StringVar(&cfg.DigestTimezone, "digest-timezone", "America/Los_Angeles", "timezone for -digest-at")
+	fs.StringVar(&cfg.ThreadFile, "thread-file", "", "file keeping the last digest tweet's ID, so each digest replies to the one before")
+	fs.BoolVar(&cfg.Thread, "thread", false, "tweet the sites a scan finds as a thread, replying to a lead tweet, instead of a tweet each")
+	var distanceBands string
+	fs.StringVar(&distanceBands, "distance-bands", "", "comma separated miles=policy bands from -near, e.g. 10=immediate,50=digest; policies are immediate, digest and ignore")
+
+	var concurrency string
+	fs.StringVar(&concurrency, "notify-concurrency", "", "comma separated name=N messages each notifier may send at once, e.g. mastodon=4")
+	fs.IntVar(&cfg.NotifyBuffer, "notify-buffer", 0, "messages each notifier may have rendered ahead of sending them before rendering waits for it")
+	fs.DurationVar(&cfg.TweetInterval, "tweet-interval", 0, "least time between tweets, e.g. 30s")
+	fs.IntVar(&cfg.TweetAttempts, "tweet-attempts", NotifyAttempts, "times to try a tweet while Twitter's rate limit is exceeded before giving up on it")
+	var quiet string
+	fs.StringVar(&quiet, "quiet-hours", "", "comma separated name=HH:MM-HH:MM spans each notifier doesn't send in, e.g. webhook=22:00-07:00")
+	fs.StringVar(&cfg.QuietTimezone, "quiet-timezone", "America/Los_Angeles", "timezone for -quiet-hours")
+	fs.BoolVar(&cfg.QuietQueue, "quiet-queue", false, "queue messages due in quiet hours as dead letters instead of dropping them")
+	var apiURLs string
+	fs.StringVar(&apiURLs, "api-urls", URL, "comma separated API endpoints to search, tried in order when one fails")
+	fs.StringVar(&cfg.APIProfile, "api-profile", "", "JSON file of API endpoints, headers and eligibility answers overriding the built in ones")
+	var notifiers string
+	fs.StringVar(&notifiers, "notifiers", "", "comma separated notifiers to send through, e.g. twitter,mastodon; defaults to every one configured")
+
+	var profile string
+	fs.StringVar(&profile, "vaccine-profile", DefaultProfile, "comma separated eligibility profiles to search for; see list-eligibility")
+	var vaccineData string
+	fs.StringVar(&vaccineData, "vaccine-data", "", "base64 vaccineData to search with instead of an eligibility profile, as sent by the web UI")
+
+	var coordinates string
+	fs.StringVar(&coordinates, "coordinates", "", "search a single lat,long point and print the results")
+	fs.StringVar(&cfg.FailedZipsFile, "failed-zips-file", "", "write the zips whose search failed to this file after each scan")
+	fs.StringVar(&cfg.RetryFailed, "retry-failed", "", "only search the zips in this file, as written by -failed-zips-file")
+	fs.BoolVar(&cfg.Stdin, "stdin", false, "search the lat,long points read from stdin, one per line, instead of the data file's zips")
+	fs.StringVar(&cfg.Near, "near", "", "only scan zips within -radius miles of this zip")
+	var center string
+	fs.StringVar(&center, "center", "", "only scan zips within -radius miles of this lat,long point")
+	fs.Float64Var(&cfg.Radius, "radius", 0, "distance in miles from -near or -center to scan")
+	var cities string
+	fs.StringVar(&cities, "cities", "", "comma separated cities to only scan the zips of, e.g. Oakland,San Jose")
+	fs.Float64Var(&cfg.RateLimit, "rate-limit", 0, "maximum API requests per second, backing off on 429s; 0 for unlimited")
+	fs.IntVar(&cfg.RetryBudget, "retry-budget", 0, "most retries of failed requests in a scan, across all of them; 0 for unlimited")
+	fs.IntVar(&cfg.SearchAttempts, "search-attempts", 3, "times to try a search that fails with a 429, 5xx or network error before giving up on it")
+	fs.DurationVar(&cfg.HTTPTimeout, "http-timeout", 15*time.Second, "most time an API request can take; 0 for no limit")
+	fs.BoolVar(&cfg.RetryNonJSON, "retry-non-json", false, "retry a search once when the API answers it with something other than JSON")
+	fs.BoolVar(&cfg.RetrySearches, "retry-searches", false, "retry each failed search once at the end of the scan, highest -zip-priority first")
+	var zipPriority string
+	fs.StringVar(&zipPriority, "zip-priority", "", "comma separated zip=N priorities for -retry-searches; other zips have priority 0")
+	fs.DurationVar(&cfg.CrawlDelay, "crawl-delay", 0, "least time between the start of two API requests, e.g. 500ms")
+	fs.IntVar(&cfg.MaxHTTPRequests, "max-http-requests", 0, "maximum HTTP requests in flight at once, across the API and every notifier; 0 for unlimited")
+	fs.IntVar(&cfg.Workers, "workers", 1, "zips to search at once")
+	fs.IntVar(&cfg.WarmConnections, "warm-connections", 0, "connections to open to the API before the first scan and keep alive")
+	fs.BoolVar(&cfg.InsecureSkipVerify, "insecure-skip-verify", false, "don't verify the API's TLS certificate, for testing against a self-signed mock; never use in production")
+	fs.BoolVar(&cfg.Probe, "probe", false, "check the API still answers as expected with one search at startup")
+	fs.IntVar(&cfg.SimulateAvailability, "simulate-availability", 0, "don't search the API, but make up a labelled site at each of the first N zips, for demos")
+	fs.BoolVar(&cfg.DryRun, "dry-run", false, "print the messages that would be sent instead of sending them, and save no state")
+	fs.IntVar(&cfg.FromDateOffset, "from-date-offset", 0, "search for appointments from this many days after today")
+	fs.StringVar(&cfg.FromDate, "from-date", "", "search for appointments from this date, YYYY-MM-DD, instead of today")
+	fs.IntVar(&cfg.DaysAhead, "days-ahead", 1, "search from each of this many days, starting with the from date, reporting the earliest each site is available from")
+	fs.StringVar(&cfg.StateFile, "state-file", defaultStateFile(), "file remembering notified sites between runs; empty to keep none")
+	fs.DurationVar(&cfg.DedupWindow, "dedup-window", 6*time.Hour, "how long before a notified site is announced again")
+	fs.DurationVar(&cfg.StateMaxAge, "state-max-age", 0, "forget sites in the state file last notified longer ago than this; 0 keeps them")
+	fs.IntVar(&cfg.StateMaxSites, "state-max-sites", 0, "most sites kept in the state file, forgetting the oldest; 0 for unlimited")
+	fs.BoolVar(&cfg.NotifyHoursChanges, "notify-hours-changes", false, "announce known sites again when their hours change")
+	fs.BoolVar(&cfg.ReplyClosed, "reply-closed", false, "reply to a site's tweet once it's no longer found; needs -state-file")
+	fs.DurationVar(&cfg.MinSiteInterval, "min-site-interval", 0, "least time between two notifications of a site, hours changes included; 0 for none")
+	fs.BoolVar(&cfg.NotifyIneligible, "notify-ineligible", false, "notify sites from responses the API marks as not eligible")
+	fs.DurationVar(&cfg.MinWeeklyHours, "min-weekly-hours", 0, "skip sites open for less than this in total a week, e.g. 4h; 0 keeps all")
+	fs.IntVar(&cfg.MaxPerZip, "max-per-zip", 0, "keep only the nearest N sites each zip's search finds; 0 keeps all")
+	fs.IntVar(&cfg.MaxTweets, "max-tweets", 0, "announce only the nearest N new sites a scan finds, leaving the rest for later scans; 0 announces all")
+	fs.Float64Var(&cfg.MaxDistanceMeters, "max-distance-meters", 0, "drop sites further than this many meters from the zip searched; 0 keeps all")
+	var excludeTypes string
+	fs.StringVar(&excludeTypes, "exclude-types", "", "comma separated site types never to notify")
+	var excludeSites string
+	fs.StringVar(&excludeSites, "exclude-sites", DefaultExcludeSites, "regexp matching, ignoring case, the names and addresses of test sites never to notify; empty keeps them")
+	var products string
+	fs.StringVar(&products, "vaccine-product", "", "comma separated vaccine products, only sites listing one of which are notified")
+	fs.BoolVar(&cfg.VerifyBeforeTweet, "verify-before-tweet", false, "search again at each site right before announcing it, skipping sites no longer listed")
+	fs.StringVar(&cfg.ExportGeoJSON, "export-geojson", "", "write the sites found to this file as GeoJSON")
+	fs.StringVar(&cfg.ExportHTML, "export-html", "", "write an HTML page listing the sites found to this file")
+	fs.StringVar(&cfg.ExportJSON, "export-json", "", "write the sites found to this file as JSON")
+	fs.StringVar(&cfg.ExportCSV, "export-csv", "", "write the sites found to this file as CSV")
+	fs.StringVar(&cfg.ExportSort, "export-sort", "distance", "order of the sites in exports: distance, name or type")
+	fs.BoolVar(&cfg.ExportOnly, "export-only", false, "only export the sites found, without notifying or needing a notifier")
+	fs.StringVar(&cfg.CountyFile, "county-file", "", "JSON file mapping zip to county")
+	fs.BoolVar(&cfg.TweetByCounty, "tweet-by-county", false, "tweet one summary per county instead of one tweet per site; needs -county-file")
+	fs.StringVar(&cfg.HistoryFile, "history-file", "", "append a JSON line counting the sites found, in total and by county, to this file after every scan")
+	fs.Int64Var(&cfg.HistoryMaxSize, "history-max-size", 10<<20, "bytes -history-file grows to before it's rotated to a .1 file; 0 never rotates")
+	fs.IntVar(&cfg.AlertThreshold, "alert-threshold", 0, "only tweet a summary when this many sites are open near one of -alert-areas; 0 tweets every site")
+	var alertAreas string
+	fs.StringVar(&alertAreas, "alert-areas", "", "comma separated zips -alert-threshold counts sites around")
+	fs.Float64Var(&cfg.AlertRadius, "alert-radius", 10, "radius in miles around each of -alert-areas")
+
+	var err = fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if env {
+		err = applyEnv(fs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if coordinates != "" {
+		cfg.Coordinates, err = parseCoordinates(coordinates)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if center != "" {
+		cfg.Center, err = parseCoordinates(center)
+		if err != nil {
+			return nil, errors.New("invalid -center: " + err.Error())
+		}
+	}
+	for _, c := range strings.Split(cities, ",") {
+		c = strings.TrimSpace(c)
+		if c != "" {
+			cfg.Cities = append(cfg.Cities, c)
+		}
+	}
+
+	// The API profile only fills in what wasn't given explicitly, which
+	// applyEnv has marked as set by now.
+	var set = make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	var api = &apiProfile{}
+	if cfg.APIProfile != "" {
+		api, err = loadAPIProfile(cfg.APIProfile)
+		if err != nil {
+			return nil, err
+		}
+		if len(api.URLs) > 0 && !set["api-urls"] {
+			apiURLs = strings.Join(api.URLs, ",")
+		}
+	}
+
+	if vaccineData != "" {
+		if set["vaccine-profile"] {
+			return nil, errors.New("-vaccine-data can't be combined with -vaccine-profile")
+		}
+		cfg.Profiles = []*Profile{{Name: CustomProfile, VaccineData: vaccineData}}
+	} else {
+		cfg.Profiles, err = parseProfiles(profile, api.eligibility())
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = cfg.decodeProfiles()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.NotifyConcurrency, err = parseConcurrency(concurrency)
+	if err != nil {
+		return nil, err
+	}
+	if quiet != "" {
+		var zone *time.Location
+		zone, err = time.LoadLocation(cfg.QuietTimezone)
+		if err != nil {
+			return nil, errors.New("invalid -quiet-timezone " + cfg.QuietTimezone)
+		}
+		cfg.QuietHours, err = parseQuietHours(quiet, zone)
+		if err != nil {
+			return nil, err
+		}
+	}
+	cfg.ZipPriority, err = parseZipPriority(zipPriority)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.ZipPriority) > 0 && !cfg.RetrySearches {
+		return nil, errors.New("-zip-priority needs -retry-searches")
+	}
+	for _, name := range strings.Split(notifiers, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			cfg.Notifiers = append(cfg.Notifiers, name)
+		}
+	}
+
+	for _, p := range strings.Split(products, ",") {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			cfg.VaccineProducts = append(cfg.VaccineProducts, p)
+		}
+	}
+	for _, t := range strings.Split(excludeTypes, ",") {
+		t = strings.TrimSpace(t)
+		if t != "" {
+			cfg.ExcludeTypes = append(cfg.ExcludeTypes, t)
+		}
+	}
+	if excludeSites != "" {
+		cfg.ExcludeSites, err = regexp.Compile("(?i)" + excludeSites)
+		if err != nil {
+			return nil, errors.New("invalid -exclude-sites: " + err.Error())
+		}
+	}
+	for _, zip := range strings.Split(alertAreas, ",") {
+		zip = strings.TrimSpace(zip)
+		if zip != "" {
+			cfg.AlertAreas = append(cfg.AlertAreas, zip)
+		}
+	}
+	for _, u := range strings.Split(apiURLs, ",") {
+		u = strings.TrimSpace(u)
+		if u != "" {
+			cfg.APIURLs = append(cfg.APIURLs, u)
+		}
+	}
+	if len(cfg.APIURLs) == 0 {
+		return nil, errors.New("-api-urls needs at least one endpoint")
+	}
+
+	cfg.APIHeaders, err = parseHeaders(headers)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		cfg.APIHeaders.Set("Authorization", "Bearer "+token)
+	}
+	api.addHeaders(cfg.APIHeaders)
+	if cfg.BrowserHeaders {
+		addMissingHeaders(cfg.APIHeaders, browserHeaders)
+	}
+
+	if cfg.Near != "" && cfg.Center != nil {
+		return nil, errors.New("-near can't be combined with -center")
+	}
+	if (cfg.Near == "" && cfg.Center == nil) != (cfg.Radius == 0) {
+		return nil, errors.New("-near or -center and -radius must be set together")
+	}
+	if cfg.Radius < 0 {
+		return nil, errors.New("-radius must be positive")
+	}
+	switch cfg.MastodonVisibility {
+	case "public", "unlisted", "private", "direct":
+	default:
+		return nil, errors.New("invalid -mastodon-visibility " + cfg.MastodonVisibility)
+	}
+	if cfg.MastodonLimit <= 0 {
+		return nil, errors.New("-mastodon-limit must be positive")
+	}
+
+	if cfg.DistanceUnit != UnitMiles && cfg.DistanceUnit != UnitKilometers {
+		return nil, errors.New("invalid -distance-unit " + cfg.DistanceUnit)
+	}
+	if cfg.DistancePrecision < 0 {
+		return nil, errors.New("-distance-precision must be positive")
+	}
+
+	if cfg.DataFormat != FormatAuto && cfg.DataFormat != FormatJSON && cfg.DataFormat != FormatNDJSON {
+		return nil, errors.New("-data-format must be auto, json or ndjson")
+	}
+	if dataFields != "" {
+		cfg.DataFields, err = parseFieldMap(dataFields)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.RetryFailed != "" && (cfg.StreamData || cfg.Stdin) {
+		return nil, errors.New("-retry-failed can't be combined with -stream-data or -stdin")
+	}
+	if cfg.Stdin && (cfg.StreamData || cfg.Coordinates != nil || cfg.Near != "" || cfg.Center != nil || len(cfg.Cities) > 0 || cfg.Shuffle || cfg.PopulationFile != "" || cfg.CountyFile != "" || cfg.AlertThreshold > 0) {
+		return nil, errors.New("-stdin can't be combined with -stream-data, -coordinates, -near, -center, -cities, -shuffle, -population-file, -county-file or -alert-threshold")
+	}
+	if cfg.StreamData && (cfg.Near != "" || cfg.Center != nil || len(cfg.Cities) > 0 || cfg.Shuffle || cfg.PopulationFile != "" || cfg.CountyFile != "" || cfg.AlertThreshold > 0) {
+		return nil, errors.New("-stream-data can't be combined with -near, -center, -cities, -shuffle, -population-file, -county-file or -alert-threshold")
+	}
+	if cfg.GridPrecision >= 0 && (cfg.StreamData || cfg.Stdin) {
+		return nil, errors.New("-grid-precision can't be combined with -stream-data or -stdin")
+	}
+
+	if cfg.MaxPerZip < 0 {
+		return nil, errors.New("-max-per-zip must be positive")
+	}
+	if cfg.NotifyBuffer < 0 {
+		return nil, errors.New("-notify-buffer must be positive")
+	}
+	if cfg.MaxTweets < 0 {
+		return nil, errors.New("-max-tweets must be positive")
+	}
+	if cfg.MaxDistanceMeters < 0 {
+		return nil, errors.New("-max-distance-meters must be positive")
+	}
+	if cfg.MinWeeklyHours < 0 {
+		return nil, errors.New("-min-weekly-hours must be positive")
+	}
+	if cfg.FailErrorRate < 0 || cfg.FailErrorRate > 1 {
+		return nil, errors.New("-fail-error-rate must be between 0 and 1")
+	}
+	if cfg.PrepWorkers < 1 {
+		return nil, errors.New("-prep-workers must be at least 1")
+	}
+	if cfg.HistoryMaxSize < 0 {
+		return nil, errors.New("-history-max-size must be positive")
+	}
+	if cfg.ScanDeadline < 0 {
+		return nil, errors.New("-scan-deadline must be positive")
+	}
+	if cfg.SliceSize < 0 {
+		return nil, errors.New("-slice-size must be positive")
+	}
+	if (cfg.SliceSize > 0) != (cfg.CursorFile != "") {
+		return nil, errors.New("-slice-size and -cursor-file must be set together")
+	}
+	if cfg.SliceSize > 0 && cfg.ReplyClosed {
+		return nil, errors.New("-reply-closed can't be combined with -slice-size")
+	}
+	if cfg.SliceSize > 0 && cfg.StreamData {
+		return nil, errors.New("-slice-size can't be combined with -stream-data")
+	}
+	// The cursor only covers every zip if each run orders them the same.
+	if cfg.SliceSize > 0 && cfg.Shuffle && cfg.ShuffleSeed == 0 {
+		return nil, errors.New("-slice-size with -shuffle needs -shuffle-seed")
+	}
+	if cfg.StartupJitter < 0 {
+		return nil, errors.New("-startup-jitter must be positive")
+	}
+	if cfg.JitterDaemonOnly && cfg.StartupJitter == 0 {
+		return nil, errors.New("-jitter-daemon-only needs -startup-jitter")
+	}
+	if cfg.Interval < 0 {
+		return nil, errors.New("-interval must be positive")
+	}
+	if cfg.LockTTL <= 0 {
+		return nil, errors.New("-lock-ttl must be positive")
+	}
+	cfg.DistanceBands, err = parseDistanceBands(distanceBands)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.DistanceBands) > 0 && cfg.Near == "" {
+		return nil, errors.New("-distance-bands needs -near")
+	}
+	if hasBandPolicy(cfg.DistanceBands, BandDigest) && cfg.DigestAt == "" {
+		return nil, errors.New("-distance-bands with a digest band needs -digest-at")
+	}
+	if len(cfg.DistanceBands) > 0 && cfg.AlertThreshold > 0 {
+		return nil, errors.New("-distance-bands can't be combined with -alert-threshold")
+	}
+	if cfg.ThreadFile != "" && cfg.DigestAt == "" {
+		return nil, errors.New("-thread-file needs -digest-at")
+	}
+	if cfg.DigestAt != "" && (cfg.Once || cfg.Interval == 0) {
+		return nil, errors.New("-digest-at needs daemon mode, see -interval")
+	}
+	if cfg.AlertThreshold < 0 {
+		return nil, errors.New("-alert-threshold must be positive")
+	}
+	if cfg.AlertThreshold > 0 && len(cfg.AlertAreas) == 0 {
+		return nil, errors.New("-alert-threshold needs -alert-areas")
+	}
+	if cfg.AlertThreshold > 0 && cfg.DigestAt != "" {
+		return nil, errors.New("-alert-threshold can't be combined with -digest-at")
+	}
+	if cfg.AlertRadius <= 0 {
+		return nil, errors.New("-alert-radius must be positive")
+	}
+	if cfg.WatchdogRuns < 0 {
+		return nil, errors.New("-watchdog-runs must be positive")
+	}
+	if cfg.WatchdogRuns > 0 && cfg.WatchdogWebhook == "" {
+		return nil, errors.New("-watchdog-runs needs -watchdog-webhook")
+	}
+	if cfg.MinSiteInterval < 0 {
+		return nil, errors.New("-min-site-interval must be positive")
+	}
+	if cfg.MinSiteInterval > 0 && cfg.StateFile == "" {
+		return nil, errors.New("-min-site-interval needs -state-file")
+	}
+	if cfg.MarkNew && cfg.StateFile == "" {
+		return nil, errors.New("-mark-new needs -state-file")
+	}
+	if cfg.ReplyClosed && cfg.StateFile == "" {
+		return nil, errors.New("-reply-closed needs -state-file")
+	}
+	if cfg.StateMaxAge < 0 {
+		return nil, errors.New("-state-max-age must be positive")
+	}
+	// Forgetting a site inside the dedup window would announce it again.
+	if cfg.StateMaxAge > 0 && (cfg.StateMaxAge < cfg.DedupWindow || cfg.StateMaxAge < cfg.MinSiteInterval) {
+		return nil, errors.New("-state-max-age must be at least -dedup-window and -min-site-interval")
+	}
+	if cfg.StateMaxSites < 0 {
+		return nil, errors.New("-state-max-sites must be positive")
+	}
+	if cfg.ReplayDeadLetters && cfg.DeadLetterFile == "" {
+		return nil, errors.New("-replay-dead-letters needs -dead-letter-file")
+	}
+	if cfg.QuietQueue && len(cfg.QuietHours) == 0 {
+		return nil, errors.New("-quiet-queue needs -quiet-hours")
+	}
+	if cfg.QuietQueue && !cfg.ReplayDeadLetters {
+		return nil, errors.New("-quiet-queue needs -replay-dead-letters, to send the queued messages")
+	}
+
+	// The prefix and suffix always make it into messages, so they have to
+	// leave room for the site.
+	if utf8.RuneCountInString(cfg.MessagePrefix+cfg.MessageSuffix) > MaxMessageExtra {
+		return nil, errors.New("-message-prefix and -message-suffix must be at most " + strconv.Itoa(MaxMessageExtra) + " characters together")
+	}
+
+	if cfg.RoundMinutes < 0 || cfg.RoundMinutes > 60 {
+		return nil, errors.New("-round-minutes must be between 0 and 60")
+	}
+	if cfg.SimulateAvailability < 0 {
+		return nil, errors.New("-simulate-availability must be positive")
+	}
+	if cfg.Workers < 1 {
+		return nil, errors.New("-workers must be at least 1")
+	}
+	if cfg.MaxHTTPRequests < 0 {
+		return nil, errors.New("-max-http-requests must be positive")
+	}
+	if cfg.WarmConnections < 0 {
+		return nil, errors.New("-warm-connections must be positive")
+	}
+
+	if _, ok := exportOrders[cfg.ExportSort]; !ok {
+		return nil, errors.New("-export-sort must be distance, name or type")
+	}
+
+	if cfg.OutputRetention < 0 {
+		return nil, errors.New("-output-retention must be positive")
+	}
+	if cfg.RateLimit < 0 {
+		return nil, errors.New("-rate-limit must be positive")
+	}
+	if cfg.CrawlDelay < 0 {
+		return nil, errors.New("-crawl-delay must be positive")
+	}
+	if cfg.LogLevel != "" {
+		_, err = parseLevel(cfg.LogLevel)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.FromDateOffset < 0 {
+		return nil, errors.New("-from-date-offset must be positive")
+	}
+	if cfg.FromDate != "" {
+		if cfg.FromDateOffset != 0 {
+			return nil, errors.New("-from-date can't be combined with -from-date-offset")
+		}
+		_, err = time.Parse(DateFormat, cfg.FromDate)
+		if err != nil {
+			return nil, errors.New("-from-date must be a date like 2021-04-15")
+		}
+	}
+	if cfg.DaysAhead < 1 {
+		return nil, errors.New("-days-ahead must be at least 1")
+	}
+	if cfg.DryRun && (cfg.ReplyClosed || cfg.ReplayDeadLetters) {
+		return nil, errors.New("-dry-run can't be combined with -reply-closed or -replay-dead-letters")
+	}
+	if cfg.ExportOnly {
+		if cfg.ExportJSON == "" && cfg.ExportCSV == "" && cfg.ExportGeoJSON == "" && cfg.ExportHTML == "" {
+			return nil, errors.New("-export-only needs -export-json, -export-csv, -export-geojson or -export-html")
+		}
+		if cfg.DryRun || cfg.ReplyClosed || cfg.ReplayDeadLetters {
+			return nil, errors.New("-export-only can't be combined with -dry-run, -reply-closed or -replay-dead-letters")
+		}
+	}
+	if cfg.LogJSON && cfg.LogSyslog {
+		return nil, errors.New("-log-json can't be combined with -log-syslog")
+	}
+	if cfg.HTTPTimeout < 0 {
+		return nil, errors.New("-http-timeout must be positive")
+	}
+	if cfg.SearchAttempts < 1 {
+		return nil, errors.New("-search-attempts must be at least 1")
+	}
+	if cfg.TweetInterval < 0 {
+		return nil, errors.New("-tweet-interval must be positive")
+	}
+	if cfg.TweetAttempts < 1 {
+		return nil, errors.New("-tweet-attempts must be at least 1")
+	}
+	if cfg.RetryBudget < 0 {
+		return nil, errors.New("-retry-budget must be positive")
+	}
+
+	cfg.derive()
+	return cfg, nil
+}
+
+// derive sets up what cfg's settings imply but aren't settings themselves:
+// the logger, the API endpoints, the HTTP transport, the link shortener
+// and the retry budget. Now defaults to time.Now. It's safe to call again,
+// starting them afresh.
+func (cfg *Config) derive() {
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	cfg.log = newLogger(cfg)
+	cfg.endpoints = nil
+	if len(cfg.APIURLs) > 0 {
+		cfg.endpoints = newEndpoints(cfg.APIURLs, cfg.Now)
+	}
+
+	cfg.transport = http.DefaultTransport
+	if cfg.WarmConnections > 0 {
+		var t = http.DefaultTransport.(*http.Transport).Clone()
+		// The default transport only keeps 2 idle connections per host,
+		// and would close the rest of the warmed ones.
+		t.MaxIdleConnsPerHost = cfg.WarmConnections
+		cfg.transport = t
+	}
+	cfg.apiTransport = cfg.transport
+	if cfg.InsecureSkipVerify {
+		var t = cfg.transport.(*http.Transport).Clone()
+		t.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		cfg.apiTransport = t
+	}
+	if cfg.MaxHTTPRequests > 0 {
+		// The API's requests count towards the same cap as the rest.
+		var l = newConcurrencyLimiter(cfg.transport, cfg.MaxHTTPRequests)
+		cfg.transport = l
+		cfg.apiTransport = &concurrencyLimiter{next: cfg.apiTransport, sem: l.sem}
+		if !cfg.InsecureSkipVerify {
+			cfg.apiTransport = l
+		}
+	}
+	cfg.shortener = nil
+	if cfg.ShortenerURL != "" {
+		cfg.shortener = newShortener(baseTransport(cfg), cfg.ShortenerURL, cfg.ShortenerToken, cfg.log)
+	}
+
+	cfg.retries = nil
+	if cfg.RetryBudget > 0 {
+		cfg.retries = newRetryBudget(cfg.RetryBudget, cfg.log)
+	}
+}
+
+// parseHeaders parses comma separated Key=Value pairs into a header.
+func parseHeaders(s string) (http.Header, error) {
+	var h = make(http.Header)
+	for _, kv := range strings.Split(s, ",") {
+		if strings.TrimSpace(kv) == "" {
+			continue
+		}
+		var parts = strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, errors.New("invalid header " + kv + ", expected Key=Value")
+		}
+		h.Add(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	}
+	return h, nil
+}
+
+// parseConcurrency parses comma separated name=N pairs.
+func parseConcurrency(s string) (map[string]int, error) {
+	var out = make(map[string]int)
+	for _, kv := range strings.Split(s, ",") {
+		if strings.TrimSpace(kv) == "" {
+			continue
+		}
+		var parts = strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.New("invalid notify concurrency " + kv + ", expected name=N")
+		}
+		var n, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || n < 1 {
+			return nil, errors.New("invalid notify concurrency " + kv + ", N must be a positive number")
+		}
+		out[strings.TrimSpace(parts[0])] = n
+	}
+	return out, nil
+}
+
+// parseZipPriority parses comma separated zip=N pairs.
+func parseZipPriority(s string) (map[string]int, error) {
+	var out = make(map[string]int)
+	for _, kv := range strings.Split(s, ",") {
+		if strings.TrimSpace(kv) == "" {
+			continue
+		}
+		var parts = strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.New("invalid zip priority " + kv + ", expected zip=N")
+		}
+		var n, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, errors.New("invalid zip priority " + kv + ", N must be a number")
+		}
+		out[strings.TrimSpace(parts[0])] = n
+	}
+	return out, nil
+}
+
+// applyEnv sets every flag that wasn't given on the command line from its
+// environment variable, if that is set.
+func applyEnv(fs *flag.FlagSet) error {
+	var set = make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		var env, ok = flagEnv[f.Name]
+		if !ok || set[f.Name] || err != nil {
+			return
+		}
+
+		var v string
+		v, ok = os.LookupEnv(env)
+		if !ok {
+			return
+		}
+
+		var setErr = fs.Set(f.Name, v)
+		if setErr != nil {
+			err = errors.New("invalid value for env variable " + env + ": " + setErr.Error())
+		}
+	})
+
+	return err
+}
@@ -0,0 +1,114 @@
+package alerts
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// setenv sets the environment variable key to v for the rest of the test.
+func setenv(t *testing.T, key, v string) {
+	var old, had = os.LookupEnv(key)
+	os.Setenv(key, v)
+	t.Cleanup(func() {
+		if had {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+// unsetenv unsets the environment variable key for the rest of the test.
+func unsetenv(t *testing.T, key string) {
+	var old, had = os.LookupEnv(key)
+	os.Unsetenv(key)
+	t.Cleanup(func() {
+		if had {
+			os.Setenv(key, old)
+		}
+	})
+}
+
+func TestStateFileDefault(t *testing.T) {
+	var cache = t.TempDir()
+	setenv(t, "XDG_CACHE_HOME", cache)
+	setenv(t, "HOME", cache)
+	unsetenv(t, EnvStateFile)
+	var def = defaultStateFile()
+	if runtime.GOOS == "linux" && def != filepath.Join(cache, Program, "state.json") {
+		t.Fatalf("defaultStateFile() = %q, want it in %s", def, cache)
+	}
+	if def == "" {
+		t.Fatal("no default state file")
+	}
+
+	var cases = []struct {
+		name string
+		args []string
+		env  string
+		want string
+	}{
+		{"default", nil, "-", def},
+		{"flag", []string{"-state-file", "s.json"}, "-", "s.json"},
+		{"opted out by flag", []string{"-state-file="}, "-", ""},
+		{"opted out by env", nil, "", ""},
+		{"env", nil, "e.json", "e.json"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if c.env != "-" {
+				setenv(t, EnvStateFile, c.env)
+			}
+			var cfg, err = LoadConfig(c.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.StateFile != c.want {
+				t.Errorf("StateFile = %q, want %q", cfg.StateFile, c.want)
+			}
+		})
+	}
+}
+
+func TestStateSaveCreatesDirectory(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), Program, "state.json")
+	var s = newState()
+	var err = s.save(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = loadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVaccineDataDecodedOnce(t *testing.T) {
+	unsetenv(t, EnvVaccineData)
+	var data, _ = encodeVaccineData([]string{"a", "b"})
+	var cfg, err = LoadConfig([]string{"-vaccine-data", data, "-state-file="})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Profiles[0].answerIDs; len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("answerIDs = %v, want [a b]", got)
+	}
+
+	_, err = LoadConfig([]string{"-vaccine-data", "not base64", "-state-file="})
+	if err == nil {
+		t.Error("LoadConfig took bad vaccine data")
+	}
+
+	// A hand-built Config is checked by Run before it searches.
+	cfg = DefaultConfig()
+	cfg.StateFile = ""
+	cfg.Profiles = []*Profile{{Name: CustomProfile, VaccineData: "W10="}}
+	_, err = Run(context.Background(), *cfg)
+	if err == nil || !strings.Contains(err.Error(), "no answer IDs") {
+		t.Errorf("Run with empty vaccine data = %v", err)
+	}
+}
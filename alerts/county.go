@@ -0,0 +1,85 @@
+package alerts
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// loadCounties reads a JSON object mapping zip codes to the county they're
+// in, e.g. {"94103": "San Francisco"}.
+func loadCounties(path string) (map[string]string, error) {
+	var f, err = os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var out = make(map[string]string)
+	err = json.NewDecoder(f).Decode(&out)
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// countyIndex resolves coordinates to a county, using the county of the
+// nearest zip that has one.
+type countyIndex struct {
+	points []countyPoint
+}
+
+type countyPoint struct {
+	loc    Location
+	county string
+}
+
+// attachCounties sets the county of every record whose zip is in counties,
+// returning how many weren't. Those are left without a county, and the
+// county features fall back to their nearest zip that has one.
+func attachCounties(data []*ZipToLatLong, counties map[string]string) int {
+	var missing int
+	for _, d := range data {
+		var c, ok = counties[d.Fields.Zip]
+		if !ok || c == "" {
+			missing++
+			continue
+		}
+		d.county = c
+	}
+	return missing
+}
+
+// newCountyIndex indexes the records that have a county attached.
+func newCountyIndex(data []*ZipToLatLong) *countyIndex {
+	var idx = &countyIndex{}
+	for _, d := range data {
+		if d.county == "" {
+			continue
+		}
+		idx.points = append(idx.points, countyPoint{
+			loc:    Location{Lat: d.Fields.Latitude, Long: d.Fields.Longitude},
+			county: d.county,
+		})
+	}
+	return idx
+}
+
+// lookup returns the county for l, or "" if it can't be resolved.
+func (idx *countyIndex) lookup(l *Location) string {
+	if l == nil {
+		return ""
+	}
+
+	var county string
+	var best float64
+	for i, p := range idx.points {
+		var d = haversine(*l, p.loc)
+		if i == 0 || d < best {
+			best = d
+			county = p.county
+		}
+	}
+
+	return county
+}
@@ -0,0 +1,51 @@
+package alerts
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// loadCursor reads the index of the next zip to scan from the cursor file
+// at path. A missing or empty file starts from the first zip.
+func loadCursor(path string) (int, error) {
+	var b, err = ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var s = strings.TrimSpace(string(b))
+	if s == "" {
+		return 0, nil
+	}
+	var next int
+	next, err = strconv.Atoi(s)
+	if err != nil || next < 0 {
+		return 0, errors.New("invalid cursor " + s + " in " + path)
+	}
+	return next, nil
+}
+
+// saveCursor keeps next in the cursor file at path.
+func saveCursor(path string, next int) error {
+	return ioutil.WriteFile(path, []byte(strconv.Itoa(next)+"\n"), 0644)
+}
+
+// sliceRecords returns the n records of data from start on, wrapping
+// around to the beginning, or all of them if there aren't more than n.
+func sliceRecords(data []*ZipToLatLong, start, n int) []*ZipToLatLong {
+	if n >= len(data) {
+		return data
+	}
+	start %= len(data)
+	var out = make([]*ZipToLatLong, 0, n)
+	out = append(out, data[start:]...)
+	if len(out) > n {
+		return out[:n]
+	}
+	return append(out, data[:n-len(out)]...)
+}
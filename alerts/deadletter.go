@@ -0,0 +1,98 @@
+package alerts
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// deadLetter is a message a notifier failed to send, kept so it can be
+// retried by a later run.
+type deadLetter struct {
+	// Time is when the message was first sent, before any replays.
+	Time     time.Time `json:"time"`
+	Notifier string    `json:"notifier"`
+	Error    string    `json:"error"`
+	// Site is set when the message was a single site, which is formatted
+	// afresh on replay. Otherwise Text is the message as it was sent.
+	Site *VaccineLocation `json:"site,omitempty"`
+	Text string           `json:"text,omitempty"`
+	// Sites are the sites the message covered.
+	Sites []*VaccineLocation `json:"sites,omitempty"`
+}
+
+// newDeadLetter records that notifier failed to send n with err at t, or
+// when n was first sent if it's a replay.
+func newDeadLetter(t time.Time, notifier string, n *notification, err error) *deadLetter {
+	if !n.at.IsZero() {
+		t = n.at
+	}
+	var d = &deadLetter{
+		Time:     t,
+		Notifier: notifier,
+		Error:    err.Error(),
+		Site:     n.loc,
+		Sites:    n.sites,
+	}
+	if n.loc == nil {
+		d.Text = n.text
+	}
+	return d
+}
+
+// notification returns the message to replay d, to its notifier only. It
+// keeps the idempotency key it was first sent with.
+func (d *deadLetter) notification() *notification {
+	return &notification{loc: d.Site, text: d.Text, sites: d.Sites, only: d.Notifier, at: d.Time}
+}
+
+// loadDeadLetters reads the dead-letter file at path, one JSON object per
+// line. A missing file has no letters.
+func loadDeadLetters(path string) ([]*deadLetter, error) {
+	var f, err = os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var letters []*deadLetter
+	var d = json.NewDecoder(bufio.NewReader(f))
+	for d.More() {
+		var l = &deadLetter{}
+		err = d.Decode(l)
+		if err != nil {
+			return nil, err
+		}
+		letters = append(letters, l)
+	}
+
+	return letters, nil
+}
+
+// appendDeadLetters adds letters to the end of the dead-letter file at
+// path, creating it if needed.
+func appendDeadLetters(path string, letters []*deadLetter) error {
+	if len(letters) == 0 {
+		return nil
+	}
+
+	var f, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	var e = json.NewEncoder(f)
+	for _, l := range letters {
+		err = e.Encode(l)
+		if err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,198 @@
+package alerts
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// siteDiff is what changed between two exports of sites, as written by
+// -export-json.
+type siteDiff struct {
+	Opened  []*VaccineLocation `json:"opened"`
+	Closed  []*VaccineLocation `json:"closed"`
+	Changed []*siteChange      `json:"changed"`
+}
+
+// siteChange is a site in both exports that differs between them.
+type siteChange struct {
+	Before *VaccineLocation `json:"before"`
+	After  *VaccineLocation `json:"after"`
+	// Fields are what changed: "hours" and/or "type".
+	Fields []string `json:"fields"`
+}
+
+// runDiff runs the diff subcommand, reporting the sites opened, closed and
+// changed between two JSON exports.
+func runDiff(w io.Writer, args []string) error {
+	var fs = flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.SetOutput(w)
+	var asJSON = fs.Bool("json", false, "write the differences as JSON")
+	var err = fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return errors.New("usage: " + Program + " diff [-json] before.json after.json")
+	}
+
+	var before, after []*VaccineLocation
+	before, err = loadExport(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("loading %s: %w", fs.Arg(0), err)
+	}
+	after, err = loadExport(fs.Arg(1))
+	if err != nil {
+		return fmt.Errorf("loading %s: %w", fs.Arg(1), err)
+	}
+
+	var d = diffSites(before, after)
+	if *asJSON {
+		var e = json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		return e.Encode(d)
+	}
+	return d.write(w)
+}
+
+// loadExport reads the sites in a JSON export.
+func loadExport(path string) ([]*VaccineLocation, error) {
+	var f, err = os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var locs []*VaccineLocation
+	err = json.NewDecoder(f).Decode(&locs)
+	if err != nil {
+		return nil, err
+	}
+	return locs, nil
+}
+
+// siteKey identifies a site across exports, by ExtID or, failing that,
+// name.
+func siteKey(l *VaccineLocation) string {
+	if l.ExtID != "" {
+		return l.ExtID
+	}
+	return "name:" + string(l.Name)
+}
+
+// diffSites compares the sites in two exports. Each list in the result is
+// sorted by name.
+func diffSites(before, after []*VaccineLocation) *siteDiff {
+	var old = make(map[string]*VaccineLocation, len(before))
+	for _, l := range before {
+		old[siteKey(l)] = l
+	}
+
+	var d = &siteDiff{
+		Opened:  []*VaccineLocation{},
+		Closed:  []*VaccineLocation{},
+		Changed: []*siteChange{},
+	}
+	var seen = make(map[string]bool, len(after))
+	for _, l := range after {
+		var key = siteKey(l)
+		seen[key] = true
+
+		var prev, ok = old[key]
+		if !ok {
+			d.Opened = append(d.Opened, l)
+			continue
+		}
+
+		var fields []string
+		if hoursHash(prev.OpenHours) != hoursHash(l.OpenHours) {
+			fields = append(fields, "hours")
+		}
+		if prev.Type != l.Type {
+			fields = append(fields, "type")
+		}
+		if len(fields) > 0 {
+			d.Changed = append(d.Changed, &siteChange{Before: prev, After: l, Fields: fields})
+		}
+	}
+	for _, l := range before {
+		if !seen[siteKey(l)] {
+			d.Closed = append(d.Closed, l)
+		}
+	}
+
+	var byName = func(locs []*VaccineLocation) {
+		sort.Slice(locs, func(i, j int) bool { return locs[i].Name < locs[j].Name })
+	}
+	byName(d.Opened)
+	byName(d.Closed)
+	sort.Slice(d.Changed, func(i, j int) bool { return d.Changed[i].After.Name < d.Changed[j].After.Name })
+
+	return d
+}
+
+// write writes d as text, a section for each of opened, closed and changed
+// sites.
+func (d *siteDiff) write(w io.Writer) error {
+	if len(d.Opened)+len(d.Closed)+len(d.Changed) == 0 {
+		var _, err = fmt.Fprintln(w, "No changes.")
+		return err
+	}
+
+	var b strings.Builder
+	var section = func(title string, locs []*VaccineLocation) {
+		if len(locs) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "%s (%d):\n", title, len(locs))
+		for _, l := range locs {
+			fmt.Fprintf(&b, "  %s\n", siteLine(l))
+		}
+	}
+	section("Opened", d.Opened)
+	section("Closed", d.Closed)
+
+	if len(d.Changed) > 0 {
+		fmt.Fprintf(&b, "Changed (%d):\n", len(d.Changed))
+		for _, c := range d.Changed {
+			fmt.Fprintf(&b, "  %s\n", siteLine(c.After))
+			for _, f := range c.Fields {
+				switch f {
+				case "hours":
+					fmt.Fprintf(&b, "    hours: %s -> %s\n", joinHours(c.Before), joinHours(c.After))
+				case "type":
+					fmt.Fprintf(&b, "    type: %s -> %s\n", c.Before.Type, c.After.Type)
+				}
+			}
+		}
+	}
+
+	var _, err = io.WriteString(w, b.String())
+	return err
+}
+
+// siteLine renders l's name and address on a single line.
+func siteLine(l *VaccineLocation) string {
+	var address = normalizeAddress(l.DisplayAddress)
+	if address == "" {
+		return string(l.Name)
+	}
+	return string(l.Name) + ", " + address
+}
+
+// joinHours renders l's hours on a single line.
+func joinHours(l *VaccineLocation) string {
+	var hours []string
+	for _, h := range l.displayHours() {
+		hours = append(hours, h.String())
+	}
+	if len(hours) == 0 {
+		return "none"
+	}
+	return strings.Join(hours, "; ")
+}
@@ -0,0 +1,157 @@
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDiffSites(t *testing.T) {
+	var morning = []Hours{{Days: []string{"monday"}, LocalStart: "09:00:00", LocalEnd: "12:00:00"}}
+	var allDay = []Hours{{Days: []string{"monday"}, LocalStart: "09:00:00", LocalEnd: "17:00:00"}}
+
+	var cases = []struct {
+		name          string
+		before, after []*VaccineLocation
+		opened        []string
+		closed        []string
+		// changed is each changed site's name and the fields that changed.
+		changed map[string][]string
+	}{
+		{"nothing", nil, nil, nil, nil, nil},
+		{"unchanged",
+			[]*VaccineLocation{{ExtID: "a", Name: "Site A", OpenHours: morning}},
+			[]*VaccineLocation{{ExtID: "a", Name: "Site A", OpenHours: morning}},
+			nil, nil, nil},
+		{"opened and closed",
+			[]*VaccineLocation{{ExtID: "a", Name: "Site A"}, {ExtID: "b", Name: "Site B"}},
+			[]*VaccineLocation{{ExtID: "c", Name: "Site C"}, {ExtID: "b", Name: "Site B"}, {ExtID: "d", Name: "Site D"}},
+			[]string{"Site C", "Site D"}, []string{"Site A"}, nil},
+		{"hours changed",
+			[]*VaccineLocation{{ExtID: "a", Name: "Site A", OpenHours: morning}},
+			[]*VaccineLocation{{ExtID: "a", Name: "Site A", OpenHours: allDay}},
+			nil, nil, map[string][]string{"Site A": {"hours"}}},
+		{"type changed",
+			[]*VaccineLocation{{ExtID: "a", Name: "Site A", Type: "Standard"}},
+			[]*VaccineLocation{{ExtID: "a", Name: "Site A", Type: "Drive Through"}},
+			nil, nil, map[string][]string{"Site A": {"type"}}},
+		{"hours and type changed",
+			[]*VaccineLocation{{ExtID: "a", Name: "Site A", Type: "Standard", OpenHours: morning}},
+			[]*VaccineLocation{{ExtID: "a", Name: "Site A", Type: "Drive Through", OpenHours: allDay}},
+			nil, nil, map[string][]string{"Site A": {"hours", "type"}}},
+		{"renamed is the same site by ExtID",
+			[]*VaccineLocation{{ExtID: "a", Name: "Site A", OpenHours: morning}},
+			[]*VaccineLocation{{ExtID: "a", Name: "Site A Clinic", OpenHours: allDay}},
+			nil, nil, map[string][]string{"Site A Clinic": {"hours"}}},
+		{"same name, new ExtID",
+			[]*VaccineLocation{{ExtID: "a", Name: "Site A"}},
+			[]*VaccineLocation{{ExtID: "z", Name: "Site A"}},
+			[]string{"Site A"}, []string{"Site A"}, nil},
+		{"matched by name without an ExtID",
+			[]*VaccineLocation{{Name: "Site A", Type: "Standard"}, {Name: "Site B"}},
+			[]*VaccineLocation{{Name: "Site A", Type: "Drive Through"}, {Name: "Site B"}},
+			nil, nil, map[string][]string{"Site A": {"type"}}},
+		{"an ExtID added is a new site",
+			[]*VaccineLocation{{Name: "Site A"}},
+			[]*VaccineLocation{{ExtID: "a", Name: "Site A"}},
+			[]string{"Site A"}, []string{"Site A"}, nil},
+	}
+	var names = func(locs []*VaccineLocation) []string {
+		var out []string
+		for _, l := range locs {
+			out = append(out, string(l.Name))
+		}
+		return out
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var d = diffSites(c.before, c.after)
+			if got := names(d.Opened); !reflect.DeepEqual(got, c.opened) {
+				t.Errorf("opened %q, want %q", got, c.opened)
+			}
+			if got := names(d.Closed); !reflect.DeepEqual(got, c.closed) {
+				t.Errorf("closed %q, want %q", got, c.closed)
+			}
+			var changed map[string][]string
+			for _, ch := range d.Changed {
+				if changed == nil {
+					changed = make(map[string][]string)
+				}
+				changed[string(ch.After.Name)] = ch.Fields
+			}
+			if !reflect.DeepEqual(changed, c.changed) {
+				t.Errorf("changed %v, want %v", changed, c.changed)
+			}
+		})
+	}
+}
+
+func TestRunDiff(t *testing.T) {
+	var dir = t.TempDir()
+	var before = filepath.Join(dir, "before.json")
+	var after = filepath.Join(dir, "after.json")
+	var write = func(path, data string) {
+		var err = ioutil.WriteFile(path, []byte(data), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(before, `[
+		{"extId": "a", "name": "Moscone Center", "type": "Standard", "openHours": [{"days": ["monday"], "localStart": "09:00:00", "localEnd": "12:00:00"}]},
+		{"extId": "b", "name": "SF General"}
+	]`)
+	write(after, `[
+		{"extId": "a", "name": "Moscone Center", "type": "Drive Through", "openHours": [{"days": ["monday"], "localStart": "09:00:00", "localEnd": "17:00:00"}]},
+		{"extId": "c", "name": "Oakland Coliseum"}
+	]`)
+
+	var out bytes.Buffer
+	var err = runDiff(&out, []string{before, after})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want = `Opened (1):
+  Oakland Coliseum
+Closed (1):
+  SF General
+Changed (1):
+  Moscone Center
+    hours: Monday - 9:00AM-12:00PM -> Monday - 9:00AM-5:00PM
+    type: Standard -> Drive Through
+`
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	err = runDiff(&out, []string{"-json", before, after})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d siteDiff
+	err = json.Unmarshal(out.Bytes(), &d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Opened) != 1 || d.Opened[0].ExtID != "c" || len(d.Closed) != 1 || d.Closed[0].ExtID != "b" ||
+		len(d.Changed) != 1 || !reflect.DeepEqual(d.Changed[0].Fields, []string{"hours", "type"}) {
+		t.Errorf("got %s, want c opened, b closed and a's hours and type changed", out.String())
+	}
+
+	out.Reset()
+	err = runDiff(&out, []string{before, before})
+	if err != nil || out.String() != "No changes.\n" {
+		t.Errorf("diffed an export with itself: %q, %v", out.String(), err)
+	}
+
+	write(after, "not json")
+	if err = runDiff(&out, []string{before, after}); err == nil {
+		t.Error("diffed an export that isn't JSON")
+	}
+	if err = runDiff(&out, []string{before}); err == nil {
+		t.Error("diffed a single export")
+	}
+}
@@ -0,0 +1,91 @@
+package alerts
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// digest collects every site seen during a day so they can be posted as a
+// single summary at a set local time, instead of as they're found.
+type digest struct {
+	hour, minute int
+	loc          *time.Location
+
+	sites map[string]*VaccineLocation
+	next  time.Time
+}
+
+// newDigest returns a digest posted daily at, in "HH:MM" form, in the
+// timezone tz.
+func newDigest(at, tz string, now time.Time) (*digest, error) {
+	var parts = strings.Split(at, ":")
+	if len(parts) != 2 {
+		return nil, errors.New("digest time must be of the form HH:MM")
+	}
+
+	var hour, err = strconv.Atoi(parts[0])
+	if err != nil || hour < 0 || hour > 23 {
+		return nil, errors.New("invalid digest hour " + parts[0])
+	}
+
+	var minute int
+	minute, err = strconv.Atoi(parts[1])
+	if err != nil || minute < 0 || minute > 59 {
+		return nil, errors.New("invalid digest minute " + parts[1])
+	}
+
+	var d = &digest{
+		hour:   hour,
+		minute: minute,
+		sites:  make(map[string]*VaccineLocation),
+	}
+	d.loc, err = time.LoadLocation(tz)
+	if err != nil {
+		return nil, err
+	}
+	d.next = d.after(now)
+
+	return d, nil
+}
+
+// after returns the first digest time after t.
+func (d *digest) after(t time.Time) time.Time {
+	t = t.In(d.loc)
+	var next = time.Date(t.Year(), t.Month(), t.Day(), d.hour, d.minute, 0, 0, d.loc)
+	if !next.After(t) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// collect adds the sites found by a scan to the digest. Once the digest time
+// has passed it returns the digest as a notification and starts over.
+func (d *digest) collect(cfg *Config, found []*VaccineLocation) []*notification {
+	for _, v := range found {
+		d.sites[siteKey(v)] = v
+	}
+
+	var now = cfg.Now()
+	if now.Before(d.next) {
+		return nil
+	}
+	d.next = d.after(now)
+
+	if len(d.sites) == 0 {
+		return nil
+	}
+
+	var sites = make([]*VaccineLocation, 0, len(d.sites))
+	for _, v := range d.sites {
+		sites = append(sites, v)
+	}
+	sort.Slice(sites, func(i, j int) bool {
+		return sites[i].Name < sites[j].Name
+	})
+	d.sites = make(map[string]*VaccineLocation)
+
+	return []*notification{{text: formatDigestTweet(cfg, sites), sites: sites, digest: true}}
+}
@@ -0,0 +1,100 @@
+package alerts
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDigestCountsSitesLikeTheScan(t *testing.T) {
+	var start = time.Date(2021, 4, 15, 8, 0, 0, 0, time.UTC)
+	var now = start
+	var cfg = &Config{Now: func() time.Time { return now }, DistanceUnit: UnitMiles}
+
+	var d, err = newDigest("09:00", "UTC", start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two sites without an ExtID, and one seen twice.
+	var found = []*VaccineLocation{
+		{Name: "Site A"},
+		{Name: "Site B"},
+		{ExtID: "c", Name: "Site C"},
+		{ExtID: "c", Name: "Site C"},
+	}
+	if out := d.collect(cfg, found); out != nil {
+		t.Fatal("digest posted before its time:", out)
+	}
+
+	now = start.Add(2 * time.Hour)
+	var out = d.collect(cfg, nil)
+	if len(out) != 1 {
+		t.Fatalf("got %d notifications, want the digest", len(out))
+	}
+	if n := len(out[0].sites); n != 3 {
+		t.Errorf("digest has %d sites, want 3", n)
+	}
+}
+
+func TestDigestSchedule(t *testing.T) {
+	var la, _ = time.LoadLocation("America/Los_Angeles")
+	// The day before spring forward, so the next digest is 23 hours on.
+	var start = time.Date(2021, 3, 13, 9, 0, 0, 0, la)
+	var now = start
+	var cfg = &Config{Now: func() time.Time { return now }, DistanceUnit: UnitMiles}
+
+	var d, err = newDigest("20:00", "America/Los_Angeles", start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var steps = []struct {
+		name  string
+		at    time.Time
+		found []*VaccineLocation
+		// want is the sites in the digest posted, if there is one.
+		want []string
+		next time.Time
+	}{
+		{"morning", start, []*VaccineLocation{{ExtID: "b", Name: "Site B"}}, nil, time.Date(2021, 3, 13, 20, 0, 0, 0, la)},
+		{"a minute early", time.Date(2021, 3, 13, 19, 59, 0, 0, la), []*VaccineLocation{{ExtID: "a", Name: "Site A"}}, nil, time.Date(2021, 3, 13, 20, 0, 0, 0, la)},
+		{"on the time", time.Date(2021, 3, 13, 20, 0, 0, 0, la), nil, []string{"Site A", "Site B"}, time.Date(2021, 3, 14, 20, 0, 0, 0, la)},
+		{"after posting", time.Date(2021, 3, 13, 20, 30, 0, 0, la), []*VaccineLocation{{ExtID: "c", Name: "Site C"}}, nil, time.Date(2021, 3, 14, 20, 0, 0, 0, la)},
+		{"across spring forward", time.Date(2021, 3, 14, 20, 5, 0, 0, la), nil, []string{"Site C"}, time.Date(2021, 3, 15, 20, 0, 0, 0, la)},
+		{"nothing found all day", time.Date(2021, 3, 15, 21, 0, 0, 0, la), nil, nil, time.Date(2021, 3, 16, 20, 0, 0, 0, la)},
+	}
+	for _, s := range steps {
+		now = s.at
+		var out = d.collect(cfg, s.found)
+		var got []string
+		if len(out) > 1 {
+			t.Fatalf("%s: got %d notifications, want at most the digest", s.name, len(out))
+		}
+		for _, n := range out {
+			if !n.digest {
+				t.Errorf("%s: posted a notification that isn't the digest", s.name)
+			}
+			for _, v := range n.sites {
+				got = append(got, string(v.Name))
+			}
+		}
+		if !reflect.DeepEqual(got, s.want) {
+			t.Errorf("%s: posted %q, want %q", s.name, got, s.want)
+		}
+		if !d.next.Equal(s.next) {
+			t.Errorf("%s: next digest at %v, want %v", s.name, d.next, s.next)
+		}
+	}
+}
+
+func TestNewDigestRejectsBadTimes(t *testing.T) {
+	for _, at := range []string{"9", "24:00", "09:60", "nine:30", "09:30:00"} {
+		if _, err := newDigest(at, "UTC", time.Now()); err == nil {
+			t.Errorf("newDigest(%q) accepted it", at)
+		}
+	}
+	if _, err := newDigest("09:30", "Not/AZone", time.Now()); err == nil {
+		t.Error("newDigest accepted an unknown timezone")
+	}
+}
@@ -0,0 +1,126 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// doctorTimeout bounds each of the doctor's network checks.
+const doctorTimeout = 30 * time.Second
+
+// verifier is a Notifier that can check its credentials without posting.
+type verifier interface {
+	Verify() error
+}
+
+// doctorCheck is a single check the doctor runs. A check that fails and
+// isn't critical is only a warning.
+type doctorCheck struct {
+	name     string
+	critical bool
+	run      func() (string, error)
+}
+
+// runDoctor runs the doctor subcommand, which checks that a scan with the
+// configuration in args, flags and environment alike, would work, printing
+// a checklist to w. It fails if any critical check does.
+func runDoctor(w io.Writer, args []string) error {
+	var cfg, err = LoadConfig(args)
+	if err != nil {
+		fmt.Fprintln(w, "FAIL config:", err)
+		return errors.New("config doesn't load")
+	}
+	fmt.Fprintln(w, "PASS config")
+
+	var failed int
+	for _, c := range doctorChecks(cfg) {
+		var detail, err = c.run()
+		switch {
+		case err == nil:
+			fmt.Fprintln(w, "PASS", c.name+":", detail)
+		case c.critical:
+			failed++
+			fmt.Fprintln(w, "FAIL", c.name+":", err)
+		default:
+			fmt.Fprintln(w, "WARN", c.name+":", err)
+		}
+	}
+
+	if failed > 0 {
+		return errors.New(strconv.Itoa(failed) + " critical checks failed")
+	}
+	return nil
+}
+
+// doctorChecks returns the checks to run for cfg, in order.
+func doctorChecks(cfg *Config) []doctorCheck {
+	var checks = []doctorCheck{
+		{"data file", true, func() (string, error) {
+			var data, skipped, err = parseJSONData(cfg.log, cfg.DataFile, cfg.DataFormat, cfg.DataFields, cfg.PrepWorkers)
+			if err != nil {
+				return "", err
+			}
+			var name = cfg.DataFile
+			if name == "" {
+				name = "the bundled data"
+			}
+			if len(data) == 0 {
+				return "", errors.New(name + " has no records")
+			}
+			if skipped > 0 {
+				return strconv.Itoa(len(data)) + " records in " + name + ", " + strconv.Itoa(skipped) + " invalid ones skipped", nil
+			}
+			return strconv.Itoa(len(data)) + " records in " + name, nil
+		}},
+		{"eligibility profiles", true, func() (string, error) {
+			var names []string
+			for _, p := range cfg.Profiles {
+				names = append(names, p.Name+" ("+strconv.Itoa(len(p.answerIDs))+" IDs)")
+			}
+			return strings.Join(names, ", "), nil
+		}},
+		{"API", true, func() (string, error) {
+			var ctx, cancel = context.WithTimeout(context.Background(), doctorTimeout)
+			defer cancel()
+			var resp, err = searchLocations(ctx, cfg, newHTTPClient(cfg), newPostData(cfg, &probeLocation, cfg.Profiles[0]))
+			if err != nil {
+				return "", err
+			}
+			err = checkContract(resp.raw)
+			if err != nil {
+				return "", err
+			}
+			return "sample search found " + strconv.Itoa(len(resp.Locations)) + " sites", nil
+		}},
+	}
+
+	var notifiers, err = newNotifiers(cfg)
+	if err != nil {
+		return append(checks, doctorCheck{"notifiers", true, func() (string, error) { return "", err }})
+	}
+	if len(notifiers) == 0 {
+		return append(checks, doctorCheck{"notifiers", true, func() (string, error) {
+			return "", errors.New("none configured, set the environment variables of at least one")
+		}})
+	}
+	for _, n := range notifiers {
+		var n = n
+		checks = append(checks, doctorCheck{n.Name(), true, func() (string, error) {
+			var v, ok = n.(verifier)
+			if !ok {
+				return "configured, can't be checked without posting", nil
+			}
+			var err = v.Verify()
+			if err != nil {
+				return "", fmt.Errorf("credentials rejected: %w", err)
+			}
+			return "credentials accepted", nil
+		}})
+	}
+	return checks
+}
@@ -0,0 +1,164 @@
+package alerts
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// DefaultProfile is the eligibility profile searched when none is chosen.
+const DefaultProfile = "70+"
+
+// CustomProfile names the profile of a vaccineData given as is.
+const CustomProfile = "custom"
+
+// eligibilityProfiles are the known answers to the web UI's eligibility
+// survey, by name. Each answer is an opaque ID; they can be found by filling
+// out the survey at https://myturn.ca.gov/ and base64 decoding the
+// vaccineData it sends.
+var eligibilityProfiles = map[string][]string{
+	// Filled out as if 70+.
+	"70+": {"a3qt00000001AdLAAU", "a3qt00000001AdMAAU", "a3qt00000001AgUAAU", "a3qt00000001AgVAAU"},
+}
+
+// Profile is an eligibility profile to search with.
+type Profile struct {
+	Name string
+	// VaccineData is the profile's survey answers, encoded as the API
+	// expects them.
+	VaccineData string
+
+	// answerIDs are the survey answer IDs VaccineData decodes to, set
+	// when the Config is checked.
+	answerIDs []string
+}
+
+// decodeProfiles decodes the VaccineData of each of cfg's profiles that
+// hasn't been yet. A bad one fails every search with a 400 that doesn't
+// say why, so it's caught before any are made.
+func (cfg *Config) decodeProfiles() error {
+	for _, p := range cfg.Profiles {
+		if p.answerIDs != nil {
+			continue
+		}
+		var ids, err = decodeVaccineData(p.VaccineData)
+		if err != nil {
+			return errors.New("eligibility profile " + p.Name + ": " + err.Error())
+		}
+		p.answerIDs = ids
+	}
+	return nil
+}
+
+// parseProfiles looks up each of a comma separated list of profile names in
+// known, dropping repeats.
+func parseProfiles(s string, known map[string][]string) ([]*Profile, error) {
+	var profiles []*Profile
+	var seen = make(map[string]bool)
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		var ids, ok = known[name]
+		if !ok {
+			return nil, errors.New("unknown eligibility profile " + name + ", see list-eligibility")
+		}
+		var data, err = encodeVaccineData(ids)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, &Profile{Name: name, VaccineData: data})
+	}
+
+	if len(profiles) == 0 {
+		return nil, errors.New("no eligibility profile given")
+	}
+	return profiles, nil
+}
+
+// encodeVaccineData builds the vaccineData sent to the API from survey
+// answer IDs, a base64 encoded JSON array.
+func encodeVaccineData(ids []string) (string, error) {
+	var b, err = json.Marshal(ids)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// decodeVaccineData decodes vaccineData back into the survey answer IDs,
+// failing unless it's base64 wrapping a non-empty JSON array of strings.
+func decodeVaccineData(data string) ([]string, error) {
+	var b, err = base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("vaccine data is not valid base64: %w", err)
+	}
+
+	var ids []string
+	err = json.Unmarshal(b, &ids)
+	if err != nil {
+		return nil, fmt.Errorf("vaccine data is not a JSON array of strings: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil, errors.New("vaccine data has no answer IDs")
+	}
+	for _, id := range ids {
+		if id == "" {
+			return nil, errors.New("vaccine data has an empty answer ID")
+		}
+	}
+
+	return ids, nil
+}
+
+// runEncodeVaccineData writes the vaccineData for the survey answer IDs of
+// args, a JSON array, so it can be given to -vaccine-data.
+func runEncodeVaccineData(w io.Writer, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: " + Program + ` encode-vaccine-data '["id", ...]'`)
+	}
+	var ids []string
+	var err = json.Unmarshal([]byte(args[0]), &ids)
+	if err != nil {
+		return fmt.Errorf("answer IDs are not a JSON array of strings: %w", err)
+	}
+	if len(ids) == 0 {
+		return errors.New("no answer IDs given")
+	}
+
+	var data string
+	data, err = encodeVaccineData(ids)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, data)
+	return nil
+}
+
+// listEligibility prints every known profile with its IDs and encoding.
+func listEligibility(w io.Writer) error {
+	var names = make([]string, 0, len(eligibilityProfiles))
+	for name := range eligibilityProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		var data, err = encodeVaccineData(eligibilityProfiles[name])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, name)
+		fmt.Fprintln(w, "  ids: ", eligibilityProfiles[name])
+		fmt.Fprintln(w, "  data:", data)
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// EndpointDownFor is how long an API endpoint that failed a search is
+// passed over for, in favour of the others.
+const EndpointDownFor = 5 * time.Minute
+
+// endpoints is a list of API endpoints to search, tried in order until one
+// answers. Failed endpoints are remembered for a while, so a dead one isn't
+// tried first on every search.
+type endpoints struct {
+	urls []string
+	now  func() time.Time
+
+	mu        sync.Mutex
+	downUntil map[string]time.Time
+}
+
+func newEndpoints(urls []string, now func() time.Time) *endpoints {
+	return &endpoints{urls: urls, now: now, downUntil: make(map[string]time.Time)}
+}
+
+// order returns the endpoints to try: those up, in the configured order,
+// then those down, as a last resort.
+func (e *endpoints) order() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var now = e.now()
+	var up, down []string
+	for _, u := range e.urls {
+		if now.Before(e.downUntil[u]) {
+			down = append(down, u)
+		} else {
+			up = append(up, u)
+		}
+	}
+	return append(up, down...)
+}
+
+func (e *endpoints) markDown(url string) {
+	e.mu.Lock()
+	e.downUntil[url] = e.now().Add(EndpointDownFor)
+	e.mu.Unlock()
+}
+
+func (e *endpoints) markUp(url string) {
+	e.mu.Lock()
+	delete(e.downUntil, url)
+	e.mu.Unlock()
+}
+
+// search issues pd to each endpoint in turn until one answers, returning
+// the last error if none do. Only endpoints that look down, failing to
+// connect or answering with a 429 or 5xx, are passed over for later
+// searches; one that answers badly is still up.
+func (e *endpoints) search(ctx context.Context, cfg *Config, client *http.Client, pd *PostData) (*Response, error) {
+	if len(e.urls) == 1 {
+		return searchEndpoint(ctx, cfg, client, e.urls[0], pd)
+	}
+
+	var resp *Response
+	var err error
+	for _, u := range e.order() {
+		resp, err = searchEndpoint(ctx, cfg, client, u, pd)
+		if err == nil {
+			e.markUp(u)
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		if !endpointDown(err) {
+			cfg.log.warn("API endpoint", u, "failed:", err)
+			continue
+		}
+		cfg.log.warn("API endpoint", u, "failed, skipping it for", EndpointDownFor.String()+":", err)
+		e.markDown(u)
+	}
+	return nil, err
+}
+
+// endpointDown reports whether a search that failed with err suggests its
+// endpoint is down, rather than that it didn't like or understand the
+// search.
+func endpointDown(err error) bool {
+	if errors.Is(err, errNotJSON) || errors.Is(err, errMalformed) {
+		return false
+	}
+	var s *statusError
+	if errors.As(err, &s) {
+		return s.code == http.StatusTooManyRequests || s.code >= http.StatusInternalServerError
+	}
+	return true
+}
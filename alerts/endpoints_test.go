@@ -0,0 +1,57 @@
+package alerts
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEndpointsMarkOnlyDownOnesDown(t *testing.T) {
+	var cases = []struct {
+		name   string
+		status int
+		body   string
+		down   bool
+	}{
+		{"bad request", http.StatusBadRequest, "", false},
+		{"not JSON", http.StatusOK, "<html>maintenance</html>", false},
+		{"malformed", http.StatusOK, `{"locations": [`, false},
+		{"rate limited", http.StatusTooManyRequests, "", true},
+		{"unavailable", http.StatusServiceUnavailable, "", true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var bad = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(c.status)
+				w.Write([]byte(c.body))
+			}))
+			defer bad.Close()
+			var good = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", JSONMimeType)
+				w.Write([]byte(`{"eligible": true, "locations": []}`))
+			}))
+			defer good.Close()
+
+			var cfg = &Config{Now: time.Now, SearchAttempts: 1}
+			var e = newEndpoints([]string{bad.URL, good.URL}, cfg.Now)
+			var resp, err = e.search(context.Background(), cfg, http.DefaultClient, &PostData{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.url != good.URL {
+				t.Errorf("answered by %s, want the second endpoint", resp.url)
+			}
+			var down = !e.downUntil[bad.URL].IsZero()
+			if down != c.down {
+				t.Errorf("first endpoint down = %v, want %v", down, c.down)
+			}
+		})
+	}
+
+	var err = &statusError{code: http.StatusBadGateway}
+	if !endpointDown(err) || !endpointDown(context.DeadlineExceeded) {
+		t.Error("gateway and transport errors should mark an endpoint down")
+	}
+}
@@ -0,0 +1,225 @@
+package alerts
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// exportOrders are the orders exports can be sorted in, by -export-sort
+// name. Each reports whether a sorts before b.
+var exportOrders = map[string]func(a, b *VaccineLocation) bool{
+	"distance": nearer,
+	"name":     func(a, b *VaccineLocation) bool { return a.Name < b.Name },
+	"type":     func(a, b *VaccineLocation) bool { return a.Type < b.Type },
+}
+
+// sortExport returns a copy of locs sorted by the named order, with ties
+// broken by name and then siteKey, so the same sites always export the
+// same way, whatever order the scan found them in.
+func sortExport(locs []*VaccineLocation, order string) []*VaccineLocation {
+	var less = exportOrders[order]
+	var out = make([]*VaccineLocation, len(locs))
+	copy(out, locs)
+	sort.Slice(out, func(i, j int) bool {
+		var a, b = out[i], out[j]
+		switch {
+		case less(a, b):
+			return true
+		case less(b, a):
+			return false
+		case a.Name != b.Name:
+			return a.Name < b.Name
+		}
+		return siteKey(a) < siteKey(b)
+	})
+	return out
+}
+
+// exportFile writes locs to path with write. It's written to a temporary
+// file first and renamed into place, so whatever reads the export never
+// sees half of one.
+func exportFile(cfg *Config, path string, locs []*VaccineLocation, write func(*Config, io.Writer, []*VaccineLocation) error) error {
+	var f, err = ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	// TempFile makes it readable only by us, but exports are for sharing,
+	// as os.Create would have left them.
+	err = f.Chmod(0644)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	err = write(cfg, f, locs)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+type geoJSONFeatureCollection struct {
+	Type     string            `json:"type"`
+	Features []*geoJSONFeature `json:"features"`
+}
+
+type geoJSONFeature struct {
+	Type       string           `json:"type"`
+	Geometry   *geoJSONGeometry `json:"geometry"`
+	Properties *geoJSONProps    `json:"properties"`
+}
+
+type geoJSONGeometry struct {
+	Type string `json:"type"`
+	// Coordinates are [long, lat], as GeoJSON requires.
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+type geoJSONProps struct {
+	ExtID            string   `json:"extId"`
+	Name             SiteName `json:"name"`
+	Address          string   `json:"address"`
+	DistanceInMeters float64  `json:"distanceInMeters"`
+	// Distance is DistanceInMeters in the configured unit.
+	Distance     float64 `json:"distance"`
+	DistanceUnit string  `json:"distanceUnit"`
+	Type         string  `json:"type"`
+	// Profiles are the eligibility profiles the site was found for.
+	Profiles []string `json:"profiles"`
+	// Zone is the timezone the site's hours are in, if known.
+	Zone *SiteZone `json:"zone"`
+	// OriginZip is the zip whose search found the site.
+	OriginZip string `json:"originZip"`
+	// NewToday is set with -mark-new if the site was first found today.
+	NewToday bool `json:"newToday"`
+	// NearCity is the major city nearest the site, with -nearest-city.
+	NearCity string `json:"nearCity"`
+	// AvailableFrom is the earliest date the site was found from, with
+	// -days-ahead.
+	AvailableFrom string `json:"availableFrom"`
+}
+
+// writeGeoJSON writes locs as a GeoJSON FeatureCollection of points. Sites
+// without a location get a null geometry.
+func writeGeoJSON(cfg *Config, w io.Writer, locs []*VaccineLocation) error {
+	var fc = &geoJSONFeatureCollection{
+		Type:     "FeatureCollection",
+		Features: make([]*geoJSONFeature, len(locs)),
+	}
+
+	for i, l := range locs {
+		var f = &geoJSONFeature{
+			Type: "Feature",
+			Properties: &geoJSONProps{
+				ExtID:            l.ExtID,
+				Name:             l.Name,
+				Address:          l.DisplayAddress,
+				DistanceInMeters: l.DistanceInMeters,
+				Distance:         convertDistance(cfg, l.DistanceInMeters),
+				DistanceUnit:     cfg.DistanceUnit,
+				Type:             l.Type,
+				Profiles:         l.Profiles,
+				Zone:             l.Zone,
+				OriginZip:        l.OriginZip,
+				NewToday:         l.NewToday,
+				NearCity:         l.NearCity,
+				AvailableFrom:    l.AvailableFrom,
+			},
+		}
+		if l.Location != nil {
+			f.Geometry = &geoJSONGeometry{
+				Type:        "Point",
+				Coordinates: [2]float64{l.Location.Long, l.Location.Lat},
+			}
+		}
+		fc.Features[i] = f
+	}
+
+	var e = json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(fc)
+}
+
+// writeJSONExport writes locs as a JSON array of the sites as the API
+// returned them.
+func writeJSONExport(cfg *Config, w io.Writer, locs []*VaccineLocation) error {
+	if locs == nil {
+		locs = []*VaccineLocation{}
+	}
+	var e = json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(locs)
+}
+
+// csvHeader names the columns writeCSV writes.
+var csvHeader = []string{"extId", "name", "address", "lat", "long", "distance", "distanceUnit", "type", "hours", "profiles", "timezone", "utcOffset", "dst", "originZip", "newToday", "nearCity", "availableFrom"}
+
+// writeCSV writes locs as CSV, one site per row. Hours and profiles are
+// joined with "; " to fit in a single column each.
+func writeCSV(cfg *Config, w io.Writer, locs []*VaccineLocation) error {
+	var c = csv.NewWriter(w)
+	var err = c.Write(csvHeader)
+	if err != nil {
+		return err
+	}
+
+	for _, l := range locs {
+		var lat, long string
+		if l.Location != nil {
+			lat = strconv.FormatFloat(l.Location.Lat, 'f', -1, 64)
+			long = strconv.FormatFloat(l.Location.Long, 'f', -1, 64)
+		}
+
+		var zone, offset, dst string
+		if l.Zone != nil {
+			zone = l.Zone.Name
+			offset = strconv.Itoa(l.Zone.UTCOffset)
+			dst = strconv.FormatBool(l.Zone.DST)
+		}
+
+		var hours []string
+		for _, h := range l.displayHours() {
+			hours = append(hours, h.String())
+		}
+
+		err = c.Write([]string{
+			l.ExtID,
+			string(l.Name),
+			normalizeAddress(l.DisplayAddress),
+			lat,
+			long,
+			strconv.FormatFloat(convertDistance(cfg, l.DistanceInMeters), 'f', cfg.DistancePrecision, 64),
+			cfg.DistanceUnit,
+			l.Type,
+			strings.Join(hours, "; "),
+			strings.Join(l.Profiles, "; "),
+			zone,
+			offset,
+			dst,
+			l.OriginZip,
+			strconv.FormatBool(l.NewToday),
+			l.NearCity,
+			l.AvailableFrom,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	c.Flush()
+	return c.Error()
+}
@@ -0,0 +1,95 @@
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExportFileReplacesWhole(t *testing.T) {
+	var dir = t.TempDir()
+	var path = filepath.Join(dir, "sites.csv")
+	var writeText = func(text string, err error) func(*Config, io.Writer, []*VaccineLocation) error {
+		return func(_ *Config, w io.Writer, _ []*VaccineLocation) error {
+			io.WriteString(w, text)
+			return err
+		}
+	}
+
+	var err = exportFile(&Config{}, path, nil, writeText("first", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = exportFile(&Config{}, path, nil, writeText("half", errors.New("write failed")))
+	if err == nil {
+		t.Fatal("failed write not reported")
+	}
+
+	var b []byte
+	b, err = ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "first" {
+		t.Errorf("export = %q after a failed write, want the previous one", b)
+	}
+	var files, _ = ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("%d files left in the export directory, want just the export", len(files))
+	}
+	if files[0].Mode().Perm()&0044 == 0 {
+		t.Errorf("export mode %v isn't readable by others", files[0].Mode())
+	}
+}
+
+func TestWriteGeoJSON(t *testing.T) {
+	var cfg = &Config{DistanceUnit: UnitKilometers, DistancePrecision: 1}
+	var locs = []*VaccineLocation{
+		{ExtID: "a", Name: "Moscone Center", DisplayAddress: "747 Howard St", DistanceInMeters: 1500, Location: &Location{Lat: 37.7842, Long: -122.4016}},
+		{ExtID: "b", Name: "Somewhere"},
+	}
+	var buf bytes.Buffer
+	var err = writeGeoJSON(cfg, &buf, locs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fc struct {
+		Type     string
+		Features []struct {
+			Type     string
+			Geometry *struct {
+				Type        string
+				Coordinates []float64
+			}
+			Properties map[string]interface{}
+		}
+	}
+	err = json.Unmarshal(buf.Bytes(), &fc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fc.Type != "FeatureCollection" || len(fc.Features) != 2 {
+		t.Fatalf("got a %q of %d features, want a FeatureCollection of 2", fc.Type, len(fc.Features))
+	}
+
+	var site = fc.Features[0]
+	if site.Type != "Feature" || site.Geometry == nil || site.Geometry.Type != "Point" {
+		t.Fatalf("got feature %+v, want a point", site)
+	}
+	if want := []float64{-122.4016, 37.7842}; !reflect.DeepEqual(site.Geometry.Coordinates, want) {
+		t.Errorf("got coordinates %v, want [lng, lat] %v", site.Geometry.Coordinates, want)
+	}
+	if site.Properties["extId"] != "a" || site.Properties["name"] != "Moscone Center" || site.Properties["distance"] != 1.5 || site.Properties["distanceUnit"] != "km" {
+		t.Errorf("got properties %v", site.Properties)
+	}
+
+	if fc.Features[1].Geometry != nil || !bytes.Contains(buf.Bytes(), []byte(`"geometry": null`)) {
+		t.Errorf("got geometry %+v for a site with no location, want null", fc.Features[1].Geometry)
+	}
+}
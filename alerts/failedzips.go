@@ -0,0 +1,121 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+)
+
+// failedZip is a zip whose search failed, kept so a later run can search
+// it again with -retry-failed.
+type failedZip struct {
+	Zip     string  `json:"zip"`
+	Lat     float64 `json:"lat"`
+	Long    float64 `json:"long"`
+	Profile string  `json:"profile"`
+	Error   string  `json:"error"`
+}
+
+// writeFailedZips writes failed to path as a JSON array, replacing what
+// was there. An empty array means every search succeeded.
+func writeFailedZips(path string, failed []*failedZip) error {
+	if failed == nil {
+		failed = []*failedZip{}
+	}
+	var b, err = json.MarshalIndent(failed, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
+
+// loadFailedZips reads a file written by writeFailedZips.
+func loadFailedZips(path string) ([]*failedZip, error) {
+	var b, err = ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var failed []*failedZip
+	err = json.Unmarshal(b, &failed)
+	if err != nil {
+		return nil, err
+	}
+	return failed, nil
+}
+
+// retryFailedZips returns the records of data for each zip in failed, once
+// each. Zips that aren't in data, e.g. coordinates read from stdin, are
+// searched at the coordinates they failed at.
+func retryFailedZips(data []*ZipToLatLong, failed []*failedZip) []*ZipToLatLong {
+	var byZip = make(map[string]*ZipToLatLong, len(data))
+	for _, d := range data {
+		if _, ok := byZip[d.Fields.Zip]; !ok {
+			byZip[d.Fields.Zip] = d
+		}
+	}
+
+	var out []*ZipToLatLong
+	var seen = make(map[string]bool)
+	for _, f := range failed {
+		if seen[f.Zip] {
+			continue
+		}
+		seen[f.Zip] = true
+
+		var d, ok = byZip[f.Zip]
+		if !ok {
+			d = &ZipToLatLong{}
+			d.Fields.Zip = f.Zip
+			d.Fields.Latitude = f.Lat
+			d.Fields.Longitude = f.Long
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+// failedSearch is a search that failed during a scan.
+type failedSearch struct {
+	record  *ZipToLatLong
+	profile *Profile
+	err     error
+}
+
+func (f *failedSearch) failedZip() *failedZip {
+	return &failedZip{
+		Zip:     f.record.Fields.Zip,
+		Lat:     f.record.Fields.Latitude,
+		Long:    f.record.Fields.Longitude,
+		Profile: f.profile.Name,
+		Error:   f.err.Error(),
+	}
+}
+
+// retrySearches retries each failed search once with retry, those of the
+// zips with the highest cfg.ZipPriority first, so that when the retry
+// budget runs out it's been spent where it matters most. It returns the
+// searches that still failed, or weren't retried.
+func (r *runner) retrySearches(ctx context.Context, failed []*failedSearch, retry func(*failedSearch) error) []*failedSearch {
+	var prio = r.cfg.ZipPriority
+	sort.SliceStable(failed, func(i, j int) bool {
+		return prio[failed[i].record.Fields.Zip] > prio[failed[j].record.Fields.Zip]
+	})
+
+	var still []*failedSearch
+	for i, f := range failed {
+		if ctx.Err() != nil || !r.cfg.retries.take() {
+			return append(still, failed[i:]...)
+		}
+		r.cfg.log.debug("retrying the", f.profile.Name, "search near", f.record.Fields.Zip)
+		var err = retry(f)
+		if err != nil {
+			f.err = err
+			still = append(still, f)
+		}
+	}
+	if n := len(failed) - len(still); n > 0 {
+		r.cfg.log.info("retried", len(failed), "failed searches,", n, "succeeded")
+	}
+	return still
+}
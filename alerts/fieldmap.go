@@ -0,0 +1,123 @@
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// defaultFields are where each field of a record is in the bundled
+// opendatasoft data, by the name -data-fields maps it under.
+var defaultFields = map[string]string{
+	"zip":       "fields.zip",
+	"latitude":  "fields.latitude",
+	"longitude": "fields.longitude",
+	"city":      "fields.city",
+	"state":     "fields.state",
+	"timezone":  "fields.timezone",
+	"dst":       "fields.dst",
+	"timestamp": "record_timestamp",
+}
+
+// fieldMap says where each field of a record is in a data file shaped
+// differently from the bundled one, as a dotted path of JSON keys. Fields
+// it doesn't map are looked for where the bundled data has them.
+type fieldMap map[string]string
+
+// parseFieldMap parses comma separated field=path pairs, e.g.
+// "zip=postal_code,latitude=geo.lat".
+func parseFieldMap(s string) (fieldMap, error) {
+	var m = make(fieldMap, len(defaultFields))
+	for k, v := range defaultFields {
+		m[k] = v
+	}
+	for _, kv := range strings.Split(s, ",") {
+		if strings.TrimSpace(kv) == "" {
+			continue
+		}
+		var parts = strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+			return nil, errors.New("invalid field mapping " + kv + ", expected field=path")
+		}
+		var field = strings.TrimSpace(parts[0])
+		if _, ok := defaultFields[field]; !ok {
+			return nil, errors.New("unknown field " + field + " in -data-fields")
+		}
+		m[field] = strings.TrimSpace(parts[1])
+	}
+	return m, nil
+}
+
+// decode decodes a single record, of any shape, reading each field from
+// where m says it is. Numbers may be given as strings and zips as numbers.
+// Missing fields are left empty, except for the coordinates, without which
+// a record can't be searched.
+func (m fieldMap) decode(b []byte) (*ZipToLatLong, error) {
+	var d = json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var record interface{}
+	var err = d.Decode(&record)
+	if err != nil {
+		return nil, err
+	}
+
+	var z = &ZipToLatLong{}
+	var f = &z.Fields
+	var fields = []struct {
+		name string
+		set  func(string) error
+	}{
+		{"zip", func(v string) error { f.Zip = v; return nil }},
+		{"city", func(v string) error { f.City = v; return nil }},
+		{"state", func(v string) error { f.State = v; return nil }},
+		{"timestamp", func(v string) error { z.RecordTimestamp = v; return nil }},
+		{"latitude", func(v string) (err error) { f.Latitude, err = strconv.ParseFloat(v, 64); return }},
+		{"longitude", func(v string) (err error) { f.Longitude, err = strconv.ParseFloat(v, 64); return }},
+		{"timezone", func(v string) (err error) { f.Timezone, err = strconv.Atoi(v); return }},
+		{"dst", func(v string) (err error) { f.DST, err = strconv.Atoi(v); return }},
+	}
+	for _, field := range fields {
+		var v, ok = lookupPath(record, m[field.name])
+		if !ok {
+			if field.name == "latitude" || field.name == "longitude" {
+				return nil, errors.New("record has no " + field.name + " at " + m[field.name])
+			}
+			continue
+		}
+		err = field.set(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s at %s: %w", field.name, m[field.name], err)
+		}
+	}
+	z.Fields.Geopoint = [2]float64{f.Latitude, f.Longitude}
+
+	return z, nil
+}
+
+// lookupPath follows a dotted path of keys into a decoded JSON value,
+// returning the scalar at its end as a string.
+func lookupPath(v interface{}, path string) (string, bool) {
+	for _, key := range strings.Split(path, ".") {
+		var obj, ok = v.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		v, ok = obj[key]
+		if !ok {
+			return "", false
+		}
+	}
+
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
@@ -0,0 +1,263 @@
+package alerts
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// filterNear returns the records within miles of the given zip's
+// coordinates, including the zip itself, measuring the distances across
+// workers goroutines.
+func filterNear(data []*ZipToLatLong, zip string, miles float64, workers int) ([]*ZipToLatLong, error) {
+	var home, err = zipLocation(data, zip)
+	if err != nil {
+		return nil, err
+	}
+	return filterRadius(data, *home, miles, workers), nil
+}
+
+// filterRadius returns the records within miles of center, measuring the
+// distances across workers goroutines.
+func filterRadius(data []*ZipToLatLong, center Location, miles float64, workers int) []*ZipToLatLong {
+	var near = make([]bool, len(data))
+	parallelRange(len(data), workers, func(i int) {
+		var p = Location{Lat: data[i].Fields.Latitude, Long: data[i].Fields.Longitude}
+		near[i] = haversine(center, p) <= miles*MetersPerMile
+	})
+
+	var out []*ZipToLatLong
+	for i, d := range data {
+		if near[i] {
+			out = append(out, d)
+		}
+	}
+
+	return out
+}
+
+// filterCities returns the records whose city is one of cities, ignoring
+// case.
+func filterCities(data []*ZipToLatLong, cities []string) []*ZipToLatLong {
+	var out []*ZipToLatLong
+	for _, d := range data {
+		for _, c := range cities {
+			if strings.EqualFold(d.Fields.City, c) {
+				out = append(out, d)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// zipLocation returns the coordinates of zip in data.
+func zipLocation(data []*ZipToLatLong, zip string) (*Location, error) {
+	for _, d := range data {
+		if d.Fields.Zip == zip {
+			return &Location{Lat: d.Fields.Latitude, Long: d.Fields.Longitude}, nil
+		}
+	}
+	return nil, errors.New("zip " + zip + " not found in data")
+}
+
+// gridRecords keeps the first record of data in each cell of a grid of
+// coordinates rounded to places decimal places, so neighboring zips, whose
+// searches find the same sites, are only searched once.
+func gridRecords(data []*ZipToLatLong, places int) []*ZipToLatLong {
+	var seen = make(map[Location]bool, len(data))
+	var out = make([]*ZipToLatLong, 0, len(data))
+	for _, d := range data {
+		var cell = Location{Lat: roundTo(d.Fields.Latitude, places), Long: roundTo(d.Fields.Longitude, places)}
+		if !seen[cell] {
+			seen[cell] = true
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// filterMinHours drops the sites open for less than min a week in total.
+// Sites that don't list any hours are kept, since how long they're open
+// isn't known.
+func filterMinHours(log *logger, locs []*VaccineLocation, min time.Duration) []*VaccineLocation {
+	var out = make([]*VaccineLocation, 0, len(locs))
+	for _, v := range locs {
+		if len(v.OpenHours) > 0 && v.weeklyHours() < min {
+			log.info("skipping", v.Name, "as it's only open", v.weeklyHours(), "a week")
+			continue
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+// DefaultExcludeSites matches the test and placeholder entries the API has
+// been seen to list, by name or address. "Test" alone isn't enough, as real
+// sites are named after COVID tests too.
+const DefaultExcludeSites = `^\s*test\b|\btest (site|location|clinic)\b|\b(dummy|placeholder|do not use|lorem ipsum)\b`
+
+// filterSites drops the sites whose name or address matches re.
+func filterSites(log *logger, locs []*VaccineLocation, re *regexp.Regexp) []*VaccineLocation {
+	var out = make([]*VaccineLocation, 0, len(locs))
+	for _, v := range locs {
+		if re.MatchString(string(v.Name)) || re.MatchString(v.DisplayAddress) {
+			log.info("skipping", v.Name, "as it looks like a test site")
+			continue
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+// filterProducts keeps the sites whose vaccineData lists one of products,
+// ignoring case and matching any part of an entry. The API doesn't always
+// say what a site offers, so sites that list nothing, or something that
+// doesn't decode, are kept.
+func filterProducts(log *logger, locs []*VaccineLocation, products []string) []*VaccineLocation {
+	var out = make([]*VaccineLocation, 0, len(locs))
+	var unknown int
+	for _, v := range locs {
+		var listed, err = decodeVaccineData(v.VaccineData)
+		if err != nil || len(listed) == 0 {
+			unknown++
+			out = append(out, v)
+			continue
+		}
+		if !hasProduct(listed, products) {
+			log.debug("skipping", v.Name, "as it only lists", listed)
+			continue
+		}
+		out = append(out, v)
+	}
+	if unknown > 0 {
+		log.info("not filtering", unknown, "sites by vaccine product, as they don't list their products")
+	}
+	return out
+}
+
+// hasProduct reports whether any of listed contains one of products,
+// ignoring case.
+func hasProduct(listed, products []string) bool {
+	for _, l := range listed {
+		l = strings.ToLower(l)
+		for _, p := range products {
+			if strings.Contains(l, strings.ToLower(p)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// filterTypes drops the sites whose type is one of types, ignoring case.
+func filterTypes(log *logger, locs []*VaccineLocation, types []string) []*VaccineLocation {
+	var out = make([]*VaccineLocation, 0, len(locs))
+	for _, v := range locs {
+		if hasType(types, v.Type) {
+			log.debug("skipping", v.Name, "as its type is", v.Type)
+			continue
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+func hasType(types []string, t string) bool {
+	for _, x := range types {
+		if strings.EqualFold(x, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// minSuggestSites is how many sites of a type have to be found without
+// any listing hours before the type is suggested for exclusion.
+const minSuggestSites = 3
+
+// suggestExcludedTypes returns the types, in order, of which at least
+// minSuggestSites sites were found and none list any open hours. They're
+// likely placeholder entries without real availability.
+func suggestExcludedTypes(locs []*VaccineLocation) []string {
+	var count = make(map[string]int)
+	var withHours = make(map[string]bool)
+	for _, v := range locs {
+		count[v.Type]++
+		if len(v.OpenHours) > 0 {
+			withHours[v.Type] = true
+		}
+	}
+
+	var out []string
+	for t, n := range count {
+		if t != "" && n >= minSuggestSites && !withHours[t] {
+			out = append(out, t)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// nearestLocations returns the n locations of locs nearest the point they
+// were searched from, nearest first. It doesn't modify locs.
+func nearestLocations(locs []*VaccineLocation, n int) []*VaccineLocation {
+	if len(locs) <= n {
+		return locs
+	}
+	var out = make([]*VaccineLocation, len(locs))
+	copy(out, locs)
+	sort.SliceStable(out, func(i, j int) bool { return nearer(out[i], out[j]) })
+	return out[:n]
+}
+
+// withinDistance returns the locations of locs at most max meters from the
+// point they were searched from, leaving out those of unknown distance.
+// It doesn't modify locs.
+func withinDistance(locs []*VaccineLocation, max float64) []*VaccineLocation {
+	var out = make([]*VaccineLocation, 0, len(locs))
+	for _, l := range locs {
+		if !l.DistanceUnknown && l.DistanceInMeters <= max {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// dedupLocations drops the repeats of a site within a single response,
+// which the API sometimes sends, keeping whichever copy has the most data.
+// Otherwise locs keep their order.
+func dedupLocations(locs []*VaccineLocation) []*VaccineLocation {
+	var at = make(map[string]int, len(locs))
+	var out = make([]*VaccineLocation, 0, len(locs))
+	for _, l := range locs {
+		var key = siteKey(l)
+		if i, ok := at[key]; ok {
+			if completeness(l) > completeness(out[i]) {
+				out[i] = l
+			}
+			continue
+		}
+		at[key] = len(out)
+		out = append(out, l)
+	}
+	return out
+}
+
+// completeness scores how much of a site's data the API filled in. Open
+// hours count the most, as they're what's announced.
+func completeness(l *VaccineLocation) int {
+	var n = 10 * len(l.OpenHours)
+	if l.DisplayAddress != "" {
+		n++
+	}
+	if l.Location != nil {
+		n++
+	}
+	if l.Type != "" {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,78 @@
+package alerts
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestUnknownDistances(t *testing.T) {
+	var locs = []*VaccineLocation{
+		{ExtID: "nowhere"},
+		{ExtID: "far", DistanceInMeters: 30000},
+		{ExtID: "near", Location: &Location{Lat: 37.78, Long: -122.41}},
+	}
+	fillDistances(locs, Location{Lat: 37.77, Long: -122.42})
+
+	var names = func(locs []*VaccineLocation) []string {
+		var out []string
+		for _, l := range locs {
+			out = append(out, l.ExtID)
+		}
+		return out
+	}
+	if !locs[0].DistanceUnknown || locs[1].DistanceUnknown || locs[2].DistanceUnknown {
+		t.Fatal("only the site without a distance or coordinates should be unknown")
+	}
+	if locs[2].DistanceInMeters == 0 {
+		t.Error("distance not worked out from the coordinates")
+	}
+
+	var cases = []struct {
+		name string
+		got  []*VaccineLocation
+		want []string
+	}{
+		{"within distance", withinDistance(locs, 50000), []string{"far", "near"}},
+		{"nearest", nearestLocations(locs, 2), []string{"near", "far"}},
+		{"nearest first", nearestFirst(locs), []string{"near", "far", "nowhere"}},
+		{"ties by ExtID", nearestFirst([]*VaccineLocation{
+			{ExtID: "b", DistanceUnknown: true},
+			{ExtID: "a", DistanceUnknown: true},
+		}), []string{"a", "b"}},
+	}
+	for _, c := range cases {
+		if got := names(c.got); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestHaversine(t *testing.T) {
+	var (
+		la         = Location{Lat: 34.0522, Long: -118.2437}
+		sf         = Location{Lat: 37.7749, Long: -122.4194}
+		sanDiego   = Location{Lat: 32.7157, Long: -117.1611}
+		sacramento = Location{Lat: 38.5816, Long: -121.4944}
+	)
+	var cases = []struct {
+		name string
+		a, b Location
+		km   float64
+	}{
+		{"same point", sf, sf, 0},
+		{"la to sf", la, sf, 559},
+		{"la to san diego", la, sanDiego, 179},
+		{"sf to sacramento", sf, sacramento, 121},
+		{"half way round the equator", Location{}, Location{Long: 180}, 20015},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			for _, d := range []float64{haversine(c.a, c.b), haversine(c.b, c.a)} {
+				if math.Abs(d/MetersPerKm-c.km) > 1 {
+					t.Errorf("got %.1f km, want %v km", d/MetersPerKm, c.km)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package alerts
+
+import (
+	"math"
+	"strconv"
+)
+
+const (
+	// EarthRadiusMeters is the mean radius of the earth.
+	EarthRadiusMeters = 6371000
+	MetersPerMile     = 1609.344
+	MetersPerKm       = 1000
+
+	UnitMiles      = "mi"
+	UnitKilometers = "km"
+)
+
+// convertDistance converts meters to cfg.DistanceUnit, rounded to
+// cfg.DistancePrecision decimal places. Every output that shows a distance
+// goes through here so they all agree.
+func convertDistance(cfg *Config, meters float64) float64 {
+	var d = meters / MetersPerMile
+	if cfg.DistanceUnit == UnitKilometers {
+		d = meters / MetersPerKm
+	}
+
+	var scale = math.Pow(10, float64(cfg.DistancePrecision))
+	return math.Round(d*scale) / scale
+}
+
+// formatDistance renders meters for display, e.g. "3.2 mi".
+func formatDistance(cfg *Config, meters float64) string {
+	return strconv.FormatFloat(convertDistance(cfg, meters), 'f', cfg.DistancePrecision, 64) + " " + cfg.DistanceUnit
+}
+
+// haversine returns the great-circle distance between a and b in meters.
+func haversine(a, b Location) float64 {
+	var lat1 = a.Lat * math.Pi / 180
+	var lat2 = b.Lat * math.Pi / 180
+	var dLat = (b.Lat - a.Lat) * math.Pi / 180
+	var dLong = (b.Long - a.Long) * math.Pi / 180
+
+	var h = math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLong/2)*math.Sin(dLong/2)
+
+	return 2 * EarthRadiusMeters * math.Asin(math.Sqrt(h))
+}
+
+// fillDistances sets the distance from the searched point from of each of
+// locs the API left it out of, as it sometimes does, so filtering and
+// sorting by distance treats them like the rest. Sites without
+// coordinates are marked DistanceUnknown instead.
+func fillDistances(locs []*VaccineLocation, from Location) {
+	for _, v := range locs {
+		if v.DistanceInMeters != 0 {
+			continue
+		}
+		if v.Location == nil {
+			v.DistanceUnknown = true
+			continue
+		}
+		v.DistanceInMeters = haversine(from, *v.Location)
+	}
+}
+
+// nearer reports whether a is nearer than b, sites of unknown distance
+// being further than any other.
+func nearer(a, b *VaccineLocation) bool {
+	if a.DistanceUnknown != b.DistanceUnknown {
+		return b.DistanceUnknown
+	}
+	return a.DistanceInMeters < b.DistanceInMeters
+}
+
+// roundTo rounds x to the given number of decimal places.
+func roundTo(x float64, places int) float64 {
+	var scale = math.Pow(10, float64(places))
+	return math.Round(x*scale) / scale
+}
@@ -0,0 +1,68 @@
+package alerts
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// historyRecord is one scan's line in the history file, for plotting how
+// availability changes over time.
+type historyRecord struct {
+	Time          time.Time `json:"time"`
+	SitesFound    int       `json:"sitesFound"`
+	Notifications int       `json:"notifications"`
+	SearchErrors  int       `json:"searchErrors"`
+	// Counties counts the sites found in each county, with a county file.
+	// Sites whose county isn't known aren't counted.
+	Counties map[string]int `json:"counties,omitempty"`
+}
+
+// newHistoryRecord returns the history of a scan that found found.
+func newHistoryRecord(summary *Summary, found []*VaccineLocation) *historyRecord {
+	var h = &historyRecord{
+		Time:          summary.Start,
+		SitesFound:    summary.SitesFound,
+		Notifications: summary.Notifications,
+		SearchErrors:  summary.SearchErrors,
+	}
+	for _, v := range found {
+		if v.county == "" {
+			continue
+		}
+		if h.Counties == nil {
+			h.Counties = make(map[string]int)
+		}
+		h.Counties[v.county]++
+	}
+	return h
+}
+
+// appendHistory adds h to the end of the history file at path as a JSON
+// line. Once the file has grown to maxSize bytes, it's first moved aside
+// to path.1, replacing any older one, and a new file started. A zero
+// maxSize never rotates.
+func appendHistory(path string, maxSize int64, h *historyRecord) error {
+	if maxSize > 0 {
+		var info, err = os.Stat(path)
+		if err == nil && info.Size() >= maxSize {
+			err = os.Rename(path, path+".1")
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	var f, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	err = json.NewEncoder(f).Encode(h)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,133 @@
+package alerts
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// weekdays are the days of the week, by the three letter prefix days are
+// recognised by.
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// displayHours returns v's open hours as they should be shown, with spans
+// split at midnight joined back together. See mergeMidnight.
+func (v *VaccineLocation) displayHours() []Hours {
+	return mergeMidnight(v.OpenHours)
+}
+
+// mergeMidnight joins hours that run up to midnight with hours picking up
+// again at midnight into a single span past midnight, e.g. 10PM-11:59PM and
+// 12AM-6AM become 10PM-6AM. The later hours may be listed either on the
+// same days or on the days after.
+func mergeMidnight(hours []Hours) []Hours {
+	var out = make([]Hours, len(hours))
+	copy(out, hours)
+	var merged = make([]bool, len(out))
+
+	for i := range out {
+		if merged[i] || !endsAtMidnight(out[i]) {
+			continue
+		}
+		for j := range out {
+			if j == i || merged[j] || !startsAtMidnight(out[j]) {
+				continue
+			}
+			var days = dayIndexes(out[j].Days, 0)
+			if days != dayIndexes(out[i].Days, 0) && days != dayIndexes(out[i].Days, 1) {
+				continue
+			}
+			out[i].LocalEnd = out[j].LocalEnd
+			merged[j] = true
+			break
+		}
+	}
+
+	var kept = out[:0]
+	for i, h := range out {
+		if !merged[i] {
+			kept = append(kept, h)
+		}
+	}
+	return kept
+}
+
+// endsAtMidnight reports whether h runs up to midnight, which the API
+// writes as 23:59, 24:00 or 00:00.
+func endsAtMidnight(h Hours) bool {
+	if h.LocalEnd == "24:00:00" {
+		return true
+	}
+	var end, err = time.Parse("15:04:05", h.LocalEnd)
+	if err != nil {
+		return false
+	}
+	return (end.Hour() == 23 && end.Minute() == 59) ||
+		(end.Hour() == 0 && end.Minute() == 0 && !startsAtMidnight(h))
+}
+
+// startsAtMidnight reports whether h opens at midnight.
+func startsAtMidnight(h Hours) bool {
+	var start, err = time.Parse("15:04:05", h.LocalStart)
+	return err == nil && start.Hour() == 0 && start.Minute() == 0
+}
+
+// dayIndexes returns a key for the set of days, each shifted forward by
+// shift days, so sets of days can be compared. Unrecognised days are kept
+// as they are.
+func dayIndexes(days []string, shift int) string {
+	var keys = make([]string, 0, len(days))
+	for _, d := range days {
+		var key = strings.ToLower(d)
+		for i, w := range weekdays {
+			if strings.HasPrefix(key, w) {
+				key = weekdays[(i+shift)%len(weekdays)]
+				break
+			}
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+// roundClock rounds t's time of day to a multiple of step minutes from
+// midnight, down, or up if up is set, which can reach the next midnight.
+func roundClock(t time.Time, step int, up bool) time.Time {
+	var since = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	var s = time.Duration(step) * time.Minute
+	var rounded = since - since%s
+	if up && rounded < since {
+		rounded += s
+	}
+	return t.Add(rounded - since)
+}
+
+// clockString formats t, parsed from the API's time s with err, as e.g.
+// 1:30PM. A time that didn't parse is shown as it came, or as ? if it's
+// empty, rather than as midnight. 24:00:00 is midnight.
+func clockString(t time.Time, err error, s string) string {
+	if err == nil || s == "24:00:00" {
+		return t.Format("3:04PM")
+	}
+	if s == "" {
+		return "?"
+	}
+	return s
+}
+
+// hoursWarnings returns a warning for each of h's times that doesn't
+// parse, and so is shown as the API sent it.
+func (h *Hours) hoursWarnings() []string {
+	var out []string
+	for _, t := range []string{h.LocalStart, h.LocalEnd} {
+		if t == "24:00:00" {
+			continue
+		}
+		if _, err := time.Parse("15:04:05", t); err != nil {
+			out = append(out, "unparseable time "+strconv.Quote(t))
+		}
+	}
+	return out
+}
@@ -0,0 +1,85 @@
+package alerts
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHoursFormatRounds(t *testing.T) {
+	var cases = []struct {
+		name       string
+		start, end string
+		round      int
+		want       string
+	}{
+		{"exact", "08:50:00", "17:03:00", 0, "8:50AM-5:03PM"},
+		{"quarter hours", "08:50:00", "17:03:00", 15, "8:45AM-5:15PM"},
+		{"already on the step", "09:00:00", "17:00:00", 15, "9:00AM-5:00PM"},
+		{"7 minutes", "08:50:00", "17:03:00", 7, "8:45AM-5:09PM"},
+		{"45 minutes", "08:50:00", "17:03:00", 45, "8:15AM-5:15PM"},
+		{"seconds round the end up", "09:00:00", "16:59:30", 5, "9:00AM-5:00PM"},
+		{"up to midnight", "20:10:00", "23:50:00", 45, "7:30PM-12:00AM"},
+		{"unparsed left alone", "9am", "17:03:00", 15, "9am-5:15PM"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var h = Hours{LocalStart: c.start, LocalEnd: c.end}
+			if got := h.format(c.round); got != c.want {
+				t.Errorf("got %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestMergeMidnight(t *testing.T) {
+	var cases = []struct {
+		name  string
+		hours []Hours
+		want  []string
+		// weekly is how long the site is open over the week.
+		weekly time.Duration
+	}{
+		{"same day", []Hours{
+			{Days: []string{"friday"}, LocalStart: "22:00:00", LocalEnd: "23:59:00"},
+			{Days: []string{"friday"}, LocalStart: "00:00:00", LocalEnd: "06:00:00"},
+		}, []string{"Friday - 10:00PM-6:00AM"}, 8 * time.Hour},
+		{"next day", []Hours{
+			{Days: []string{"friday"}, LocalStart: "22:00:00", LocalEnd: "24:00:00"},
+			{Days: []string{"saturday"}, LocalStart: "00:00:00", LocalEnd: "06:00:00"},
+		}, []string{"Friday - 10:00PM-6:00AM"}, 8 * time.Hour},
+		{"listed the other way round", []Hours{
+			{Days: []string{"saturday"}, LocalStart: "00:00:00", LocalEnd: "06:00:00"},
+			{Days: []string{"friday"}, LocalStart: "22:00:00", LocalEnd: "00:00:00"},
+		}, []string{"Friday - 10:00PM-6:00AM"}, 8 * time.Hour},
+		{"several days", []Hours{
+			{Days: []string{"friday", "saturday"}, LocalStart: "20:00:00", LocalEnd: "23:59:00"},
+			{Days: []string{"saturday", "sunday"}, LocalStart: "00:00:00", LocalEnd: "02:00:00"},
+		}, []string{"Friday,Saturday - 8:00PM-2:00AM"}, 12 * time.Hour},
+		{"gap before midnight", []Hours{
+			{Days: []string{"friday"}, LocalStart: "22:00:00", LocalEnd: "23:00:00"},
+			{Days: []string{"saturday"}, LocalStart: "00:00:00", LocalEnd: "06:00:00"},
+		}, []string{"Friday - 10:00PM-11:00PM", "Saturday - 12:00AM-6:00AM"}, 7 * time.Hour},
+		{"days apart", []Hours{
+			{Days: []string{"friday"}, LocalStart: "22:00:00", LocalEnd: "23:59:00"},
+			{Days: []string{"sunday"}, LocalStart: "00:00:00", LocalEnd: "06:00:00"},
+		}, []string{"Friday - 10:00PM-11:59PM", "Sunday - 12:00AM-6:00AM"}, 7*time.Hour + 59*time.Minute},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var v = &VaccineLocation{OpenHours: c.hours}
+			var got []string
+			var weekly time.Duration
+			for _, h := range v.displayHours() {
+				got = append(got, h.String())
+				weekly += h.duration() * time.Duration(len(h.Days))
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %q, want %q", got, c.want)
+			}
+			if weekly != c.weekly {
+				t.Errorf("got %v a week, want %v", weekly, c.weekly)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package alerts
+
+import (
+	"html/template"
+	"io"
+	"sort"
+	"time"
+)
+
+// htmlSite is a site as shown on the HTML status page.
+type htmlSite struct {
+	Name     SiteName
+	Address  string
+	Hours    []string
+	Type     string
+	MapsLink string
+}
+
+var htmlPage = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>CA vaccine sites with availability</title>
+</head>
+<body>
+<h1>CA vaccine sites with availability</h1>
+<p>Last updated <time datetime="{{.Updated.Format "2006-01-02T15:04:05Z07:00"}}">{{.Updated.Format "Jan 2, 2006 3:04 PM MST"}}</time>. Sign up at <a href="{{.SignupURL}}">{{.SignupURL}}</a>.</p>
+{{if .Sites}}<table>
+<thead>
+<tr><th>Site</th><th>Address</th><th>Hours</th><th>Type</th><th>Map</th></tr>
+</thead>
+<tbody>
+{{range .Sites}}<tr>
+<td>{{.Name}}</td>
+<td>{{.Address}}</td>
+<td>{{range $i, $h := .Hours}}{{if $i}}<br>{{end}}{{$h}}{{end}}</td>
+<td>{{.Type}}</td>
+<td>{{if .MapsLink}}<a href="{{.MapsLink}}">Directions</a>{{end}}</td>
+</tr>
+{{end}}</tbody>
+</table>
+{{else}}<p>No sites with availability right now.</p>
+{{end}}</body>
+</html>
+`))
+
+// writeHTML writes locs as a standalone HTML page with a table of the
+// sites, sorted by name, and when it was generated.
+func writeHTML(cfg *Config, w io.Writer, locs []*VaccineLocation) error {
+	var sites = make([]*htmlSite, len(locs))
+	for i, l := range locs {
+		var s = &htmlSite{
+			Name:    l.Name,
+			Address: normalizeAddress(l.DisplayAddress),
+			Type:    l.Type,
+		}
+		for _, h := range l.displayHours() {
+			s.Hours = append(s.Hours, l.hoursString(cfg, h))
+		}
+		s.MapsLink = mapsLink(l)
+		sites[i] = s
+	}
+	sort.Slice(sites, func(i, j int) bool { return sites[i].Name < sites[j].Name })
+
+	return htmlPage.Execute(w, struct {
+		Updated   time.Time
+		SignupURL string
+		Sites     []*htmlSite
+	}{cfg.Now(), SignupURL, sites})
+}
@@ -0,0 +1,233 @@
+package alerts
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// lease lets only one of several replicas scan and notify at a time. The
+// holder keeps a lock file at a shared path, and renews it by touching it
+// before every scan and every third of ttl during one; a lock file
+// untouched for longer than ttl belongs to a replica that died, and is
+// taken over.
+type lease struct {
+	path string
+	ttl  time.Duration
+	now  func() time.Time
+	// id identifies this process in the lock file.
+	id string
+	// lostHold is set once the lease is found lost during a scan.
+	lostHold int32
+	log      *logger
+}
+
+func newLease(path string, ttl time.Duration, now func() time.Time, log *logger) *lease {
+	var host, _ = os.Hostname()
+	return &lease{path: path, ttl: ttl, now: now, id: host + ":" + strconv.Itoa(os.Getpid()), log: log}
+}
+
+// acquire takes or renews the lease, reporting whether this process holds
+// it.
+func (l *lease) acquire() (bool, error) {
+	var b, err = ioutil.ReadFile(l.path)
+	switch {
+	case os.IsNotExist(err):
+		return l.create()
+	case err != nil:
+		return false, err
+	case string(b) == l.id:
+		var now = l.now()
+		return true, os.Chtimes(l.path, now, now)
+	}
+
+	var fi os.FileInfo
+	fi, err = os.Stat(l.path)
+	if os.IsNotExist(err) {
+		return l.create()
+	}
+	if err != nil {
+		return false, err
+	}
+	if l.now().Sub(fi.ModTime()) <= l.ttl {
+		return false, nil
+	}
+	return l.takeOver(string(b), fi.ModTime())
+}
+
+// takeOver replaces the stale lease of holder, last renewed at renewed,
+// with this process's, unless another process takes it over first. Only
+// one process at a time may try, the one that creates the takeover file
+// beside the lease; the others stand by until the next scan.
+func (l *lease) takeOver(holder string, renewed time.Time) (bool, error) {
+	var guard = l.path + ".takeover"
+	var g, err = os.OpenFile(guard, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		// A takeover file as stale as a lease was left by a process that
+		// died taking over, and is cleared for the next scan to try again.
+		if fi, serr := os.Stat(guard); serr == nil && l.now().Sub(fi.ModTime()) > l.ttl {
+			os.Remove(guard)
+		}
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	g.Close()
+	defer os.Remove(guard)
+
+	// The lease may have been renewed or taken over while the takeover
+	// file was being created.
+	var b []byte
+	b, err = ioutil.ReadFile(l.path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	if os.IsNotExist(err) {
+		return l.create()
+	}
+	var fi os.FileInfo
+	fi, err = os.Stat(l.path)
+	if err != nil {
+		return false, err
+	}
+	if string(b) != holder || !fi.ModTime().Equal(renewed) {
+		return false, nil
+	}
+
+	l.log.warn("taking over the lease from", holder+", which last renewed it at", renewed)
+	var f *os.File
+	f, err = ioutil.TempFile(filepath.Dir(l.path), filepath.Base(l.path)+".tmp")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(l.id)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return false, err
+	}
+	err = os.Rename(f.Name(), l.path)
+	if err != nil {
+		return false, err
+	}
+
+	b, err = ioutil.ReadFile(l.path)
+	if err != nil {
+		return false, err
+	}
+	return string(b) == l.id, nil
+}
+
+// create creates the lock file, unless another process got there first.
+func (l *lease) create() (bool, error) {
+	var f, err = os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	_, err = f.WriteString(l.id)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(l.path)
+		return false, err
+	}
+	return true, nil
+}
+
+// release gives the lease up, if this process holds it, so a standby
+// replica can take over without waiting out the ttl.
+func (l *lease) release() error {
+	if l == nil {
+		return nil
+	}
+	var b, err = ioutil.ReadFile(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if string(b) != l.id {
+		return nil
+	}
+	return os.Remove(l.path)
+}
+
+// hold returns a context for a scan made holding the lease, which is
+// renewed every third of ttl until stop is called. If it's lost meanwhile,
+// e.g. because renewing it failed for longer than ttl and another replica
+// took it over, the context is cancelled and lost reports true, so the
+// scan ends without notifying. A nil lease returns ctx as is.
+func (l *lease) hold(ctx context.Context) (held context.Context, stop func()) {
+	if l == nil {
+		return ctx, func() {}
+	}
+	atomic.StoreInt32(&l.lostHold, 0)
+	var cancel context.CancelFunc
+	held, cancel = context.WithCancel(ctx)
+	var done = make(chan struct{})
+	go func() {
+		var t = time.NewTicker(l.ttl / 3)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+			case <-done:
+				return
+			case <-held.Done():
+				return
+			}
+			var ok, err = l.acquire()
+			if err != nil {
+				l.log.error("renewing lease:", err)
+				continue
+			}
+			if !ok {
+				l.log.warn("lost the lease at", l.path+", stopping the scan")
+				atomic.StoreInt32(&l.lostHold, 1)
+				cancel()
+				return
+			}
+		}
+	}()
+	return held, func() {
+		close(done)
+		cancel()
+	}
+}
+
+// lost reports whether the lease was lost during the scan being held. A
+// nil lease is never lost.
+func (l *lease) lost() bool {
+	return l != nil && atomic.LoadInt32(&l.lostHold) == 1
+}
+
+// standby reports whether to sit the next scan out, because another
+// replica holds the lease or it couldn't be checked. A nil lease never
+// stands by.
+func (l *lease) standby() bool {
+	if l == nil {
+		return false
+	}
+	var held, err = l.acquire()
+	if err != nil {
+		l.log.error("acquiring lease:", err)
+		return true
+	}
+	if !held {
+		l.log.info("another instance holds the lease at", l.path+", skipping the scan")
+	}
+	return !held
+}
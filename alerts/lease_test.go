@@ -0,0 +1,127 @@
+package alerts
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLeaseTakeoverHasOneHolder(t *testing.T) {
+	var dir = t.TempDir()
+	var path = filepath.Join(dir, "lease")
+
+	for i := 0; i < 50; i++ {
+		var err = ioutil.WriteFile(path, []byte("dead:1"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var stale = time.Now().Add(-time.Hour)
+		os.Chtimes(path, stale, stale)
+
+		var contenders = []*lease{
+			{path: path, ttl: 30 * time.Minute, now: time.Now, id: "a"},
+			{path: path, ttl: 30 * time.Minute, now: time.Now, id: "b"},
+		}
+		var held = make([]bool, len(contenders))
+		var start = make(chan struct{})
+		var wg sync.WaitGroup
+		for j, l := range contenders {
+			wg.Add(1)
+			go func(j int, l *lease) {
+				defer wg.Done()
+				<-start
+				var err error
+				held[j], err = l.acquire()
+				if err != nil {
+					t.Error(err)
+				}
+			}(j, l)
+		}
+		close(start)
+		wg.Wait()
+
+		if held[0] == held[1] {
+			t.Fatalf("round %d: a holds %v, b holds %v, want exactly one", i, held[0], held[1])
+		}
+		var b, _ = ioutil.ReadFile(path)
+		var winner = contenders[0]
+		if held[1] {
+			winner = contenders[1]
+		}
+		if string(b) != winner.id {
+			t.Fatalf("round %d: lease names %q, but %s holds it", i, b, winner.id)
+		}
+	}
+
+	var files, _ = ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("%d files left beside the lease", len(files)-1)
+	}
+}
+
+func TestLeaseStandbyUntilReleased(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "lease")
+	var a = &lease{path: path, ttl: time.Minute, now: time.Now, id: "a"}
+	var b = &lease{path: path, ttl: time.Minute, now: time.Now, id: "b"}
+
+	if a.standby() {
+		t.Fatal("a stood by with no lease taken")
+	}
+	if !b.standby() {
+		t.Fatal("b didn't stand by while a holds the lease")
+	}
+	if a.standby() {
+		t.Fatal("a stood by renewing its own lease")
+	}
+
+	// b doesn't hold the lease, so its release leaves it be.
+	var err = b.release()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !b.standby() {
+		t.Fatal("b's release gave up a's lease")
+	}
+	err = a.release()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.standby() {
+		t.Error("b stood by after a released the lease")
+	}
+}
+
+func TestLeaseLostDuringScan(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "lease")
+	var l = &lease{path: path, ttl: 30 * time.Millisecond, now: time.Now, id: "a"}
+	var ok, err = l.acquire()
+	if !ok || err != nil {
+		t.Fatal("acquiring the lease:", ok, err)
+	}
+
+	var ctx, stop = l.hold(context.Background())
+	defer stop()
+
+	// Renewals keep the lease while it's still this process's.
+	time.Sleep(50 * time.Millisecond)
+	if ctx.Err() != nil || l.lost() {
+		t.Fatal("lease lost while still held")
+	}
+
+	err = ioutil.WriteFile(path, []byte("b"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("scan not stopped after the lease was taken over")
+	}
+	if !l.lost() {
+		t.Error("lost doesn't report the takeover")
+	}
+}
@@ -0,0 +1,143 @@
+package alerts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log message.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = [...]string{"DEBUG", "INFO", "WARN", "ERROR"}
+
+// parseLevel returns the level named s, e.g. warn, in any case.
+func parseLevel(s string) (Level, error) {
+	for l, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(l), nil
+		}
+	}
+	return 0, errors.New("unknown log level " + s + ", use debug, info, warn or error")
+}
+
+// logger logs a run's messages with its settings, so runs in the same
+// process don't share them. A nil logger logs at info and above, as text.
+type logger struct {
+	// min is the least severe level that gets logged.
+	min Level
+	// json writes messages to the standard logger's output as JSON lines
+	// instead of text, for log aggregators.
+	json bool
+	// sink, when set, takes every message that gets logged instead of the
+	// standard logger, e.g. to send it to syslog.
+	sink func(l Level, msg string)
+}
+
+// newLogger returns the logger for cfg's log settings, which LoadConfig
+// has checked.
+func newLogger(cfg *Config) *logger {
+	var lg = &logger{min: LevelInfo, json: cfg.LogJSON}
+	if cfg.Debug {
+		lg.min = LevelDebug
+	}
+	if cfg.Quiet {
+		lg.min = LevelError
+	}
+	if cfg.LogLevel != "" {
+		lg.min, _ = parseLevel(cfg.LogLevel)
+	}
+	return lg
+}
+
+// processLog logs what isn't part of any run, e.g. a signal arriving.
+var processLog = &logger{min: LevelInfo}
+
+// logMu keeps JSON lines from interleaving.
+var logMu sync.Mutex
+
+// logField is a piece of context for a log message, e.g. the zip a search
+// failed for. Text logs show it as key=value, and JSON logs as a key of
+// its own.
+type logField struct {
+	key   string
+	value interface{}
+}
+
+// field returns the log field key with value v.
+func field(key string, v interface{}) logField {
+	return logField{key: key, value: v}
+}
+
+func (f logField) String() string {
+	return f.key + "=" + fmt.Sprint(f.value)
+}
+
+// at logs v, in the manner of log.Println, if l is at least lg's minimum.
+func (lg *logger) at(l Level, v ...interface{}) {
+	if lg == nil {
+		lg = processLog
+	}
+	if l < lg.min {
+		return
+	}
+	if lg.sink != nil {
+		lg.sink(l, strings.TrimSuffix(fmt.Sprintln(v...), "\n"))
+		return
+	}
+	if lg.json {
+		writeJSONLog(time.Now(), l, v)
+		return
+	}
+	log.Println(append([]interface{}{levelNames[l]}, v...)...)
+}
+
+// writeJSONLog writes v as a JSON line with its time, level and message,
+// and a key for each of its fields.
+func writeJSONLog(now time.Time, l Level, v []interface{}) {
+	var entry = map[string]interface{}{
+		"time":  now.Format(time.RFC3339Nano),
+		"level": strings.ToLower(levelNames[l]),
+	}
+	var msg = make([]interface{}, 0, len(v))
+	for _, x := range v {
+		var f, ok = x.(logField)
+		if !ok {
+			msg = append(msg, x)
+			continue
+		}
+		switch value := f.value.(type) {
+		case error:
+			entry[f.key] = value.Error()
+		case fmt.Stringer:
+			entry[f.key] = value.String()
+		default:
+			entry[f.key] = value
+		}
+	}
+	entry["msg"] = strings.TrimSuffix(strings.TrimSuffix(fmt.Sprintln(msg...), "\n"), ":")
+
+	var b, err = json.Marshal(entry)
+	if err != nil {
+		b, _ = json.Marshal(map[string]string{"level": "error", "msg": "logging: " + err.Error()})
+	}
+	logMu.Lock()
+	defer logMu.Unlock()
+	log.Writer().Write(append(b, '\n'))
+}
+
+func (lg *logger) debug(v ...interface{}) { lg.at(LevelDebug, v...) }
+func (lg *logger) info(v ...interface{})  { lg.at(LevelInfo, v...) }
+func (lg *logger) warn(v ...interface{})  { lg.at(LevelWarn, v...) }
+func (lg *logger) error(v ...interface{}) { lg.at(LevelError, v...) }
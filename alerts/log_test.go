@@ -0,0 +1,50 @@
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestLoggersKeepTheirSettings(t *testing.T) {
+	var buf bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&buf)
+
+	var quiet, err = parseConfig([]string{"-quiet"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var verbose *Config
+	verbose, err = parseConfig([]string{"-log-level", "debug", "-log-json"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	quiet.log.info("from the quiet run")
+	if buf.Len() > 0 {
+		t.Fatalf("quiet run logged %q", buf.String())
+	}
+	verbose.log.debug("from the verbose run", field("zip", "94103"))
+	var entry map[string]interface{}
+	err = json.Unmarshal(buf.Bytes(), &entry)
+	if err != nil {
+		t.Fatalf("verbose run logged %q, want a JSON line: %v", buf.String(), err)
+	}
+	if entry["level"] != "debug" || entry["msg"] != "from the verbose run" || entry["zip"] != "94103" {
+		t.Errorf("verbose run logged %v", entry)
+	}
+
+	buf.Reset()
+	quiet.log.error("quiet run failed")
+	if !strings.Contains(buf.String(), "ERROR quiet run failed") {
+		t.Errorf("quiet run logged %q, want a text error", buf.String())
+	}
+	buf.Reset()
+	processLog.debug("outside any run")
+	if buf.Len() > 0 {
+		t.Errorf("process log took the verbose run's level, logged %q", buf.String())
+	}
+}
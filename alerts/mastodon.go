@@ -0,0 +1,116 @@
+package alerts
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	EnvMastodonURL   = "MASTODON_URL"
+	EnvMastodonToken = "MASTODON_TOKEN"
+)
+
+func init() {
+	registerNotifier("mastodon", newMastodonNotifier)
+}
+
+// MastodonNotifier posts sites as toots to a Mastodon instance.
+type MastodonNotifier struct {
+	cfg    *Config
+	client *http.Client
+	// instance is the base URL of the instance, e.g. https://mastodon.social.
+	instance string
+	token    string
+}
+
+// newMastodonNotifier returns a notifier for the instance configured in the
+// environment, or nil if there isn't one.
+func newMastodonNotifier(cfg *Config) (Notifier, error) {
+	var instance, ok = os.LookupEnv(EnvMastodonURL)
+	if !ok {
+		return nil, nil
+	}
+
+	var token string
+	token, ok = os.LookupEnv(EnvMastodonToken)
+	if !ok {
+		return nil, errors.New("missing env variable " + EnvMastodonToken)
+	}
+
+	return &MastodonNotifier{
+		cfg:      cfg,
+		client:   &http.Client{Transport: baseTransport(cfg)},
+		instance: strings.TrimSuffix(instance, "/"),
+		token:    token,
+	}, nil
+}
+
+func (m *MastodonNotifier) Name() string {
+	return "mastodon"
+}
+
+func (m *MastodonNotifier) Format(loc *VaccineLocation) string {
+	return formatMessage(m.cfg, loc, m.cfg.MastodonLimit, tweetLength)
+}
+
+// Verify checks the access token against the instance.
+func (m *MastodonNotifier) Verify() error {
+	var req, err = http.NewRequest(http.MethodGet, m.instance+"/api/v1/accounts/verify_credentials", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+m.token)
+
+	var r *http.Response
+	r, err = m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer drainAndClose(r.Body)
+
+	if r.StatusCode >= http.StatusBadRequest {
+		return errors.New("unexpected status " + r.Status)
+	}
+	return nil
+}
+
+func (m *MastodonNotifier) Post(text string) error {
+	return m.PostKeyed(text, "")
+}
+
+// PostKeyed toots text with an idempotency key, which Mastodon drops the
+// copies of our retries by, should one of them have been posted after all.
+func (m *MastodonNotifier) PostKeyed(text, key string) error {
+	var form = url.Values{
+		"status":     {text},
+		"visibility": {m.cfg.MastodonVisibility},
+	}
+
+	var req, err = http.NewRequest(http.MethodPost, m.instance+"/api/v1/statuses", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+m.token)
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+
+	var r *http.Response
+	r, err = doWithRetry(m.cfg, m.client, req, NotifyAttempts)
+	if r != nil {
+		defer drainAndClose(r.Body)
+	}
+	if err != nil {
+		return err
+	}
+
+	if r.StatusCode >= http.StatusBadRequest {
+		return errors.New("unexpected status " + r.Status)
+	}
+
+	return nil
+}
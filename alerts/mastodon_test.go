@@ -0,0 +1,134 @@
+package alerts
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMastodonRetriesKeepTheKey(t *testing.T) {
+	var keys []string
+	var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get(IdempotencyKeyHeader))
+		if len(keys) == 1 {
+			// Accepted, but the response is lost, as far as we know.
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"id": "1"}`))
+	}))
+	defer srv.Close()
+
+	var day = time.Date(2021, 4, 15, 10, 0, 0, 0, time.UTC)
+	var cfg = &Config{Now: func() time.Time { return day }, MastodonVisibility: "public"}
+	var m = &MastodonNotifier{cfg: cfg, client: srv.Client(), instance: srv.URL, token: "token"}
+	var site = &notification{loc: &VaccineLocation{ExtID: "a", Name: "Site A"}}
+
+	var sent, failed = deliver(cfg, []Notifier{m}, []*notification{site}, &Summary{})
+	if !sent[0] || len(failed) != 0 {
+		t.Fatal("toot not sent")
+	}
+	if len(keys) != 2 || keys[0] == "" || keys[0] != keys[1] {
+		t.Fatalf("keys sent = %q, want the same one on the retry", keys)
+	}
+	if keys[0] != site.key(day) {
+		t.Errorf("key = %s, want the notification's %s", keys[0], site.key(day))
+	}
+}
+
+func TestNotificationKey(t *testing.T) {
+	var day = time.Date(2021, 4, 15, 10, 0, 0, 0, time.UTC)
+	var a = &notification{loc: &VaccineLocation{ExtID: "a", Name: "Site A"}}
+	var key = a.key(day)
+
+	var cases = []struct {
+		name string
+		n    *notification
+		at   time.Time
+		same bool
+	}{
+		{"same site later that day", &notification{loc: &VaccineLocation{ExtID: "a", Name: "Site A, renamed"}}, day.Add(8 * time.Hour), true},
+		{"same site the next day", a, day.Add(24 * time.Hour), false},
+		{"another site", &notification{loc: &VaccineLocation{ExtID: "b", Name: "Site A"}}, day, false},
+		{"a summary", &notification{text: "3 sites open"}, day, false},
+	}
+	for _, c := range cases {
+		if got := c.n.key(c.at); (got == key) != c.same {
+			t.Errorf("%s: key %s, same as %s = %v, want %v", c.name, got, key, got == key, c.same)
+		}
+	}
+	if (&notification{text: "3 sites open"}).key(day) != (&notification{text: "3 sites open"}).key(day) {
+		t.Error("summaries of the same text keyed differently")
+	}
+}
+
+func TestMastodonPostsToots(t *testing.T) {
+	var toots []string
+	var mux = http.NewServeMux()
+	mux.HandleFunc("/api/v1/accounts/verify_credentials", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"id": "1", "username": "vaccinealerts"}`))
+	})
+	mux.HandleFunc("/api/v1/statuses", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("got %s with Authorization %q, want a POST with the token", r.Method, r.Header.Get("Authorization"))
+		}
+		if got := r.FormValue("visibility"); got != "unlisted" {
+			t.Errorf("got visibility %q, want unlisted", got)
+		}
+		if r.FormValue("status") == "" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		toots = append(toots, r.FormValue("status"))
+		w.Write([]byte(`{"id": "2"}`))
+	})
+	var srv = httptest.NewServer(mux)
+	defer srv.Close()
+
+	var cfg, err = parseConfig([]string{"-mastodon-visibility", "unlisted", "-mastodon-limit", "300", "-state-file="}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setenv(t, EnvMastodonURL, srv.URL+"/")
+	setenv(t, EnvMastodonToken, "token")
+	var n Notifier
+	n, err = newMastodonNotifier(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m = n.(*MastodonNotifier)
+
+	err = m.Verify()
+	if err != nil {
+		t.Errorf("verifying: %v", err)
+	}
+	var loc = &VaccineLocation{Name: "Moscone Center", DisplayAddress: strings.Repeat("747 Howard St ", 40)}
+	var text = m.Format(loc)
+	if tweetLength(text) > 300 || !strings.HasPrefix(text, "Moscone Center\n747 Howard St") {
+		t.Errorf("got a %d character toot %q, want the site within the limit of 300", tweetLength(text), text)
+	}
+	err = m.Post(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toots) != 1 || toots[0] != text {
+		t.Errorf("tooted %q, want the site's message", toots)
+	}
+
+	err = m.Post("")
+	if err == nil || !strings.Contains(err.Error(), "422") {
+		t.Errorf("err = %v, want the rejection reported", err)
+	}
+	m.token = "revoked"
+	err = m.Verify()
+	if err == nil {
+		t.Error("verified a revoked token")
+	}
+}
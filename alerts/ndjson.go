@@ -0,0 +1,115 @@
+package alerts
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+)
+
+// The formats the data file can be in.
+const (
+	// FormatAuto tells the formats apart by the data's first character.
+	FormatAuto = "auto"
+	// FormatJSON is a single JSON array of records.
+	FormatJSON = "json"
+	// FormatNDJSON is newline-delimited JSON, one record per line.
+	FormatNDJSON = "ndjson"
+)
+
+// openData opens the data file at path for reading, transparently
+// decompressing it if it's gzipped, as told by its magic bytes rather than
+// its name. Closing the returned closer closes the file. An empty path
+// reads the data bundled into the binary.
+func openData(path string) (*bufio.Reader, io.Closer, error) {
+	var f io.ReadCloser = ioutil.NopCloser(bytes.NewReader(bundledData))
+	if path != "" {
+		var file, err = os.Open(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		f = file
+	}
+
+	var br = bufio.NewReader(f)
+	var magic, err = br.Peek(2)
+	if err != nil || magic[0] != 0x1f || magic[1] != 0x8b {
+		// Too short to be gzip, so whatever it is is left to the decoder.
+		return br, f, nil
+	}
+
+	var gz *gzip.Reader
+	gz, err = gzip.NewReader(br)
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("decompressing: %w", err)
+	}
+	return bufio.NewReader(gz), f, nil
+}
+
+// maxLine bounds the length of a single NDJSON record.
+const maxLine = 1 << 20
+
+// dataFormat resolves format for the data read through r. FormatAuto is
+// detected by peeking at the first non-space byte, without consuming any:
+// an array is FormatJSON, anything else FormatNDJSON.
+func dataFormat(format string, r *bufio.Reader) (string, error) {
+	if format != FormatAuto {
+		return format, nil
+	}
+
+	for n := 1; ; n++ {
+		var b, err = r.Peek(n)
+		if err == io.EOF {
+			return FormatJSON, nil
+		}
+		if err != nil {
+			return "", err
+		}
+
+		switch b[n-1] {
+		case ' ', '\t', '\r', '\n':
+		case '[':
+			return FormatJSON, nil
+		default:
+			return FormatNDJSON, nil
+		}
+	}
+}
+
+// decodeNDJSON decodes the records in r, one per line, with decode, passing
+// each to emit. Blank lines are ignored, and lines that aren't a valid
+// record are skipped with a warning rather than failing the whole file,
+// and counted in skipped. It stops at the first error emit returns.
+func decodeNDJSON(log *logger, r io.Reader, decode func([]byte) (*ZipToLatLong, error), emit func(*ZipToLatLong) error) (skipped int, err error) {
+	var s = bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64<<10), maxLine)
+
+	var line int
+	for s.Scan() {
+		line++
+		var b = bytes.TrimSpace(s.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+
+		var z *ZipToLatLong
+		z, err = decodeValid(decode, b)
+		if err != nil {
+			log.warn("skipping record on line", strconv.Itoa(line)+":", err)
+			skipped++
+			continue
+		}
+
+		err = emit(z)
+		if err != nil {
+			return skipped, err
+		}
+	}
+
+	return skipped, s.Err()
+}
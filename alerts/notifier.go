@@ -0,0 +1,495 @@
+package alerts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dghubble/go-twitter/twitter"
+)
+
+// Notifier announces vaccine sites somewhere, e.g. on Twitter.
+type Notifier interface {
+	// Name identifies the notifier in logs.
+	Name() string
+	// Format renders a single site as a message, within whatever limits
+	// and markup the notifier's service has.
+	Format(loc *VaccineLocation) string
+	// Post sends a message, either a formatted site or a free-form one
+	// such as a summary of several sites.
+	Post(text string) error
+}
+
+// keyedNotifier is a Notifier that can send an idempotency key with each
+// message, which receivers can drop the duplicates of retries by.
+type keyedNotifier interface {
+	PostKeyed(text, key string) error
+}
+
+// geoNotifier is a Notifier that can tag a message with where its site is.
+type geoNotifier interface {
+	PostAt(text string, at *Location) error
+}
+
+// digestNotifier is a Notifier that posts digests differently, e.g. as a
+// thread.
+type digestNotifier interface {
+	PostDigest(text string) error
+}
+
+// replyNotifier is a Notifier whose messages can be replied to later, by
+// the ID posting one returns.
+type replyNotifier interface {
+	// PostForReply posts text, geo-tagged at at if it's set, and returns
+	// the message's ID.
+	PostForReply(text string, at *Location) (string, error)
+	// Reply posts text as a reply to the message with the given ID.
+	Reply(text, id string) error
+}
+
+// notification is a single message to send through every notifier: either
+// one site, or a summary text covering several.
+type notification struct {
+	loc   *VaccineLocation
+	text  string
+	sites []*VaccineLocation
+	// only, if set, names the one notifier to send through, e.g. when
+	// replaying a message it failed to send before.
+	only string
+	// at is when n was first sent, which its idempotency key is based on.
+	// Zero means now.
+	at time.Time
+	// digest is set on daily digests, which don't count towards the dedup
+	// window.
+	digest bool
+	// replyID is the ID of the message a replyNotifier sent of a single
+	// site, with -reply-closed.
+	replyID string
+}
+
+// render returns the message n is sent to a notifier as.
+func (n *notification) render(to Notifier) string {
+	if n.loc != nil {
+		return to.Format(n.loc)
+	}
+	return n.text
+}
+
+// key returns the idempotency key of n: a hash of its site's ExtID, or of
+// its text if it isn't a single site, and the day it's sent on, in the
+// site's timezone. It's the same however often n is sent that day.
+func (n *notification) key(now time.Time) string {
+	if !n.at.IsZero() {
+		now = n.at
+	}
+
+	var id = "text:" + n.text
+	if n.loc != nil {
+		id = "site:" + n.loc.ExtID
+		if n.loc.ExtID == "" {
+			id = "name:" + string(n.loc.Name)
+		}
+		now = n.loc.Zone.in(now)
+	}
+
+	var sum = sha256.Sum256([]byte(id + "\n" + now.Format(DateFormat)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// message is a rendered notification, queued for a notifier.
+type message struct {
+	i    int
+	text string
+	key  string
+	// at is where the message's site is, if it's geo-tagged.
+	at *Location
+	// digest is set if the message is a daily digest.
+	digest bool
+}
+
+// send posts m through n, with whatever extras n supports.
+func send(n Notifier, m message) error {
+	if d, ok := n.(digestNotifier); ok && m.digest {
+		return d.PostDigest(m.text)
+	}
+	if g, ok := n.(geoNotifier); ok && m.at != nil {
+		return g.PostAt(m.text, m.at)
+	}
+	if k, ok := n.(keyedNotifier); ok {
+		return k.PostKeyed(m.text, m.key)
+	}
+	return n.Post(m.text)
+}
+
+// deliver sends every notification through every notifier, logging and
+// counting failures without letting them stop the others. Notifiers run in
+// parallel, each sending up to concurrency[name] notifications at a time,
+// one by default so their order is kept. Each renders at most
+// cfg.NotifyBuffer messages ahead of those it's sending, waiting for it to
+// catch up past that. A notification that renders to
+// the exact text of an earlier one is only sent once per notifier, since
+// e.g. Twitter rejects duplicate statuses. It reports, per notification,
+// whether any notifier sent it, counting duplicates as sent along with
+// the original. Messages that failed to send are returned as dead letters.
+// Messages due in a notifier's quiet hours aren't sent; with QuietQueue
+// they're returned as dead letters too, counting as sent since they will
+// be once replayed.
+func deliver(cfg *Config, notifiers []Notifier, pending []*notification, summary *Summary) ([]bool, []*deadLetter) {
+	var sent = make([]bool, len(pending))
+	var dupOf = make(map[int]int)
+	var failed []*deadLetter
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, n := range notifiers {
+		var workers = cfg.NotifyConcurrency[n.Name()]
+		if workers < 1 {
+			workers = 1
+		}
+
+		var jobs = make(chan message, cfg.NotifyBuffer)
+		go func(n Notifier) {
+			defer close(jobs)
+			if t, ok := n.(threadNotifier); ok && cfg.Thread && !cfg.QuietHours[n.Name()].contains(cfg.Now()) {
+				startThread(cfg.log, t, pending)
+			}
+			var seen = make(map[string]int)
+			for i, p := range pending {
+				if p.only != "" && p.only != n.Name() {
+					continue
+				}
+				if cfg.QuietHours[n.Name()].contains(cfg.Now()) {
+					cfg.log.debug("holding", n.Name(), "message during quiet hours")
+					mu.Lock()
+					summary.NotificationsHeld++
+					if cfg.QuietQueue {
+						failed = append(failed, newDeadLetter(cfg.Now(), n.Name(), p, errQuietHours))
+						sent[i] = true
+					}
+					mu.Unlock()
+					continue
+				}
+				var text = p.render(n)
+				if first, ok := seen[text]; ok {
+					cfg.log.info("not sending duplicate", n.Name(), "message:", text)
+					mu.Lock()
+					dupOf[i] = first
+					mu.Unlock()
+					continue
+				}
+				seen[text] = i
+				var m = message{i: i, text: text, key: p.key(cfg.Now()), digest: p.digest}
+				if cfg.GeoTag && p.loc != nil {
+					m.at = p.loc.Location
+				}
+				select {
+				case jobs <- m:
+				default:
+					if cfg.NotifyBuffer > 0 {
+						cfg.log.debug("waiting for", n.Name(), "to catch up, with", cfg.NotifyBuffer, "messages queued")
+					}
+					jobs <- m
+				}
+			}
+		}(n)
+
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func(n Notifier) {
+				defer wg.Done()
+				for m := range jobs {
+					var err error
+					var replyID string
+					if r, ok := n.(replyNotifier); ok && cfg.ReplyClosed && pending[m.i].loc != nil {
+						replyID, err = r.PostForReply(m.text, m.at)
+					} else {
+						err = send(n, m)
+					}
+
+					mu.Lock()
+					if replyID != "" {
+						pending[m.i].replyID = replyID
+					}
+					if err != nil {
+						summary.NotifyErrors++
+						cfg.log.error("notifying:", field("notifier", n.Name()), field("error", err))
+						failed = append(failed, newDeadLetter(cfg.Now(), n.Name(), pending[m.i], err))
+						for _, v := range pending[m.i].sites {
+							summary.Unsent = append(summary.Unsent, n.Name()+": "+string(v.Name))
+						}
+					} else {
+						summary.Notifications++
+						sent[m.i] = true
+						if loc := pending[m.i].loc; loc != nil {
+							cfg.log.info("notified", n.Name(), "of", loc.Name, "found searching", loc.OriginZip)
+						}
+					}
+					mu.Unlock()
+				}
+			}(n)
+		}
+	}
+
+	wg.Wait()
+	for _, n := range notifiers {
+		if t, ok := n.(threadNotifier); ok {
+			t.EndThread()
+		}
+	}
+	for i, first := range dupOf {
+		if sent[first] {
+			sent[i] = true
+		}
+	}
+	return sent, failed
+}
+
+// TwitterNotifier tweets sites.
+type TwitterNotifier struct {
+	cfg    *Config
+	client *twitter.Client
+
+	// mu guards last, when the last tweet was posted, for -tweet-interval.
+	mu   sync.Mutex
+	last time.Time
+
+	// threadMu guards thread, the ID of the last tweet of the thread being
+	// posted with -thread, or zero outside one.
+	threadMu sync.Mutex
+	thread   int64
+}
+
+func (t *TwitterNotifier) Name() string {
+	return "twitter"
+}
+
+// Verify checks the account's credentials.
+func (t *TwitterNotifier) Verify() error {
+	var _, _, err = t.client.Accounts.VerifyCredentials(&twitter.AccountVerifyParams{})
+	return err
+}
+
+func (t *TwitterNotifier) Format(loc *VaccineLocation) string {
+	return formatTweet(t.cfg, loc)
+}
+
+func (t *TwitterNotifier) Post(text string) error {
+	var _, err = t.postInThread(text, nil)
+	return err
+}
+
+// PostAt tweets text geo-tagged at the coordinates at. Twitter drops the
+// tag unless geo-tagging is enabled in the account's settings.
+func (t *TwitterNotifier) PostAt(text string, at *Location) error {
+	var _, err = t.postInThread(text, geoParams(at))
+	return err
+}
+
+// PostForReply tweets text, geo-tagged at at if it's set, and returns the
+// tweet's ID.
+func (t *TwitterNotifier) PostForReply(text string, at *Location) (string, error) {
+	var params *twitter.StatusUpdateParams
+	if at != nil {
+		params = geoParams(at)
+	}
+	var tweet, err = t.postInThread(text, params)
+	if err != nil {
+		return "", err
+	}
+	return tweet.IDStr, nil
+}
+
+// Reply tweets text as a reply to the tweet id. A tweet that's since been
+// deleted has nothing to reply to, which isn't an error.
+func (t *TwitterNotifier) Reply(text, id string) error {
+	var n, err = strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return errors.New("invalid tweet ID " + id)
+	}
+	_, err = t.update(text, &twitter.StatusUpdateParams{InReplyToStatusID: n})
+	if replyTargetGone(err) {
+		t.cfg.log.info("not replying to tweet", id, "as it's gone")
+		return nil
+	}
+	return err
+}
+
+// update posts a tweet, at least TweetInterval after the last one. While
+// Twitter answers 429 Too Many Requests, it waits for the rate limit to
+// reset and tries again, up to TweetAttempts times in all, taking each
+// retry from the scan's retry budget. It isn't retried below the OAuth
+// signing, as that would send a stale nonce and timestamp. Either wait
+// ends early, failing the tweet, once the run is cancelled.
+func (t *TwitterNotifier) update(text string, params *twitter.StatusUpdateParams) (*twitter.Tweet, error) {
+	for attempt := 1; ; attempt++ {
+		var err = t.pace()
+		if err != nil {
+			return nil, err
+		}
+		var tweet *twitter.Tweet
+		var r *http.Response
+		tweet, r, err = t.client.Statuses.Update(text, params)
+		if err == nil || r == nil || r.StatusCode != http.StatusTooManyRequests {
+			return tweet, err
+		}
+		if attempt >= t.cfg.TweetAttempts || !t.cfg.retries.take() {
+			return nil, fmt.Errorf("rate limited after %d attempts: %w", attempt, err)
+		}
+		var wait = rateLimitWait(r.Header, t.cfg.Now(), retryBase<<(attempt-1))
+		t.cfg.log.warn("rate limited by Twitter, waiting:", field("wait", wait), field("attempt", attempt))
+		err = sleep(t.cfg.ctx, wait)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// pace waits until TweetInterval has passed since the last tweet, and
+// claims the next slot. It fails, claiming none, if the run is cancelled
+// first.
+func (t *TwitterNotifier) pace() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cfg.TweetInterval <= 0 {
+		return nil
+	}
+	var now = t.cfg.Now()
+	if wait := t.last.Add(t.cfg.TweetInterval).Sub(now); wait > 0 {
+		var err = sleep(t.cfg.ctx, wait)
+		if err != nil {
+			return err
+		}
+		now = now.Add(wait)
+	}
+	t.last = now
+	return nil
+}
+
+// rateLimitWait is how long to wait before retrying a rate limited tweet:
+// until the x-rate-limit-reset time Twitter sends, in Unix seconds, else
+// as long as Retry-After asks, else backoff. It's capped at maxRetryAfter.
+func rateLimitWait(h http.Header, now time.Time, backoff time.Duration) time.Duration {
+	if secs, err := strconv.ParseInt(h.Get("x-rate-limit-reset"), 10, 64); err == nil {
+		var d = time.Unix(secs, 0).Sub(now)
+		if d < 0 {
+			d = 0
+		}
+		if d > maxRetryAfter {
+			d = maxRetryAfter
+		}
+		return d
+	}
+	if d, ok := retryAfter(h.Get("Retry-After"), now); ok {
+		return d
+	}
+	return backoff
+}
+
+// geoParams returns the parameters of a tweet geo-tagged at at, showing
+// its exact coordinates.
+func geoParams(at *Location) *twitter.StatusUpdateParams {
+	return &twitter.StatusUpdateParams{
+		Lat:                twitter.Float(at.Lat),
+		Long:               twitter.Float(at.Long),
+		DisplayCoordinates: twitter.Bool(true),
+	}
+}
+
+// newTwitterNotifier returns a notifier for the account configured in the
+// environment, or nil if none of its variables are set. Setting only some
+// of them is an error.
+func newTwitterNotifier(cfg *Config) (Notifier, error) {
+	var configured bool
+	for _, env := range []string{EnvAPIKey, EnvAPISecret, EnvAccessToken, EnvAccessSecret} {
+		if _, ok := os.LookupEnv(env); ok {
+			configured = true
+		}
+	}
+	if !configured {
+		return nil, nil
+	}
+
+	var client, err = twitterClient(baseTransport(cfg))
+	if err != nil {
+		return nil, err
+	}
+	return &TwitterNotifier{cfg: cfg, client: client}, nil
+}
+
+// notifierRegistry maps the name of every kind of notifier to its
+// constructor, which returns nil if the notifier isn't configured.
+var notifierRegistry = make(map[string]func(*Config) (Notifier, error))
+
+// registerNotifier adds a kind of notifier to the registry. Each backend
+// registers itself from an init function in its own file.
+func registerNotifier(name string, build func(*Config) (Notifier, error)) {
+	if _, ok := notifierRegistry[name]; ok {
+		panic("notifier " + name + " registered twice")
+	}
+	notifierRegistry[name] = build
+}
+
+func init() {
+	registerNotifier("twitter", newTwitterNotifier)
+}
+
+// dryRunNotifier writes the messages its notifier would post to w instead,
+// for -dry-run. Only the Notifier methods are passed through, so digests,
+// replies and the like are shown as plain posts.
+type dryRunNotifier struct {
+	Notifier
+	w io.Writer
+}
+
+// dryRunMu keeps messages printed at once from interleaving.
+var dryRunMu sync.Mutex
+
+func (d *dryRunNotifier) Post(text string) error {
+	dryRunMu.Lock()
+	defer dryRunMu.Unlock()
+	var _, err = fmt.Fprintf(d.w, "--- %s\n%s\n\n", d.Name(), text)
+	return err
+}
+
+// newNotifiers builds the notifiers named in cfg.Notifiers, or by default
+// every registered notifier that's configured.
+func newNotifiers(cfg *Config) ([]Notifier, error) {
+	var names = cfg.Notifiers
+	var explicit = len(names) > 0
+	if !explicit {
+		for name := range notifierRegistry {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	var notifiers []Notifier
+	for _, name := range names {
+		var build, ok = notifierRegistry[name]
+		if !ok {
+			return nil, errors.New("unknown notifier " + name)
+		}
+
+		var n, err = build(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed initializing %s notifier: %w", name, err)
+		}
+		if n == nil {
+			if explicit {
+				return nil, errors.New("notifier " + name + " is not configured")
+			}
+			continue
+		}
+		notifiers = append(notifiers, n)
+	}
+
+	return notifiers, nil
+}
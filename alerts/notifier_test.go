@@ -0,0 +1,324 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowNotifier sends a message each time release is.
+type slowNotifier struct {
+	release chan struct{}
+
+	mu        sync.Mutex
+	formatted int
+	posted    int
+}
+
+func (n *slowNotifier) Name() string { return "slow" }
+
+func (n *slowNotifier) Format(loc *VaccineLocation) string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.formatted++
+	return string(loc.Name)
+}
+
+func (n *slowNotifier) Post(text string) error {
+	<-n.release
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.posted++
+	return nil
+}
+
+// queued returns how many messages n has formatted but not posted.
+func (n *slowNotifier) queued() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.formatted - n.posted
+}
+
+func TestDeliverBoundsQueue(t *testing.T) {
+	for _, buffer := range []int{0, 3} {
+		t.Run("buffer "+strconv.Itoa(buffer), func(t *testing.T) {
+			var cfg = &Config{Now: time.Now, NotifyBuffer: buffer}
+			var pending []*notification
+			for i := 0; i < 20; i++ {
+				pending = append(pending, &notification{loc: &VaccineLocation{ExtID: strconv.Itoa(i), Name: SiteName("Site " + strconv.Itoa(i))}})
+			}
+			var n = &slowNotifier{release: make(chan struct{})}
+
+			var done = make(chan []bool)
+			go func() {
+				var sent, _ = deliver(cfg, []Notifier{n}, pending, &Summary{})
+				done <- sent
+			}()
+
+			// One message is being sent, buffer are queued, and one more
+			// is waiting to be.
+			var most = buffer + 2
+			var deadline = time.Now().Add(time.Second)
+			for n.queued() < most && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			if q := n.queued(); q != most {
+				t.Errorf("%d messages queued before any was sent, want %d", q, most)
+			}
+			for i := 0; i < len(pending); i++ {
+				time.Sleep(time.Millisecond)
+				if q := n.queued(); q > most {
+					t.Fatalf("%d messages queued, want at most %d", q, most)
+				}
+				n.release <- struct{}{}
+			}
+
+			var sent = <-done
+			for i, ok := range sent {
+				if !ok {
+					t.Errorf("message %d not sent", i)
+				}
+			}
+			if n.posted != len(pending) {
+				t.Errorf("posted %d messages, want %d", n.posted, len(pending))
+			}
+		})
+	}
+}
+
+func TestTweetWaitEndsWithRun(t *testing.T) {
+	var ctx, cancel = context.WithCancel(context.Background())
+	var cfg = &Config{Now: time.Now, TweetInterval: time.Hour, ctx: ctx}
+	var n = &TwitterNotifier{cfg: cfg, last: time.Now()}
+
+	var done = make(chan error)
+	go func() { done <- n.pace() }()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("pace = %v, want it cancelled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("pace still waiting after the run was cancelled")
+	}
+}
+
+func TestNotifierRetriesUntilSent(t *testing.T) {
+	var cases = []struct {
+		name     string
+		failures []int
+		posts    int
+		sent     bool
+	}{
+		{"fails twice", []int{http.StatusInternalServerError, http.StatusTooManyRequests}, 3, true},
+		{"keeps failing", []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway}, NotifyAttempts, false},
+		{"rejected", []int{http.StatusBadRequest}, 1, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var posts, delivered int
+			var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				posts++
+				if posts <= len(c.failures) {
+					w.Header().Set("Retry-After", "0")
+					w.WriteHeader(c.failures[posts-1])
+					return
+				}
+				delivered++
+			}))
+			defer srv.Close()
+
+			var cfg = &Config{Now: time.Now}
+			var w = &WebhookNotifier{cfg: cfg, client: srv.Client(), url: srv.URL}
+			var summary = &Summary{}
+			var sent, failed = deliver(cfg, []Notifier{w}, []*notification{{text: "Site A is open"}}, summary)
+
+			if posts != c.posts {
+				t.Errorf("posted %d times, want %d", posts, c.posts)
+			}
+			if sent[0] != c.sent || (len(failed) == 0) != c.sent {
+				t.Errorf("sent = %v with %d dead letters, want sent %v", sent[0], len(failed), c.sent)
+			}
+			if c.sent && (delivered != 1 || summary.Notifications != 1 || summary.NotifyErrors != 0) {
+				t.Errorf("delivered %d times, counted %d sent and %d failed, want it once", delivered, summary.Notifications, summary.NotifyErrors)
+			}
+		})
+	}
+}
+
+// shortNotifier sends only the first word of each site's name, so sites
+// sharing it render the same.
+type shortNotifier struct {
+	recordingNotifier
+}
+
+func (n *shortNotifier) Name() string { return "short" }
+
+func (n *shortNotifier) Format(loc *VaccineLocation) string {
+	return strings.Fields(string(loc.Name))[0]
+}
+
+func TestDeliverDropsDuplicateText(t *testing.T) {
+	var cfg, err = parseConfig([]string{"-state-file="}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var full = &recordingNotifier{cfg: cfg}
+	var short = &shortNotifier{}
+	var pending = []*notification{
+		{loc: &VaccineLocation{ExtID: "a", Name: "Moscone North"}},
+		{loc: &VaccineLocation{ExtID: "b", Name: "Moscone South"}},
+		// c is a's listing again under another ID.
+		{loc: &VaccineLocation{ExtID: "c", Name: "Moscone North"}},
+	}
+	var summary = &Summary{}
+	var sent, failed = deliver(cfg, []Notifier{full, short}, pending, summary)
+
+	sort.Strings(full.sent)
+	if len(full.sent) != 2 || !strings.HasPrefix(full.sent[0], "Moscone North\n") || !strings.HasPrefix(full.sent[1], "Moscone South\n") {
+		t.Errorf("full notifier sent %q, want north and south once each", full.sent)
+	}
+	if !reflect.DeepEqual(short.sent, []string{"Moscone"}) {
+		t.Errorf("short notifier sent %q, want its one text once", short.sent)
+	}
+	if !reflect.DeepEqual(sent, []bool{true, true, true}) || len(failed) != 0 {
+		t.Errorf("sent = %v with %d dead letters, want duplicates counted as sent", sent, len(failed))
+	}
+	if summary.Notifications != 3 {
+		t.Errorf("counted %d notifications, want 3 posts", summary.Notifications)
+	}
+}
+
+// inFlightServer answers after a pause, failing any request that arrives
+// while max others are being answered, and keeps the most it saw at once.
+func inFlightServer(max int32, most *int32) *httptest.Server {
+	var inFlight int32
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n = atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			var m = atomic.LoadInt32(most)
+			if n <= m || atomic.CompareAndSwapInt32(most, m, n) {
+				break
+			}
+		}
+		if n > max {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}))
+}
+
+func TestDeliverConcurrently(t *testing.T) {
+	var cases = []struct {
+		name    string
+		workers int
+	}{
+		{"serial by default", 0},
+		{"concurrent", 4},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var most int32
+			var want = int32(c.workers)
+			if want < 1 {
+				want = 1
+			}
+			var srv = inFlightServer(want, &most)
+			defer srv.Close()
+
+			var cfg = &Config{Now: time.Now, NotifyConcurrency: map[string]int{"webhook": c.workers}}
+			var w = &WebhookNotifier{cfg: cfg, client: srv.Client(), url: srv.URL}
+			var pending = make([]*notification, 20)
+			for i := range pending {
+				pending[i] = &notification{text: "site " + strconv.Itoa(i)}
+			}
+			var summary = &Summary{}
+			var sent, failed = deliver(cfg, []Notifier{w}, pending, summary)
+
+			if len(failed) != 0 || summary.Notifications != len(pending) {
+				t.Errorf("sent %d of %d with %d failed, want them all sent within the limit", summary.Notifications, len(pending), len(failed))
+			}
+			for i, ok := range sent {
+				if !ok {
+					t.Errorf("message %d not sent", i)
+				}
+			}
+			if most > want || (want > 1 && most < 2) {
+				t.Errorf("got up to %d messages in flight, want %d", most, want)
+			}
+		})
+	}
+}
+
+func TestNotifierRegistry(t *testing.T) {
+	for _, env := range []string{EnvAPIKey, EnvAPISecret, EnvAccessToken, EnvAccessSecret, EnvMastodonURL, EnvBlueskyHandle, EnvWebhookURL, EnvRedisURL} {
+		unsetenv(t, env)
+	}
+	var configured bool
+	var failure error
+	registerNotifier("recording", func(cfg *Config) (Notifier, error) {
+		if failure != nil || !configured {
+			return nil, failure
+		}
+		return &recordingNotifier{cfg: cfg}, nil
+	})
+	defer delete(notifierRegistry, "recording")
+
+	var cases = []struct {
+		name       string
+		notifiers  []string
+		configured bool
+		failure    error
+		want       int
+		err        string
+	}{
+		{"found", nil, true, nil, 1, ""},
+		{"not configured", nil, false, nil, 0, ""},
+		{"named", []string{"recording"}, true, nil, 1, ""},
+		{"named but not configured", []string{"recording"}, false, nil, 0, "notifier recording is not configured"},
+		{"failing", nil, true, errors.New("bad token"), 0, "failed initializing recording notifier: bad token"},
+		{"unknown", []string{"carrier pigeon"}, true, nil, 0, "unknown notifier carrier pigeon"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			configured, failure = c.configured, c.failure
+			var notifiers, err = newNotifiers(&Config{Notifiers: c.notifiers})
+			if c.err != "" {
+				if err == nil || err.Error() != c.err {
+					t.Fatalf("err = %v, want %q", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(notifiers) != c.want {
+				t.Fatalf("got %d notifiers, want %d", len(notifiers), c.want)
+			}
+			if c.want > 0 && notifiers[0].Name() != "recording" {
+				t.Errorf("got notifier %s, want the registered one", notifiers[0].Name())
+			}
+		})
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a notifier twice didn't panic")
+		}
+	}()
+	registerNotifier("recording", nil)
+}
@@ -0,0 +1,44 @@
+package alerts
+
+import (
+	"encoding/json"
+	"math/rand"
+	"os"
+	"sort"
+)
+
+// loadPopulation reads a JSON object mapping zip codes to their population,
+// e.g. {"94103": 27132}.
+func loadPopulation(path string) (map[string]int, error) {
+	var f, err = os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var out = make(map[string]int)
+	err = json.NewDecoder(f).Decode(&out)
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// sortByPopulation orders data so the most populous zips come first. Zips
+// missing from pop are treated as empty, and ties keep their original order,
+// so an empty map leaves data untouched.
+func sortByPopulation(data []*ZipToLatLong, pop map[string]int) {
+	sort.SliceStable(data, func(i, j int) bool {
+		return pop[data[i].Fields.Zip] > pop[data[j].Fields.Zip]
+	})
+}
+
+// shuffleZips randomly reorders data using seed, so truncated runs don't
+// always cover the same zips. The same seed always gives the same order.
+func shuffleZips(data []*ZipToLatLong, seed int64) {
+	var r = rand.New(rand.NewSource(seed))
+	r.Shuffle(len(data), func(i, j int) {
+		data[i], data[j] = data[j], data[i]
+	})
+}
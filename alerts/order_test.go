@@ -0,0 +1,43 @@
+package alerts
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestShuffleSeedGivesTheSameOrder(t *testing.T) {
+	var order = func(seed int64) []string {
+		var data = make([]*ZipToLatLong, 20)
+		for i := range data {
+			data[i] = &ZipToLatLong{}
+			data[i].Fields.Zip = strconv.Itoa(94100 + i)
+		}
+		shuffleZips(data, seed)
+		var zips = make([]string, len(data))
+		for i, z := range data {
+			zips[i] = z.Fields.Zip
+		}
+		return zips
+	}
+
+	var first = order(7)
+	if again := order(7); !reflect.DeepEqual(again, first) {
+		t.Errorf("seed 7 gave %v, then %v", first, again)
+	}
+	if other := order(8); reflect.DeepEqual(other, first) {
+		t.Errorf("seeds 7 and 8 both gave %v", first)
+	}
+
+	var sorted = append([]string(nil), first...)
+	sort.Strings(sorted)
+	if reflect.DeepEqual(sorted, first) {
+		t.Errorf("seed 7 left the zips in order")
+	}
+	for i, z := range sorted {
+		if z != strconv.Itoa(94100+i) {
+			t.Fatalf("shuffled %v isn't every zip once", first)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package alerts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// parallelRange calls f with every i below n, split into one contiguous
+// chunk per worker. f must only write to its own index's results, which
+// keeps the output in input order however the chunks are scheduled. One
+// worker or fewer runs f inline.
+func parallelRange(n, workers int, f func(i int)) {
+	if workers <= 1 || n < 2 {
+		for i := 0; i < n; i++ {
+			f(i)
+		}
+		return
+	}
+	if workers > n {
+		workers = n
+	}
+
+	var chunk = (n + workers - 1) / workers
+	var wg sync.WaitGroup
+	for start := 0; start < n; start += chunk {
+		var end = start + chunk
+		if end > n {
+			end = n
+		}
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			for i := start; i < end; i++ {
+				f(i)
+			}
+		}(start, end)
+	}
+	wg.Wait()
+}
+
+// decodeRecords decodes each of raw with decode across workers goroutines,
+// returning the valid records in order, and how many were skipped, with a
+// warning each, for not decoding or failing validRecord.
+func decodeRecords(log *logger, raw []json.RawMessage, workers int, decode func([]byte) (*ZipToLatLong, error)) ([]*ZipToLatLong, int) {
+	var out = make([]*ZipToLatLong, len(raw))
+	var errs = make([]error, len(raw))
+	parallelRange(len(raw), workers, func(i int) {
+		out[i], errs[i] = decodeValid(decode, raw[i])
+	})
+	var records = make([]*ZipToLatLong, 0, len(raw))
+	var skipped int
+	for i, err := range errs {
+		if err != nil {
+			log.warn("skipping record", strconv.Itoa(i+1)+":", err)
+			skipped++
+			continue
+		}
+		records = append(records, out[i])
+	}
+	return records, skipped
+}
+
+// decodeValid decodes a record with decode, failing if it isn't valid.
+func decodeValid(decode func([]byte) (*ZipToLatLong, error), b []byte) (*ZipToLatLong, error) {
+	var z, err = decode(b)
+	if err != nil {
+		return nil, err
+	}
+	err = validRecord(z)
+	if err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
+// decodeRecord decodes a record in the bundled data's shape. Fields it
+// doesn't know are ignored, since the export gains new ones now and then.
+func decodeRecord(b []byte) (*ZipToLatLong, error) {
+	var z = &ZipToLatLong{}
+	var err = json.Unmarshal(b, z)
+	if err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
+// California's bounds, with some slack, which every record's coordinates
+// must be within.
+const (
+	minLat  = 32.4
+	maxLat  = 42.1
+	minLong = -124.5
+	maxLong = -114.1
+)
+
+// validRecord reports why z can't be searched: it has no zip, or no
+// coordinates, or they're outside California.
+func validRecord(z *ZipToLatLong) error {
+	var lat, long = z.Fields.Latitude, z.Fields.Longitude
+	if z.Fields.Zip == "" {
+		return errors.New("no zip")
+	}
+	if lat == 0 && long == 0 {
+		return errors.New("no coordinates for zip " + z.Fields.Zip)
+	}
+	if lat < minLat || lat > maxLat || long < minLong || long > maxLong {
+		return fmt.Errorf("coordinates %v,%v of zip %s are outside California", lat, long, z.Fields.Zip)
+	}
+	return nil
+}
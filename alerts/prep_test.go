@@ -0,0 +1,64 @@
+package alerts
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// prepWorkers are the worker counts the preprocessing is compared at.
+var prepWorkers = []int{1, 2, 4, 8}
+
+// quietLog keeps the duplicates removed from the bundled data out of the
+// test output.
+var quietLog = &logger{min: LevelError}
+
+func TestPrepWorkersKeepOrder(t *testing.T) {
+	var want, _, err = parseJSONData(quietLog, "", "", nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sf = Location{Lat: 37.7749, Long: -122.4194}
+	var near = filterRadius(want, sf, 50, 1)
+	for _, w := range prepWorkers[1:] {
+		var got []*ZipToLatLong
+		got, _, err = parseJSONData(quietLog, "", "", nil, w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%d workers decoded the bundled data differently from one", w)
+		}
+		if !reflect.DeepEqual(filterRadius(got, sf, 50, w), near) {
+			t.Errorf("%d workers filtered the bundled data differently from one", w)
+		}
+	}
+}
+
+func BenchmarkParseBundledData(b *testing.B) {
+	for _, w := range prepWorkers {
+		b.Run(strconv.Itoa(w)+" workers", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				var _, _, err = parseJSONData(quietLog, "", "", nil, w)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkFilterBundledData(b *testing.B) {
+	var data, _, err = parseJSONData(quietLog, "", "", nil, 1)
+	if err != nil {
+		b.Fatal(err)
+	}
+	var sf = Location{Lat: 37.7749, Long: -122.4194}
+	for _, w := range prepWorkers {
+		b.Run(strconv.Itoa(w)+" workers", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				filterRadius(data, sf, 50, w)
+			}
+		})
+	}
+}
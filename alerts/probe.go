@@ -0,0 +1,65 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// probeLocation is the point the startup probe searches, downtown Los
+// Angeles, which always has sites nearby.
+var probeLocation = Location{Lat: 34.0522, Long: -118.2437}
+
+// probeAPI issues a single known-good search and warns if the API doesn't
+// answer the way the scan expects, e.g. because the endpoint moved or the
+// response changed shape. Decoding into Response would hide that, with
+// missing fields silently coming out empty.
+func probeAPI(ctx context.Context, cfg *Config, client *http.Client) {
+	var resp, err = searchLocations(ctx, cfg, client, newPostData(cfg, &probeLocation, cfg.Profiles[0]))
+	if err != nil {
+		cfg.log.warn("API probe failed, the endpoint or request may have changed:", err)
+		return
+	}
+
+	err = checkContract(resp.raw)
+	if err != nil {
+		cfg.log.warn("API probe got an unexpected response, its contract may have changed:", err)
+		return
+	}
+	cfg.log.debug("API probe found", len(resp.Locations), "sites")
+}
+
+// checkContract checks that a search response has the top-level fields
+// Response is decoded from. An empty body is fine, as it's how the API
+// says there's nothing nearby.
+func checkContract(raw []byte) error {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var fields map[string]json.RawMessage
+	var err = json.Unmarshal(raw, &fields)
+	if err != nil {
+		return errors.New("response is not a JSON object")
+	}
+
+	for _, name := range []string{"eligible", "locations"} {
+		if _, ok := fields[name]; !ok {
+			return errors.New("response has no " + name + " field")
+		}
+	}
+
+	var eligible bool
+	err = json.Unmarshal(fields["eligible"], &eligible)
+	if err != nil {
+		return errors.New("eligible is not a boolean")
+	}
+	var locations []json.RawMessage
+	err = json.Unmarshal(fields["locations"], &locations)
+	if err != nil {
+		return errors.New("locations is not an array")
+	}
+
+	return nil
+}
@@ -0,0 +1,30 @@
+package alerts
+
+import "testing"
+
+func TestCheckContract(t *testing.T) {
+	var cases = []struct {
+		body string
+		err  string
+	}{
+		{``, ""},
+		{`{"eligible": true, "locations": []}`, ""},
+		{`{"eligible": false, "locations": [{"extId": "a"}], "vaccineData": "x"}`, ""},
+		{`[]`, "response is not a JSON object"},
+		{`<html>`, "response is not a JSON object"},
+		{`{"locations": []}`, "response has no eligible field"},
+		{`{"eligible": true}`, "response has no locations field"},
+		{`{"eligible": "yes", "locations": []}`, "eligible is not a boolean"},
+		{`{"eligible": true, "locations": {}}`, "locations is not an array"},
+	}
+	for _, c := range cases {
+		var err = checkContract([]byte(c.body))
+		var got string
+		if err != nil {
+			got = err.Error()
+		}
+		if got != c.err {
+			t.Errorf("checkContract(%s) = %q, want %q", c.body, got, c.err)
+		}
+	}
+}
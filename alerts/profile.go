@@ -0,0 +1,74 @@
+package alerts
+
+import (
+	"net/http"
+	_ "net/http/pprof"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// startProfiling turns on whichever of the profiles in cfg are configured.
+// The returned stop writes the CPU and memory profiles out, and must be
+// called once the work being profiled is done.
+func startProfiling(cfg *Config) (func(), error) {
+	if cfg.PprofAddr != "" {
+		// The pprof handlers register themselves on the default mux,
+		// which nothing else serves.
+		go func() {
+			var err = http.ListenAndServe(cfg.PprofAddr, nil)
+			cfg.log.error("serving pprof:", err)
+		}()
+		cfg.log.info("serving pprof on", cfg.PprofAddr)
+	}
+
+	var cpu *os.File
+	if cfg.CPUProfile != "" {
+		var err error
+		cpu, err = os.Create(cfg.CPUProfile)
+		if err != nil {
+			return nil, err
+		}
+		err = pprof.StartCPUProfile(cpu)
+		if err != nil {
+			cpu.Close()
+			return nil, err
+		}
+	}
+
+	var stop = func() {
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			var err = cpu.Close()
+			if err != nil {
+				cfg.log.error("writing cpu profile:", err)
+			}
+		}
+
+		if cfg.MemProfile != "" {
+			var err = writeHeapProfile(cfg.MemProfile)
+			if err != nil {
+				cfg.log.error("writing memory profile:", err)
+			}
+		}
+	}
+	return stop, nil
+}
+
+// writeHeapProfile writes a heap profile of the allocations so far to path.
+func writeHeapProfile(path string) error {
+	var f, err = os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	// Collect garbage first, so the profile reflects live memory.
+	runtime.GC()
+	err = pprof.WriteHeapProfile(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,90 @@
+package alerts
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// progressWidth is the width of the bar itself, in characters.
+	progressWidth = 30
+	// progressEvery bounds how often the bar is redrawn.
+	progressEvery = 100 * time.Millisecond
+)
+
+// progress draws a progress bar of a scan on a terminal. A nil progress
+// draws nothing, so callers don't need to check whether it's enabled.
+type progress struct {
+	w     io.Writer
+	now   func() time.Time
+	total int
+	start time.Time
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+// newProgress returns a progress bar for a scan of total zips, or nil if
+// cfg doesn't ask for one or stdout isn't a terminal. total is zero when
+// it isn't known up front, in which case there's no bar or ETA, only the
+// counts.
+func newProgress(cfg *Config, total int) *progress {
+	if !cfg.Progress || cfg.Quiet || !isTerminal(os.Stdout) {
+		return nil
+	}
+	return &progress{w: os.Stdout, now: cfg.Now, total: total, start: cfg.Now()}
+}
+
+// isTerminal reports whether f is a terminal rather than a file or pipe.
+func isTerminal(f *os.File) bool {
+	var fi, err = f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// update redraws the bar with how many zips have been searched and sites
+// found so far. It's safe to call from several goroutines.
+func (p *progress) update(zips, sites int) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var now = p.now()
+	if now.Sub(p.last) < progressEvery && zips != p.total {
+		return
+	}
+	p.last = now
+
+	var line = fmt.Sprintf("%d zips, %d sites", zips, sites)
+	if p.total > 0 {
+		var filled = progressWidth * zips / p.total
+		if filled > progressWidth {
+			filled = progressWidth
+		}
+		var bar = strings.Repeat("#", filled) + strings.Repeat(".", progressWidth-filled)
+		line = fmt.Sprintf("[%s] %d/%d zips, %d sites", bar, zips, p.total, sites)
+
+		if zips > 0 && zips < p.total {
+			var elapsed = now.Sub(p.start)
+			var eta = time.Duration(float64(elapsed) / float64(zips) * float64(p.total-zips))
+			line += ", ETA " + eta.Round(time.Second).String()
+		}
+	}
+
+	// Pad over whatever is left of a longer previous line.
+	fmt.Fprintf(p.w, "\r%-80s", line)
+}
+
+// done ends the bar's line, so logs carry on below it.
+func (p *progress) done() {
+	if p == nil {
+		return
+	}
+	fmt.Fprintln(p.w)
+}
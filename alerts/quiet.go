@@ -0,0 +1,90 @@
+package alerts
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errQuietHours is the error messages held back during quiet hours are
+// queued as dead letters with.
+var errQuietHours = errors.New("held during quiet hours")
+
+// quietHours is a daily span of local time a notifier doesn't send in. It
+// wraps past midnight when end is before start, e.g. 22:00-07:00.
+type quietHours struct {
+	// start and end are minutes after midnight in loc; end is excluded.
+	start, end int
+	loc        *time.Location
+}
+
+// contains reports whether t falls within q. A nil q never does.
+func (q *quietHours) contains(t time.Time) bool {
+	if q == nil {
+		return false
+	}
+	t = t.In(q.loc)
+	var m = t.Hour()*60 + t.Minute()
+	if q.start < q.end {
+		return m >= q.start && m < q.end
+	}
+	return m >= q.start || m < q.end
+}
+
+// parseQuietHours parses comma separated name=HH:MM-HH:MM spans, by
+// notifier name, in the timezone loc.
+func parseQuietHours(s string, loc *time.Location) (map[string]*quietHours, error) {
+	var out = make(map[string]*quietHours)
+	for _, kv := range strings.Split(s, ",") {
+		if strings.TrimSpace(kv) == "" {
+			continue
+		}
+		var parts = strings.SplitN(kv, "=", 2)
+		var span []string
+		if len(parts) == 2 {
+			span = strings.Split(strings.TrimSpace(parts[1]), "-")
+		}
+		if len(span) != 2 {
+			return nil, errors.New("invalid quiet hours " + kv + ", expected name=HH:MM-HH:MM")
+		}
+
+		var q = &quietHours{loc: loc}
+		var err error
+		q.start, err = parseClock(span[0])
+		if err == nil {
+			q.end, err = parseClock(span[1])
+		}
+		if err != nil {
+			return nil, errors.New("invalid quiet hours " + kv + ": " + err.Error())
+		}
+		if q.start == q.end {
+			return nil, errors.New("invalid quiet hours " + kv + ", the span is empty")
+		}
+
+		var name = strings.TrimSpace(parts[0])
+		if _, ok := notifierRegistry[name]; !ok {
+			return nil, errors.New("invalid quiet hours " + kv + ", unknown notifier " + name)
+		}
+		out[name] = q
+	}
+	return out, nil
+}
+
+// parseClock parses an HH:MM time of day as minutes after midnight.
+func parseClock(s string) (int, error) {
+	var parts = strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 2 {
+		return 0, errors.New("time " + s + " must be of the form HH:MM")
+	}
+	var hour, err = strconv.Atoi(parts[0])
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, errors.New("invalid hour " + parts[0])
+	}
+	var minute int
+	minute, err = strconv.Atoi(parts[1])
+	if err != nil || minute < 0 || minute > 59 {
+		return 0, errors.New("invalid minute " + parts[1])
+	}
+	return hour*60 + minute, nil
+}
@@ -0,0 +1,245 @@
+package alerts
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	EnvRedisURL     = "REDIS_URL"
+	EnvRedisChannel = "REDIS_CHANNEL"
+
+	// DefaultRedisChannel is the channel events are published to unless
+	// REDIS_CHANNEL says otherwise.
+	DefaultRedisChannel = "ca-vaccine-alerts"
+
+	// redisTimeout bounds connecting to Redis and each command.
+	redisTimeout = 10 * time.Second
+)
+
+func init() {
+	registerNotifier("redis", newRedisNotifier)
+}
+
+// queueEvent is what's published to a message queue: a site found, or a
+// free-form message such as a summary. Text is the site rendered as a chat
+// message, for consumers that only relay.
+type queueEvent struct {
+	Event string           `json:"event"`
+	Site  *VaccineLocation `json:"site,omitempty"`
+	Text  string           `json:"text"`
+	Key   string           `json:"idempotencyKey,omitempty"`
+}
+
+// RedisNotifier publishes sites as JSON events to a Redis channel, for
+// separate consumers to deliver, store or chart. It speaks just enough of
+// the Redis protocol to PUBLISH, over one connection that it redials after
+// a failure.
+type RedisNotifier struct {
+	cfg      *Config
+	addr     string
+	password string
+	db       string
+	channel  string
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// newRedisNotifier returns a notifier for the Redis server configured in
+// the environment, or nil if there isn't one.
+func newRedisNotifier(cfg *Config) (Notifier, error) {
+	var raw, ok = os.LookupEnv(EnvRedisURL)
+	if !ok {
+		return nil, nil
+	}
+
+	var u, err = url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", EnvRedisURL, err)
+	}
+	if u.Scheme != "redis" || u.Host == "" {
+		return nil, errors.New(EnvRedisURL + " must look like redis://[:password@]host[:port][/db]")
+	}
+
+	var n = &RedisNotifier{
+		cfg:     cfg,
+		addr:    u.Host,
+		db:      strings.TrimPrefix(u.Path, "/"),
+		channel: DefaultRedisChannel,
+	}
+	if u.Port() == "" {
+		n.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		n.password, _ = u.User.Password()
+	}
+	if c, ok := os.LookupEnv(EnvRedisChannel); ok {
+		n.channel = c
+	}
+	return n, nil
+}
+
+func (n *RedisNotifier) Name() string {
+	return "redis"
+}
+
+func (n *RedisNotifier) Format(loc *VaccineLocation) string {
+	var b, _ = json.Marshal(&queueEvent{
+		Event: "site",
+		Site:  loc,
+		Text:  formatMessage(n.cfg, loc, WebhookLimit, utf8.RuneCountInString),
+	})
+	return string(b)
+}
+
+func (n *RedisNotifier) Post(text string) error {
+	return n.PostKeyed(text, "")
+}
+
+// PostKeyed publishes text, either an event from Format or a free-form
+// message, which is wrapped in one. A non-empty key is added to the event.
+func (n *RedisNotifier) PostKeyed(text, key string) error {
+	var e queueEvent
+	if err := json.Unmarshal([]byte(text), &e); err != nil || e.Event == "" {
+		e = queueEvent{Event: "message", Text: text}
+	}
+	e.Key = key
+
+	var b, err = json.Marshal(&e)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	// A connection that broke since the last event only shows when it's
+	// used, so a failure is retried once on a fresh one.
+	err = n.publish(b)
+	if err != nil && n.conn == nil {
+		n.cfg.log.debug("redis connection failed, redialling:", err)
+		err = n.publish(b)
+	}
+	return err
+}
+
+// Verify connects to the server, authenticating if the URL has a password,
+// and pings it.
+func (n *RedisNotifier) Verify() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.conn == nil {
+		var err = n.dial()
+		if err != nil {
+			return err
+		}
+	}
+	var _, err = n.do("PING")
+	if err != nil {
+		n.close()
+	}
+	return err
+}
+
+// publish sends payload to the channel, dialling first if there's no
+// connection. An error from the connection closes it.
+func (n *RedisNotifier) publish(payload []byte) error {
+	if n.conn == nil {
+		var err = n.dial()
+		if err != nil {
+			return err
+		}
+	}
+
+	var _, err = n.do("PUBLISH", n.channel, string(payload))
+	if err != nil {
+		var rerr redisError
+		if !errors.As(err, &rerr) {
+			n.close()
+		}
+		return err
+	}
+	return nil
+}
+
+// dial connects to the server, authenticating and selecting the database
+// if the URL asked for them.
+func (n *RedisNotifier) dial() error {
+	var conn, err = net.DialTimeout("tcp", n.addr, redisTimeout)
+	if err != nil {
+		return err
+	}
+	n.conn = conn
+	n.r = bufio.NewReader(conn)
+
+	if n.password != "" {
+		_, err = n.do("AUTH", n.password)
+	}
+	if err == nil && n.db != "" {
+		_, err = n.do("SELECT", n.db)
+	}
+	if err != nil {
+		n.close()
+		return err
+	}
+	return nil
+}
+
+func (n *RedisNotifier) close() {
+	n.conn.Close()
+	n.conn = nil
+	n.r = nil
+}
+
+// redisError is an error reply from the server, as opposed to a broken
+// connection.
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// do sends a command and reads its reply, which for the commands we use is
+// a simple string or an integer.
+func (n *RedisNotifier) do(args ...string) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+
+	n.conn.SetDeadline(time.Now().Add(redisTimeout))
+	var _, err = n.conn.Write([]byte(b.String()))
+	if err != nil {
+		return "", err
+	}
+
+	var line string
+	line, err = n.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return "", errors.New("empty reply from redis")
+	}
+	switch line[0] {
+	case '+', ':':
+		return line[1:], nil
+	case '-':
+		return "", redisError(line[1:])
+	}
+	return "", errors.New("unexpected reply from redis: " + line)
+}
@@ -0,0 +1,200 @@
+package alerts
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeRedis is a Redis server on loopback that reads RESP commands,
+// keeping each one and the bytes it came as, and answers them with reply,
+// which is called one command at a time.
+type fakeRedis struct {
+	ln    net.Listener
+	reply func(cmd []string) string
+
+	mu       sync.Mutex
+	cmds     [][]string
+	frames   []string
+	accepted int
+}
+
+func newFakeRedis(t *testing.T, reply func(cmd []string) string) *fakeRedis {
+	var ln, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f = &fakeRedis{ln: ln, reply: reply}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			var conn, err = ln.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.accepted++
+			f.mu.Unlock()
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	var r = bufio.NewReader(conn)
+	for {
+		var cmd, frame, err = readRESPCommand(r)
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.cmds = append(f.cmds, cmd)
+		f.frames = append(f.frames, frame)
+		var reply = f.reply(cmd)
+		f.mu.Unlock()
+
+		if reply == "" {
+			// Hang up, as a server restarting would.
+			return
+		}
+		io.WriteString(conn, reply)
+	}
+}
+
+// readRESPCommand reads an array of bulk strings from r, returning them
+// and the bytes they were read from.
+func readRESPCommand(r *bufio.Reader) ([]string, string, error) {
+	var frame strings.Builder
+	var line = func(prefix byte) (int, error) {
+		var l, err = r.ReadString('\n')
+		if err != nil {
+			return 0, err
+		}
+		frame.WriteString(l)
+		if len(l) < 3 || l[0] != prefix || !strings.HasSuffix(l, "\r\n") {
+			return 0, errors.New("bad RESP line " + strconv.Quote(l))
+		}
+		return strconv.Atoi(l[1 : len(l)-2])
+	}
+
+	var n, err = line('*')
+	if err != nil {
+		return nil, "", err
+	}
+	var cmd = make([]string, n)
+	for i := range cmd {
+		var size int
+		size, err = line('$')
+		if err != nil {
+			return nil, "", err
+		}
+		var b = make([]byte, size+2)
+		_, err = io.ReadFull(r, b)
+		if err != nil {
+			return nil, "", err
+		}
+		frame.Write(b)
+		cmd[i] = string(b[:size])
+	}
+	return cmd, frame.String(), nil
+}
+
+func (f *fakeRedis) seen() ([][]string, []string, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.cmds, f.frames, f.accepted
+}
+
+func TestRedisPublishes(t *testing.T) {
+	var srv = newFakeRedis(t, func(cmd []string) string {
+		if cmd[0] == "PUBLISH" {
+			return ":2\r\n"
+		}
+		return "+OK\r\n"
+	})
+	setenv(t, EnvRedisURL, "redis://:secret@"+srv.ln.Addr().String()+"/2")
+	setenv(t, EnvRedisChannel, "sites")
+	var cfg, err = parseConfig([]string{"-state-file="}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n Notifier
+	n, err = newRedisNotifier(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rn = n.(*RedisNotifier)
+
+	var text = rn.Format(&VaccineLocation{ExtID: "a", Name: "Moscone Center"})
+	err = rn.PostKeyed(text, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cmds, frames, _ = srv.seen()
+	if len(cmds) != 3 || !reflect.DeepEqual(cmds[0], []string{"AUTH", "secret"}) || !reflect.DeepEqual(cmds[1], []string{"SELECT", "2"}) {
+		t.Fatalf("got commands %q, want AUTH, SELECT then PUBLISH", cmds)
+	}
+	var payload = cmds[2][2]
+	var want = "*3\r\n$7\r\nPUBLISH\r\n$5\r\nsites\r\n$" + strconv.Itoa(len(payload)) + "\r\n" + payload + "\r\n"
+	if frames[2] != want {
+		t.Errorf("got PUBLISH frame %q, want %q", frames[2], want)
+	}
+	var e queueEvent
+	err = json.Unmarshal([]byte(payload), &e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Event != "site" || e.Site == nil || e.Site.ExtID != "a" || e.Key != "k1" || !strings.HasPrefix(e.Text, "Moscone Center\n") {
+		t.Errorf("published %s, want site a's event with its key", payload)
+	}
+}
+
+func TestRedisErrorReplies(t *testing.T) {
+	var commands int
+	var srv = newFakeRedis(t, func(cmd []string) string {
+		commands++
+		switch commands {
+		case 1:
+			return "-NOPERM this user has no permissions to access the 'sites' channel\r\n"
+		case 2:
+			return ""
+		}
+		return ":1\r\n"
+	})
+	var n = &RedisNotifier{cfg: &Config{}, addr: srv.ln.Addr().String(), channel: "sites"}
+
+	var err = n.Post("3 sites open")
+	var rerr redisError
+	if !errors.As(err, &rerr) || !strings.HasPrefix(string(rerr), "NOPERM") {
+		t.Fatalf("err = %v, want the server's error reply", err)
+	}
+	if n.conn == nil {
+		t.Error("closed the connection over an error reply")
+	}
+
+	// The server hangs up on the next one, which is sent again on a new
+	// connection.
+	err = n.Post("3 sites open")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cmds, _, accepted = srv.seen()
+	if len(cmds) != 3 || accepted != 2 {
+		t.Errorf("got %d commands over %d connections, want 3 over 2", len(cmds), accepted)
+	}
+	var e queueEvent
+	json.Unmarshal([]byte(cmds[2][2]), &e)
+	if e.Event != "message" || e.Text != "3 sites open" {
+		t.Errorf("published %s, want the text as a message event", cmds[2][2])
+	}
+}
@@ -0,0 +1,163 @@
+package alerts
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// NotifyAttempts is how many times a notifier tries to send a message
+	// before giving up on it.
+	NotifyAttempts = 3
+
+	// retryBase is the backoff before the first retry. It doubles on each
+	// retry after that.
+	retryBase = time.Second
+	// maxRetryAfter bounds how long a Retry-After header can make us wait.
+	maxRetryAfter = 2 * time.Minute
+)
+
+// doWithRetry sends req, retrying up to maxAttempts times in all on network
+// errors, 429s and 5xxs. Between attempts it waits as long as the server
+// asks through Retry-After, or else backs off exponentially with jitter.
+// Other responses, including 4xx errors, are returned straight away. Each
+// retry is taken from cfg's retry budget, and once it's spent failures are
+// returned without retrying.
+//
+// req's body is rewound between attempts, so it must have been created
+// with a body http.NewRequest knows how to replay, e.g. a bytes.Reader.
+func doWithRetry(cfg *Config, client *http.Client, req *http.Request, maxAttempts int) (*http.Response, error) {
+	var backoff = retryBase
+	for attempt := 1; ; attempt++ {
+		var r, err = client.Do(req)
+		if attempt >= maxAttempts || !retryable(r, err) {
+			return r, err
+		}
+		if req.Body != nil && req.GetBody == nil {
+			return r, err
+		}
+		if !cfg.retries.take() {
+			return r, err
+		}
+
+		var wait = backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		if r != nil {
+			if d, ok := retryAfter(r.Header.Get("Retry-After"), cfg.Now()); ok {
+				wait = d
+			}
+			cfg.log.debug("retrying:", field("host", req.URL.Host), field("status", r.StatusCode), field("wait", wait))
+			drainAndClose(r.Body)
+		} else {
+			cfg.log.debug("retrying:", field("host", req.URL.Host), field("error", err), field("wait", wait))
+		}
+
+		err = sleep(req.Context(), wait)
+		if err != nil {
+			return nil, err
+		}
+		backoff *= 2
+
+		if req.GetBody != nil {
+			req.Body, err = req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// sleep waits for d, failing with ctx's error if it's done first. A nil
+// ctx waits d out.
+func sleep(ctx context.Context, d time.Duration) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var t = time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// retryable reports whether a request that got r and err is worth trying
+// again.
+func retryable(r *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return r.StatusCode == http.StatusTooManyRequests || r.StatusCode >= http.StatusInternalServerError
+}
+
+// retryAfter parses a Retry-After header, which is either a number of
+// seconds or an HTTP date, into how long to wait from now.
+func retryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+
+	var d time.Duration
+	var secs, err = strconv.Atoi(v)
+	if err == nil {
+		d = time.Duration(secs) * time.Second
+	} else {
+		var t time.Time
+		t, err = http.ParseTime(v)
+		if err != nil {
+			return 0, false
+		}
+		d = t.Sub(now)
+	}
+
+	if d < 0 {
+		d = 0
+	}
+	if d > maxRetryAfter {
+		d = maxRetryAfter
+	}
+	return d, true
+}
+
+// retryBudget bounds how many retries a scan makes in all, across every
+// request sharing it, to cap the time and load a widespread failure can
+// cost. A nil budget is unlimited.
+type retryBudget struct {
+	max    int64
+	used   int64
+	warned int32
+	log    *logger
+}
+
+func newRetryBudget(max int, log *logger) *retryBudget {
+	return &retryBudget{max: int64(max), log: log}
+}
+
+// take claims a retry, reporting false if the budget is spent. It's safe to
+// call from several goroutines.
+func (b *retryBudget) take() bool {
+	if b == nil {
+		return true
+	}
+	if atomic.AddInt64(&b.used, 1) <= b.max {
+		return true
+	}
+	if atomic.CompareAndSwapInt32(&b.warned, 0, 1) {
+		b.log.warn("used up the budget of", b.max, "retries, failures won't be retried for the rest of the scan")
+	}
+	return false
+}
+
+// reset refills the budget for a new scan.
+func (b *retryBudget) reset() {
+	if b == nil {
+		return
+	}
+	atomic.StoreInt64(&b.used, 0)
+	atomic.StoreInt32(&b.warned, 0)
+}
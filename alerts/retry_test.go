@@ -0,0 +1,77 @@
+package alerts
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	var now = time.Date(2021, 4, 15, 10, 0, 0, 0, time.UTC)
+	var cases = []struct {
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"", 0, false},
+		{"soon", 0, false},
+		{"30", 30 * time.Second, true},
+		{"-5", 0, true},
+		{"600", maxRetryAfter, true},
+		{now.Add(45 * time.Second).Format(http.TimeFormat), 45 * time.Second, true},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{now.Add(time.Hour).Format(http.TimeFormat), maxRetryAfter, true},
+	}
+	for _, c := range cases {
+		var got, ok = retryAfter(c.header, now)
+		if got != c.want || ok != c.ok {
+			t.Errorf("retryAfter(%q) = %v, %v, want %v, %v", c.header, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	var attempts int
+	var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	var cfg = &Config{Now: time.Now, retries: newRetryBudget(3, nil)}
+	var get = func() {
+		var req, _ = http.NewRequest(http.MethodGet, srv.URL, nil)
+		var r, err = doWithRetry(cfg, srv.Client(), req, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Body.Close()
+		if r.StatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("status %d, want the last 503", r.StatusCode)
+		}
+	}
+
+	// The first request retries twice, the second once before the budget
+	// is spent, and the third can't retry at all.
+	for i, want := range []int{3, 5, 6} {
+		get()
+		if attempts != want {
+			t.Errorf("after request %d, %d attempts, want %d", i+1, attempts, want)
+		}
+	}
+
+	cfg.retries.reset()
+	get()
+	if attempts != 9 {
+		t.Errorf("after a reset, %d attempts in all, want 9", attempts)
+	}
+
+	var unlimited *retryBudget
+	for i := 0; i < 100; i++ {
+		if !unlimited.take() {
+			t.Fatal("a nil budget ran out")
+		}
+	}
+}
@@ -0,0 +1,809 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runner holds everything that is set up once at startup and reused by
+// every scan.
+type runner struct {
+	cfg         *Config
+	data        []*ZipToLatLong
+	dataUpdated time.Time
+	counties    *countyIndex
+	areas       []*alertArea
+	notifiers   []Notifier
+	httpClient  *http.Client
+	// digest is set in digest mode, where sites are posted once a day.
+	digest *digest
+	// home is where distance bands are measured from, the -near zip.
+	home Location
+	// lease is held while scanning, with -lock-file.
+	lease *lease
+}
+
+// newRunner loads the zip data and sets up the notifiers for cfg, unless d
+// provides them. Connections are warmed and the API probed within ctx.
+func newRunner(ctx context.Context, cfg *Config, d deps) (*runner, error) {
+	var r = &runner{
+		cfg:        cfg,
+		httpClient: newHTTPClient(cfg),
+		notifiers:  d.notifiers,
+	}
+
+	var err error
+	if cfg.ExportOnly {
+		r.notifiers = []Notifier{}
+		cfg.log.info("exporting only, no one is notified")
+	}
+	if r.notifiers == nil {
+		r.notifiers, err = newNotifiers(cfg)
+		if err != nil {
+			return nil, err
+		}
+		if len(r.notifiers) == 0 && !cfg.DryRun {
+			return nil, errors.New("no notifier is configured, set the environment variables of at least one, see -notifiers")
+		}
+	}
+	if cfg.DryRun {
+		// Without any notifier, messages are shown as they'd be tweeted.
+		if len(r.notifiers) == 0 {
+			r.notifiers = []Notifier{&TwitterNotifier{cfg: cfg}}
+		}
+		for i, n := range r.notifiers {
+			r.notifiers[i] = &dryRunNotifier{Notifier: n, w: d.stdout}
+		}
+		cfg.log.warn("dry run, messages are printed instead of sent and no state is saved")
+	}
+
+	if cfg.SimulateAvailability > 0 {
+		cfg.log.warn("simulating availability at", cfg.SimulateAvailability, "zips, the API won't be searched")
+	} else {
+		if cfg.WarmConnections > 0 {
+			warmConnections(ctx, cfg.log, r.httpClient, cfg.APIURLs[0], cfg.WarmConnections)
+		}
+		if cfg.Probe {
+			probeAPI(ctx, cfg, r.httpClient)
+		}
+	}
+
+	if cfg.DigestAt != "" {
+		r.digest, err = newDigest(cfg.DigestAt, cfg.DigestTimezone, cfg.Now())
+		if err != nil {
+			return nil, fmt.Errorf("setting up digest: %w", err)
+		}
+		cfg.log.info("posting a daily digest at", cfg.DigestAt, cfg.DigestTimezone)
+	}
+
+	// Streamed records are read afresh by every scan instead.
+	if cfg.StreamData {
+		return r, nil
+	}
+
+	if cfg.Stdin {
+		r.data, err = readCoordinates(cfg.log, d.stdin)
+		if err != nil {
+			return nil, fmt.Errorf("reading coordinates: %w", err)
+		}
+		cfg.log.info("searching", len(r.data), "coordinates from stdin")
+		return r, nil
+	}
+
+	var skipped int
+	r.data, skipped, err = parseJSONData(cfg.log, cfg.DataFile, cfg.DataFormat, cfg.DataFields, cfg.PrepWorkers)
+	if err != nil {
+		return nil, fmt.Errorf("parsing data: %w", err)
+	}
+	if skipped > 0 {
+		cfg.log.warn("skipped", skipped, "invalid records in the data, searching the other", len(r.data))
+	}
+
+	r.dataUpdated = newestRecord(r.data)
+	if cfg.StaleDataAfter > 0 && cfg.Now().Sub(r.dataUpdated) > cfg.StaleDataAfter {
+		cfg.log.warn("data was last updated", r.dataUpdated.Format(DateFormat), "and may be out of date")
+	}
+
+	if cfg.CountyFile != "" {
+		var m map[string]string
+		m, err = loadCounties(cfg.CountyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading county file: %w", err)
+		}
+		var missing = attachCounties(r.data, m)
+		if missing > 0 {
+			cfg.log.info(missing, "zips aren't in the county file, using their nearest zip's county")
+		}
+		r.counties = newCountyIndex(r.data)
+	}
+
+	if cfg.RetryFailed != "" {
+		var failed []*failedZip
+		failed, err = loadFailedZips(cfg.RetryFailed)
+		if err != nil {
+			return nil, fmt.Errorf("loading failed zips: %w", err)
+		}
+		r.data = retryFailedZips(r.data, failed)
+		cfg.log.info("retrying", len(r.data), "zips that failed before")
+	}
+
+	if cfg.AlertThreshold > 0 {
+		r.areas, err = resolveAreas(r.data, cfg.AlertAreas)
+		if err != nil {
+			return nil, fmt.Errorf("resolving alert areas: %w", err)
+		}
+	}
+
+	if len(cfg.DistanceBands) > 0 {
+		var home *Location
+		home, err = zipLocation(r.data, cfg.Near)
+		if err != nil {
+			return nil, fmt.Errorf("resolving distance bands: %w", err)
+		}
+		r.home = *home
+	}
+
+	if cfg.Near != "" {
+		r.data, err = filterNear(r.data, cfg.Near, cfg.Radius, cfg.PrepWorkers)
+		if err != nil {
+			return nil, fmt.Errorf("filtering data: %w", err)
+		}
+		cfg.log.info("scanning", len(r.data), "zips within", cfg.Radius, "miles of", cfg.Near)
+	}
+	if cfg.Center != nil {
+		r.data = filterRadius(r.data, *cfg.Center, cfg.Radius, cfg.PrepWorkers)
+		cfg.log.info("scanning", len(r.data), "zips within", cfg.Radius, "miles of", cfg.Center.Lat, cfg.Center.Long)
+	}
+	if len(cfg.Cities) > 0 {
+		r.data = filterCities(r.data, cfg.Cities)
+		if len(r.data) == 0 {
+			return nil, errors.New("no zips in -cities " + strings.Join(cfg.Cities, ", "))
+		}
+		cfg.log.info("scanning the", len(r.data), "zips in", strings.Join(cfg.Cities, ", "))
+	}
+
+	if cfg.GridPrecision >= 0 {
+		var n = len(r.data)
+		r.data = gridRecords(r.data, cfg.GridPrecision)
+		cfg.log.info("searching", len(r.data), "of", n, "zips, one per", cfg.GridPrecision, "decimal place grid cell")
+	}
+
+	if cfg.Shuffle {
+		var seed = cfg.ShuffleSeed
+		if seed == 0 {
+			seed = cfg.Now().UnixNano()
+		}
+		cfg.log.info("shuffling zips with seed", seed)
+		shuffleZips(r.data, seed)
+	}
+
+	if cfg.PopulationFile != "" {
+		var pop map[string]int
+		pop, err = loadPopulation(cfg.PopulationFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading population file: %w", err)
+		}
+		sortByPopulation(r.data, pop)
+	}
+
+	return r, nil
+}
+
+// records returns the zips to search, either data, prepared from the data
+// file, or streamed straight from it. The channel is closed early if ctx is
+// done.
+func (r *runner) records(ctx context.Context, data []*ZipToLatLong) <-chan *ZipToLatLong {
+	var out = make(chan *ZipToLatLong)
+
+	if r.cfg.StreamData {
+		go func() {
+			var err = streamJSONData(ctx, r.cfg.log, r.cfg.DataFile, r.cfg.DataFormat, r.cfg.DataFields, out)
+			if err != nil && ctx.Err() == nil {
+				r.cfg.log.error("streaming data:", err)
+			}
+		}()
+		return out
+	}
+
+	go func() {
+		defer close(out)
+		for _, d := range data {
+			select {
+			case out <- d:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// scan searches every zip once and notifies the sites found. If ctx is done
+// before every zip has been searched, the rest are abandoned and the sites
+// found so far are still notified. It only returns an error if the scan
+// couldn't be carried out at all.
+func (r *runner) scan(ctx context.Context) (*Summary, error) {
+	var cfg = r.cfg
+	var summary = &Summary{Start: cfg.Now(), DataUpdated: r.dataUpdated}
+	cfg.retries.reset()
+
+	var state = newState()
+	if cfg.StateFile != "" {
+		var err error
+		state, err = loadState(cfg.StateFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading state: %w", err)
+		}
+		// Compacting every scan, rather than on a timer of its own, keeps
+		// a daemon's state file bounded too; the save below writes it.
+		if n := state.compact(cfg.Now(), cfg.StateMaxAge, cfg.StateMaxSites); n > 0 {
+			cfg.log.info("forgot", n, "sites from the state file")
+		}
+	}
+
+	var artifacts *runArtifacts
+	if cfg.OutputDir != "" {
+		var err error
+		artifacts, err = newRunArtifacts(cfg.OutputDir, summary.Start, cfg.OutputRetention)
+		if err != nil {
+			cfg.log.error("creating output dir:", err)
+		}
+	}
+
+	// mu guards locs, summary and failures from the search workers.
+	var mu sync.Mutex
+	var locs = make(map[string]*VaccineLocation)
+
+	// searchDate searches near d for p from date, merging the sites found
+	// into locs. It returns the search's error, if it failed, which
+	// includes it panicking.
+	var dates = searchDates(cfg)
+	var searchDate = func(d *ZipToLatLong, p *Profile, date string, n int) (err error) {
+		defer func() {
+			if v := recover(); v != nil {
+				err = fmt.Errorf("panic searching near %s: %v", d.Fields.Zip, v)
+			}
+		}()
+
+		var pd = newPostData(cfg, &Location{Lat: d.Fields.Latitude, Long: d.Fields.Longitude}, p)
+		pd.FromDate = date
+		var resp *Response
+		resp, err = r.search(ctx, d, pd, n)
+
+		var name = d.Fields.Zip
+		if len(cfg.Profiles) > 1 {
+			name += "_" + p.Name
+		}
+		if len(dates) > 1 {
+			name += "_" + date
+		}
+		if cfg.Debug && ctx.Err() == nil {
+			// A failed search is the one most worth reproducing, so
+			// its request is saved too, as sent to the first endpoint.
+			var url = URL
+			if len(cfg.APIURLs) > 0 {
+				url = cfg.APIURLs[0]
+			}
+			if resp != nil && resp.url != "" {
+				url = resp.url
+			}
+			var werr = artifacts.writeRequest(name, newRequestDump(cfg, url, pd))
+			if werr != nil {
+				cfg.log.error("saving request:", werr)
+			}
+		}
+
+		if err != nil {
+			if ctx.Err() == nil {
+				var fields = []interface{}{"searching locations:", field("zip", d.Fields.Zip), field("profile", p.Name)}
+				var serr *statusError
+				if errors.As(err, &serr) {
+					fields = append(fields, field("status", serr.code))
+				}
+				cfg.log.error(append(fields, field("error", err))...)
+			}
+			return err
+		}
+
+		if cfg.Debug {
+			err = artifacts.writeResponse(name, resp.raw)
+			if err != nil {
+				cfg.log.error("saving response:", err)
+			}
+		}
+
+		fillDistances(resp.Locations, Location{Lat: d.Fields.Latitude, Long: d.Fields.Longitude})
+		var unique = dedupLocations(resp.Locations)
+		if n := len(resp.Locations) - len(unique); n > 0 {
+			cfg.log.debug("dropped", n, "duplicate sites from the response near", d.Fields.Zip)
+		}
+		resp.Locations = unique
+
+		if !resp.Eligible && len(resp.Locations) > 0 {
+			mu.Lock()
+			summary.IneligibleResponses++
+			mu.Unlock()
+			if !cfg.NotifyIneligible {
+				cfg.log.info("skipping", len(resp.Locations), "sites near", d.Fields.Zip, "as the", p.Name, "response is not eligible")
+				return nil
+			}
+			cfg.log.info("including", len(resp.Locations), "sites near", d.Fields.Zip, "from a", p.Name, "response that is not eligible")
+		}
+
+		var sites = resp.Locations
+		if cfg.MaxDistanceMeters > 0 {
+			sites = withinDistance(sites, cfg.MaxDistanceMeters)
+		}
+		if cfg.MaxPerZip > 0 && len(sites) > cfg.MaxPerZip {
+			cfg.log.debug("keeping the nearest", cfg.MaxPerZip, "of", len(sites), "sites near", d.Fields.Zip)
+			sites = nearestLocations(sites, cfg.MaxPerZip)
+		}
+
+		// A site found by several searches is still only notified once,
+		// tagged with all of their profiles, as available from the
+		// earliest date and as far away as the nearest of them. Sites
+		// are told apart by ExtID, since different sites can share a
+		// name, and the copy with the most data is kept.
+		mu.Lock()
+		defer mu.Unlock()
+		for _, loc := range sites {
+			loc.Zone = zipZone(d)
+			loc.OriginZip = d.Fields.Zip
+			if len(dates) > 1 {
+				loc.AvailableFrom = date
+			}
+			var key = siteKey(loc)
+			if prev, ok := locs[key]; ok {
+				if nearer(loc, prev) {
+					prev.DistanceInMeters = loc.DistanceInMeters
+					prev.DistanceUnknown = loc.DistanceUnknown
+				}
+				if prev.AvailableFrom > loc.AvailableFrom {
+					prev.AvailableFrom = loc.AvailableFrom
+				}
+				if completeness(loc) > completeness(prev) {
+					loc.Profiles = prev.Profiles
+					loc.Zone = prev.Zone
+					loc.OriginZip = prev.OriginZip
+					loc.DistanceInMeters = prev.DistanceInMeters
+					loc.DistanceUnknown = prev.DistanceUnknown
+					loc.AvailableFrom = prev.AvailableFrom
+				} else {
+					loc = prev
+				}
+			}
+			loc.addProfile(p.Name)
+			locs[key] = loc
+		}
+		return nil
+	}
+
+	// searchZip searches near d for p from each of dates, returning the
+	// first error if any of the searches failed.
+	var searchZip = func(d *ZipToLatLong, p *Profile, n int) error {
+		var first error
+		for _, date := range dates {
+			var err = searchDate(d, p, date, n)
+			if err != nil && ctx.Err() != nil {
+				return err
+			}
+			if err != nil && first == nil {
+				first = err
+			}
+		}
+		return first
+	}
+
+	// Each slice picks up where the last scan's left off, so a run of them
+	// covers every zip.
+	var data = r.data
+	var start int
+	if cfg.SliceSize > 0 && len(r.data) > 0 {
+		var err error
+		start, err = loadCursor(cfg.CursorFile)
+		if err != nil {
+			cfg.log.warn("scanning from the first zip:", err)
+		}
+		start %= len(r.data)
+		data = sliceRecords(r.data, start, cfg.SliceSize)
+		cfg.log.info("scanning", len(data), "zips from zip", start+1, "of", len(r.data))
+	}
+
+	// Workers take zips off records in turn, so the order they're searched
+	// in only matters to which zip a site is first found from.
+	var failures []*failedSearch
+	var bar = newProgress(cfg, len(data))
+	var records = r.records(ctx, data)
+	var wg sync.WaitGroup
+	for w := 0; w < cfg.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for d := range records {
+				mu.Lock()
+				bar.update(summary.ZipsSearched, len(locs))
+				summary.ZipsSearched++
+				var n = summary.ZipsSearched
+				mu.Unlock()
+
+				for _, p := range cfg.Profiles {
+					var err = searchZip(d, p, n)
+					if err != nil && ctx.Err() != nil {
+						return
+					}
+					mu.Lock()
+					summary.Searches++
+					if err != nil {
+						failures = append(failures, &failedSearch{record: d, profile: p, err: err})
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	bar.update(summary.ZipsSearched, len(locs))
+	bar.done()
+
+	if cfg.SliceSize > 0 && len(r.data) > 0 && !cfg.DryRun {
+		// The zips cut short by the deadline, one per worker at most, are
+		// searched again next time.
+		var done = summary.ZipsSearched
+		if ctx.Err() != nil {
+			done -= cfg.Workers
+			if done < 0 {
+				done = 0
+			}
+		}
+		var err = saveCursor(cfg.CursorFile, (start+done)%len(r.data))
+		if err != nil {
+			cfg.log.error("saving cursor:", err)
+		}
+	}
+
+	if cfg.RetrySearches && ctx.Err() == nil {
+		failures = r.retrySearches(ctx, failures, func(f *failedSearch) error {
+			return searchZip(f.record, f.profile, summary.ZipsSearched)
+		})
+	}
+	summary.SearchErrors = len(failures)
+	for _, f := range failures {
+		if errors.Is(f.err, errNotJSON) || errors.Is(f.err, errMalformed) {
+			summary.DecodeErrors++
+		}
+	}
+	var failedZips = make([]*failedZip, len(failures))
+	for i, f := range failures {
+		failedZips[i] = f.failedZip()
+	}
+	if cfg.FailedZipsFile != "" {
+		var err = writeFailedZips(cfg.FailedZipsFile, failedZips)
+		if err != nil {
+			cfg.log.error("saving failed zips:", err)
+		}
+	}
+	if r.lease.lost() {
+		cfg.log.warn("lost the lease after", summary.ZipsSearched, "zips, leaving the", len(locs), "sites found to its new holder")
+		return summary, nil
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		summary.DeadlineExceeded = true
+		cfg.log.warn("scan deadline passed after", summary.ZipsSearched, "zips, notifying the", len(locs), "sites found so far")
+	} else if ctx.Err() != nil {
+		cfg.log.warn("scan stopped after", summary.ZipsSearched, "zips, notifying the", len(locs), "sites found so far")
+	}
+
+	var found = make([]*VaccineLocation, 0, len(locs))
+	for _, v := range locs {
+		found = append(found, v)
+		summary.checkHours(v)
+	}
+	if summary.HoursWarnings > 0 {
+		cfg.log.warn(summary.HoursWarnings, "open hours times didn't parse, the API's hours format may have changed, e.g.", summary.HoursWarningExamples[0])
+	}
+	if r.counties != nil {
+		for _, v := range found {
+			v.county = r.counties.lookup(v.Location)
+		}
+	}
+	if cfg.NearestCity {
+		for _, v := range found {
+			v.NearCity = nearestCity(v.Location)
+		}
+	}
+	for _, t := range suggestExcludedTypes(found) {
+		if !hasType(cfg.ExcludeTypes, t) {
+			cfg.log.info("no", t, "site lists any hours, consider adding it to -exclude-types")
+		}
+	}
+	if len(cfg.ExcludeTypes) > 0 {
+		found = filterTypes(cfg.log, found, cfg.ExcludeTypes)
+	}
+	if cfg.ExcludeSites != nil {
+		found = filterSites(cfg.log, found, cfg.ExcludeSites)
+	}
+	if len(cfg.VaccineProducts) > 0 {
+		found = filterProducts(cfg.log, found, cfg.VaccineProducts)
+	}
+	if cfg.MinWeeklyHours > 0 {
+		found = filterMinHours(cfg.log, found, cfg.MinWeeklyHours)
+	}
+	summary.SitesFound = len(found)
+	if cfg.MarkNew {
+		state.markNew(found, cfg.Now())
+	}
+
+	r.export(found)
+
+	// With distance bands, only the sites in digest bands wait for the
+	// digest, and the rest are realtime as usual.
+	var realtime = r.digest == nil || len(cfg.DistanceBands) > 0
+	var pending []*notification
+	switch {
+	case len(cfg.DistanceBands) > 0:
+		var now, later = r.splitBands(found)
+		pending = r.realtime(ctx, now, state, summary)
+		if r.digest != nil {
+			pending = append(pending, r.digest.collect(cfg, later)...)
+		}
+	case r.digest != nil:
+		pending = r.digest.collect(cfg, found)
+	default:
+		pending = r.realtime(ctx, found, state, summary)
+	}
+
+	// Dead letters go first, since they're the oldest news.
+	var replayed bool
+	if cfg.ReplayDeadLetters {
+		var letters, err = loadDeadLetters(cfg.DeadLetterFile)
+		if err != nil {
+			cfg.log.error("loading dead letters:", err)
+		} else {
+			replayed = true
+			if len(letters) > 0 {
+				cfg.log.info("replaying", len(letters), "messages that failed to send before")
+			}
+			var retry = make([]*notification, len(letters))
+			for i, l := range letters {
+				retry[i] = l.notification()
+			}
+			pending = append(retry, pending...)
+		}
+	}
+
+	var notified []*VaccineLocation
+	var sent, failed = deliver(cfg, r.notifiers, pending, summary)
+	if len(summary.Unsent) > 0 {
+		cfg.log.warn("failed to announce", len(summary.Unsent), "sites:", strings.Join(summary.Unsent, ", "))
+	}
+	if cfg.DeadLetterFile != "" && !cfg.DryRun {
+		r.saveDeadLetters(replayed, failed)
+	}
+	for i, n := range pending {
+		if !sent[i] {
+			continue
+		}
+		notified = append(notified, n.sites...)
+		if n.digest {
+			continue
+		}
+		// Digests repeat every site daily, so only realtime
+		// notifications count towards the dedup window.
+		for _, v := range n.sites {
+			state.record(v, cfg.Now())
+		}
+		if n.replyID != "" {
+			state.Sites[siteKey(n.loc)].TweetID = n.replyID
+		}
+	}
+	// A site only counts as closed if every zip was searched, since
+	// otherwise it may just not have been looked for.
+	if cfg.ReplyClosed && ctx.Err() == nil && summary.SearchErrors == 0 {
+		r.replyClosed(state, found)
+	}
+
+	// Digests don't record notified sites, but the first-found times
+	// -mark-new keeps still need saving.
+	if cfg.StateFile != "" && (realtime || cfg.MarkNew) && !cfg.DryRun {
+		var err = state.save(cfg.StateFile)
+		if err != nil {
+			cfg.log.error("saving state:", err)
+		}
+	}
+
+	summary.End = cfg.Now()
+	cfg.log.info("scan done:", summary)
+	if cfg.HistoryFile != "" {
+		var err = appendHistory(cfg.HistoryFile, cfg.HistoryMaxSize, newHistoryRecord(summary, found))
+		if err != nil {
+			cfg.log.error("saving history:", err)
+		}
+	}
+	var err = artifacts.writeJSON("notified.json", notified)
+	if err != nil {
+		cfg.log.error("saving notified sites:", err)
+	}
+	err = artifacts.writeJSON("summary.json", summary)
+	if err != nil {
+		cfg.log.error("saving summary:", err)
+	}
+
+	return summary, nil
+}
+
+// export writes the sites found to every configured export file. Each
+// export is independent, so one failing doesn't stop the rest.
+func (r *runner) export(found []*VaccineLocation) {
+	var exports = []struct {
+		format string
+		path   string
+		write  func(*Config, io.Writer, []*VaccineLocation) error
+	}{
+		{"json", r.cfg.ExportJSON, writeJSONExport},
+		{"csv", r.cfg.ExportCSV, writeCSV},
+		{"geojson", r.cfg.ExportGeoJSON, writeGeoJSON},
+		{"html", r.cfg.ExportHTML, writeHTML},
+	}
+
+	found = sortExport(found, r.cfg.ExportSort)
+	for _, e := range exports {
+		if e.path == "" {
+			continue
+		}
+		var err = exportFile(r.cfg, e.path, found, e.write)
+		if err != nil {
+			r.cfg.log.error("exporting "+e.format+":", err)
+		}
+	}
+}
+
+// replyClosed replies to the tweets of the sites no longer in found, saying
+// they've stopped showing availability, and forgets the tweets replied to.
+func (r *runner) replyClosed(state *State, found []*VaccineLocation) {
+	var to replyNotifier
+	for _, n := range r.notifiers {
+		if rn, ok := n.(replyNotifier); ok {
+			to = rn
+			break
+		}
+	}
+	if to == nil {
+		return
+	}
+
+	for _, id := range state.closed(found) {
+		var seen = state.Sites[id]
+		var err = to.Reply(string(seen.Name)+" is no longer showing availability.", seen.TweetID)
+		if err != nil {
+			r.cfg.log.error("replying that", seen.Name, "closed:", err)
+			continue
+		}
+		r.cfg.log.info("replied that", seen.Name, "is no longer showing availability")
+		seen.TweetID = ""
+	}
+}
+
+// saveDeadLetters adds the messages that failed to send to the dead-letter
+// file. Once its letters have been replayed, the file is started afresh
+// so the ones sent this time aren't retried again.
+func (r *runner) saveDeadLetters(replayed bool, failed []*deadLetter) {
+	if replayed {
+		var err = os.Remove(r.cfg.DeadLetterFile)
+		if err != nil && !os.IsNotExist(err) {
+			r.cfg.log.error("clearing dead letters:", err)
+			return
+		}
+	}
+
+	var err = appendDeadLetters(r.cfg.DeadLetterFile, failed)
+	if err != nil {
+		r.cfg.log.error("saving dead letters:", err)
+	}
+}
+
+// stillAvailable searches again at v's own coordinates, reporting whether
+// v is still listed. If that can't be told, e.g. the search fails, v is
+// assumed to be available, so a flaky API doesn't swallow alerts.
+func (r *runner) stillAvailable(ctx context.Context, v *VaccineLocation) bool {
+	if v.Location == nil || ctx.Err() != nil || r.cfg.SimulateAvailability > 0 {
+		return true
+	}
+
+	var p = r.cfg.Profiles[0]
+	for _, c := range r.cfg.Profiles {
+		if len(v.Profiles) > 0 && c.Name == v.Profiles[0] {
+			p = c
+		}
+	}
+
+	var resp, err = searchLocations(ctx, r.cfg, r.httpClient, newPostData(r.cfg, v.Location, p))
+	if err != nil {
+		r.cfg.log.warn("verifying", v.Name+":", field("error", err))
+		return true
+	}
+
+	for _, l := range resp.Locations {
+		if siteKey(l) == siteKey(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// realtime returns the notifications for the sites found by a scan that
+// haven't been announced yet. With MaxTweets, only the nearest that many
+// are, counting the rest in summary.
+func (r *runner) realtime(ctx context.Context, found []*VaccineLocation, state *State, summary *Summary) []*notification {
+	var cfg = r.cfg
+	if cfg.AlertThreshold > 0 {
+		return r.thresholdAlerts(found, state)
+	}
+
+	var announced int
+	if cfg.MaxTweets > 0 {
+		found = nearestFirst(found)
+	}
+	var pending []*notification
+	var byCounty = make(map[string][]*VaccineLocation)
+	for _, v := range found {
+		var notify, changed = state.check(v, cfg.Now(), cfg.DedupWindow, cfg.MinSiteInterval, cfg.NotifyHoursChanges)
+		if !notify {
+			continue
+		}
+		if cfg.MaxTweets > 0 && announced >= cfg.MaxTweets {
+			summary.Suppressed++
+			continue
+		}
+		if cfg.VerifyBeforeTweet && !r.stillAvailable(ctx, v) {
+			cfg.log.info("not notifying", v.Name, "as it's no longer listed")
+			continue
+		}
+		announced++
+
+		// Sites with changed hours, or whose county is unknown, still get
+		// their own tweet.
+		if cfg.TweetByCounty && r.counties != nil && !changed {
+			if c := v.county; c != "" {
+				byCounty[c] = append(byCounty[c], v)
+				continue
+			}
+		}
+
+		v.hoursChanged = changed
+		pending = append(pending, &notification{loc: v, sites: []*VaccineLocation{v}})
+	}
+
+	for c, sites := range byCounty {
+		pending = append(pending, &notification{text: formatCountyTweet(cfg, c, sites), sites: sites})
+	}
+	if summary.Suppressed > 0 {
+		cfg.log.info("holding back", summary.Suppressed, "sites past -max-tweets for a later scan")
+	}
+
+	return pending
+}
+
+// nearestFirst returns locs sorted by distance, those of unknown distance
+// last, ties broken by ExtID, so the same sites sort the same every scan.
+func nearestFirst(locs []*VaccineLocation) []*VaccineLocation {
+	var out = make([]*VaccineLocation, len(locs))
+	copy(out, locs)
+	sort.Slice(out, func(i, j int) bool {
+		if nearer(out[i], out[j]) {
+			return true
+		}
+		if nearer(out[j], out[i]) {
+			return false
+		}
+		return siteKey(out[i]) < siteKey(out[j])
+	})
+	return out
+}
@@ -0,0 +1,255 @@
+package alerts
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// errNotJSON is returned for a search the API answered with something other
+// than JSON, typically an error page served with a 200.
+var errNotJSON = errors.New("response is not JSON")
+
+// errMalformed is returned for a search response that doesn't decode.
+var errMalformed = errors.New("unmarshaling response")
+
+// statusError is returned for a search the API answered with an error
+// status.
+type statusError struct {
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string {
+	return "unexpected status " + e.status
+}
+
+// maxSnippet is how much of a body that isn't JSON is logged.
+const maxSnippet = 200
+
+// searchLocations issues a single location search to the API, failing over
+// between cfg's endpoints, and decodes the response.
+func searchLocations(ctx context.Context, cfg *Config, client *http.Client, pd *PostData) (*Response, error) {
+	var resp, err = searchOnce(ctx, cfg, client, pd)
+	if cfg.RetryNonJSON && errors.Is(err, errNotJSON) {
+		cfg.log.info("retrying search:", err)
+		resp, err = searchOnce(ctx, cfg, client, pd)
+	}
+	return resp, err
+}
+
+func searchOnce(ctx context.Context, cfg *Config, client *http.Client, pd *PostData) (*Response, error) {
+	if cfg.endpoints == nil {
+		return searchEndpoint(ctx, cfg, client, URL, pd)
+	}
+	return cfg.endpoints.search(ctx, cfg, client, pd)
+}
+
+// searchEndpoint issues a single location search to the API endpoint url
+// and decodes the response.
+func searchEndpoint(ctx context.Context, cfg *Config, client *http.Client, url string, pd *PostData) (*Response, error) {
+	var resp, err = postSearch(ctx, cfg, client, url, pd)
+	if resp != nil {
+		resp.url = url
+	}
+	return resp, err
+}
+
+// postSearch posts pd to url, retrying transient failures up to
+// cfg.SearchAttempts times in all, and decodes the response.
+func postSearch(ctx context.Context, cfg *Config, client *http.Client, url string, pd *PostData) (*Response, error) {
+	var b, err = json.Marshal(pd)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling request: %w", err)
+	}
+
+	var req *http.Request
+	req, err = http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("building request: %w", err)
+	}
+	req.Header.Set("Content-Type", JSONMimeType)
+	// Setting Accept-Encoding ourselves turns off the transport's
+	// transparent decompression, so gzip bodies are handled below.
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	var r *http.Response
+	r, err = doWithRetry(cfg, client, req, cfg.SearchAttempts)
+	// The body must be released even when Do also returns an error, e.g. a
+	// failed redirect, so guard on r rather than err.
+	if r != nil {
+		defer drainAndClose(r.Body)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("issuing post request: %w", err)
+	}
+
+	if r.StatusCode >= http.StatusBadRequest {
+		return nil, &statusError{code: r.StatusCode, status: r.Status}
+	}
+	if r.StatusCode == http.StatusNoContent {
+		return &Response{}, nil
+	}
+
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		var gz *gzip.Reader
+		gz, err = gzip.NewReader(r.Body)
+		if err == io.EOF {
+			return &Response{}, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decompressing response body: %w", err)
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	b, err = ioutil.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("reading response body: %w", err)
+	}
+
+	// An empty body is how the API sometimes says there's nothing near a
+	// point, so it's no locations rather than a malformed response.
+	if len(bytes.TrimSpace(b)) == 0 {
+		return &Response{raw: b}, nil
+	}
+	if !looksLikeJSON(r.Header.Get("Content-Type"), b) {
+		cfg.log.warn("non-JSON response:", field("url", url), field("status", r.StatusCode), field("body", snippet(b)))
+		return nil, fmt.Errorf("%w (Content-Type %q)", errNotJSON, r.Header.Get("Content-Type"))
+	}
+	return decodeResponse(cfg.log, b)
+}
+
+// looksLikeJSON reports whether a body with the given Content-Type is worth
+// decoding: it isn't declared as HTML, and starts like a JSON value would.
+// Decoding anything else would only fail with a confusing syntax error.
+func looksLikeJSON(contentType string, b []byte) bool {
+	if t, _, err := mime.ParseMediaType(contentType); err == nil && strings.HasSuffix(t, "html") {
+		return false
+	}
+	var c = bytes.TrimSpace(b)[0]
+	return c == '{' || c == '['
+}
+
+// snippet returns the start of b on a single line, for logging.
+func snippet(b []byte) string {
+	var s = string(b)
+	if len(s) > maxSnippet {
+		s = s[:maxSnippet] + "..."
+	}
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// decodeResponse decodes a search response body. A body that won't decode
+// as a whole, e.g. because it was cut short or one of its locations is
+// malformed, is decoded again location by location, keeping the locations
+// that are fine rather than losing every site near the point. Null
+// locations are dropped either way.
+func decodeResponse(log *logger, b []byte) (*Response, error) {
+	var resp = &Response{raw: b}
+	var err = json.Unmarshal(b, resp)
+	if err == nil {
+		var locs = resp.Locations[:0]
+		for _, l := range resp.Locations {
+			if l != nil {
+				locs = append(locs, l)
+			}
+		}
+		resp.Locations = locs
+		return resp, nil
+	}
+
+	var salvaged = &Response{raw: b}
+	var serr = salvageResponse(log, b, salvaged)
+	if len(salvaged.Locations) == 0 {
+		return nil, fmt.Errorf("%w: %v", errMalformed, err)
+	}
+	if serr != nil {
+		err = serr
+	}
+	log.warn("recovered", len(salvaged.Locations), "locations from a malformed response:", err)
+	return salvaged, nil
+}
+
+// salvageResponse decodes b into resp one token at a time, skipping any
+// location that doesn't decode. It stops at the first syntax error, as
+// nothing after it can be trusted, leaving resp with what came before.
+func salvageResponse(log *logger, b []byte, resp *Response) error {
+	var dec = json.NewDecoder(bytes.NewReader(b))
+	var tok, err = dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != json.Delim('{') {
+		return errors.New("response is not a JSON object")
+	}
+
+	for dec.More() {
+		tok, err = dec.Token()
+		if err != nil {
+			return err
+		}
+
+		switch tok {
+		case "eligible":
+			err = dec.Decode(&resp.Eligible)
+		case "vaccineData":
+			err = dec.Decode(&resp.VaccineData)
+		case "locations":
+			err = salvageLocations(log, dec, resp)
+		default:
+			var skip json.RawMessage
+			err = dec.Decode(&skip)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// salvageLocations decodes the locations array dec is at into resp, one
+// element at a time, logging and skipping the elements that don't decode.
+func salvageLocations(log *logger, dec *json.Decoder, resp *Response) error {
+	var tok, err = dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		return nil
+	}
+	if tok != json.Delim('[') {
+		return errors.New("locations is not an array")
+	}
+
+	for i := 0; dec.More(); i++ {
+		var raw json.RawMessage
+		err = dec.Decode(&raw)
+		if err != nil {
+			return fmt.Errorf("location %d: %w", i, err)
+		}
+
+		var loc *VaccineLocation
+		err = json.Unmarshal(raw, &loc)
+		if err != nil {
+			log.warn("skipping malformed location", i, "in response:", err, string(raw))
+			continue
+		}
+		if loc != nil {
+			resp.Locations = append(resp.Locations, loc)
+		}
+	}
+
+	_, err = dec.Token()
+	return err
+}
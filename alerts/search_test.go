@@ -0,0 +1,193 @@
+package alerts
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDecodeResponseSalvagesLocations(t *testing.T) {
+	var cases = []struct {
+		name     string
+		body     string
+		eligible bool
+		ids      []string
+		err      error
+	}{
+		{"whole", `{"eligible": true, "locations": [{"extId": "a"}, {"extId": "b"}]}`, true, []string{"a", "b"}, nil},
+		{"bad location", `{"eligible": true, "locations": [{"extId": "a"}, {"extId": 7}, {"extId": "c"}]}`, true, []string{"a", "c"}, nil},
+		{"cut short", `{"eligible": true, "locations": [{"extId": "a"}, {"extId": "b"}, {"ext`, true, []string{"a", "b"}, nil},
+		{"null location", `{"locations": [null, {"extId": "a"}], "eligible": false, "extra": {"x": 1}}`, false, []string{"a"}, nil},
+		{"nothing to salvage", `{"eligible": true, "locations": [{"extId": 7}]}`, false, nil, errMalformed},
+		{"locations not an array", `{"eligible": true, "locations": {"extId": "a"}}`, false, nil, errMalformed},
+		{"not an object", `[{"extId": "a"}`, false, nil, errMalformed},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var resp, err = decodeResponse(nil, []byte(c.body))
+			if c.err != nil {
+				if !errors.Is(err, c.err) {
+					t.Fatalf("err = %v, want %v", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, l := range resp.Locations {
+				ids = append(ids, l.ExtID)
+			}
+			if !reflect.DeepEqual(ids, c.ids) || resp.Eligible != c.eligible {
+				t.Errorf("got eligible %v, sites %v, want %v, %v", resp.Eligible, ids, c.eligible, c.ids)
+			}
+			if string(resp.raw) != c.body {
+				t.Error("raw body not kept")
+			}
+		})
+	}
+}
+
+// gzipped returns s compressed with gzip.
+func gzipped(s string) string {
+	var buf bytes.Buffer
+	var gz = gzip.NewWriter(&buf)
+	gz.Write([]byte(s))
+	gz.Close()
+	return buf.String()
+}
+
+func TestPostSearchResponses(t *testing.T) {
+	var cases = []struct {
+		name        string
+		status      int
+		contentType string
+		encoding    string
+		body        string
+		ids         []string
+		err         error
+	}{
+		{"json", http.StatusOK, JSONMimeType, "", `{"locations": [{"extId": "a"}]}`, []string{"a"}, nil},
+		{"gzip", http.StatusOK, JSONMimeType, "gzip", gzipped(`{"locations": [{"extId": "a"}, {"extId": "b"}]}`), []string{"a", "b"}, nil},
+		{"no content", http.StatusNoContent, "", "", "", nil, nil},
+		{"empty body", http.StatusOK, JSONMimeType, "", "", nil, nil},
+		{"blank body", http.StatusOK, "", "", " \r\n", nil, nil},
+		{"empty gzip", http.StatusOK, JSONMimeType, "gzip", "", nil, nil},
+		{"gzip of nothing", http.StatusOK, JSONMimeType, "gzip", gzipped(""), nil, nil},
+		{"html page", http.StatusOK, "text/html; charset=utf-8", "", "<html><body>Service Unavailable</body></html>", nil, errNotJSON},
+		{"html declared as json", http.StatusOK, JSONMimeType, "", "<!DOCTYPE html><html></html>", nil, errNotJSON},
+		{"json declared as html", http.StatusOK, "text/html", "", `{"locations": []}`, nil, errNotJSON},
+		{"corrupt gzip", http.StatusOK, JSONMimeType, "gzip", "this isn't gzipped at all", nil, gzip.ErrHeader},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Accept-Encoding") != "gzip" {
+					t.Errorf("got Accept-Encoding %q, want gzip", r.Header.Get("Accept-Encoding"))
+				}
+				w.Header().Set("Content-Type", c.contentType)
+				if c.encoding != "" {
+					w.Header().Set("Content-Encoding", c.encoding)
+				}
+				w.WriteHeader(c.status)
+				w.Write([]byte(c.body))
+			}))
+			defer srv.Close()
+
+			var cfg = &Config{Now: time.Now, SearchAttempts: 1}
+			var resp, err = postSearch(context.Background(), cfg, srv.Client(), srv.URL, &PostData{})
+			if c.err != nil {
+				if !errors.Is(err, c.err) {
+					t.Fatalf("err = %v, want %v", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp == nil {
+				t.Fatal("got no response, want one with no sites")
+			}
+			var ids []string
+			for _, l := range resp.Locations {
+				ids = append(ids, l.ExtID)
+			}
+			if !reflect.DeepEqual(ids, c.ids) {
+				t.Errorf("got sites %v, want %v", ids, c.ids)
+			}
+		})
+	}
+}
+
+// closeCounter is a response body counting how many times it's closed.
+type closeCounter struct {
+	io.Reader
+	mu     *sync.Mutex
+	closed *int
+}
+
+func (b closeCounter) Close() error {
+	b.mu.Lock()
+	*b.closed++
+	b.mu.Unlock()
+	return nil
+}
+
+func TestPostSearchClosesBodies(t *testing.T) {
+	var cases = []struct {
+		name        string
+		status      int
+		contentType string
+		encoding    string
+		body        string
+	}{
+		{"json", http.StatusOK, JSONMimeType, "", `{"locations": [{"extId": "a"}]}`},
+		{"malformed", http.StatusOK, JSONMimeType, "", `{"locations": `},
+		{"no content", http.StatusNoContent, "", "", ""},
+		{"html", http.StatusOK, "text/html", "", "<html></html>"},
+		{"corrupt gzip", http.StatusOK, JSONMimeType, "gzip", "this isn't gzipped at all"},
+		{"rejected", http.StatusBadRequest, JSONMimeType, "", `{"error": "bad"}`},
+		{"retried", http.StatusServiceUnavailable, "text/plain", "", "try again"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var opened, closed int
+			var client = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				mu.Lock()
+				opened++
+				mu.Unlock()
+				var h = http.Header{"Content-Type": {c.contentType}, "Retry-After": {"0"}}
+				if c.encoding != "" {
+					h.Set("Content-Encoding", c.encoding)
+				}
+				return &http.Response{
+					StatusCode: c.status,
+					Status:     strconv.Itoa(c.status) + " " + http.StatusText(c.status),
+					Header:     h,
+					Body:       closeCounter{Reader: strings.NewReader(c.body), mu: &mu, closed: &closed},
+					Request:    req,
+				}, nil
+			})}
+
+			var cfg = &Config{Now: time.Now, SearchAttempts: 3}
+			postSearch(context.Background(), cfg, client, "http://api.test", &PostData{})
+			if opened == 0 || closed != opened {
+				t.Errorf("closed %d of %d response bodies", closed, opened)
+			}
+			if c.status == http.StatusServiceUnavailable && opened != cfg.SearchAttempts {
+				t.Errorf("got %d responses, want one per attempt", opened)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// BitlyShortenURL is Bitly's shorten endpoint, which shortenerURL's API is
+// modelled on.
+const BitlyShortenURL = "https://api-ssl.bitly.com/v4/shorten"
+
+// shortener shortens links through a Bitly-compatible API: a POST of
+// {"long_url": ...} with a bearer token, answered with {"link": ...}.
+// Shortened links are cached by destination, so each is only shortened
+// once. A nil shortener leaves links as they are.
+type shortener struct {
+	client   *http.Client
+	endpoint string
+	token    string
+	log      *logger
+
+	mu    sync.Mutex
+	cache map[string]string
+}
+
+func newShortener(transport http.RoundTripper, endpoint, token string, log *logger) *shortener {
+	return &shortener{
+		client:   &http.Client{Transport: transport, Timeout: 10 * time.Second},
+		endpoint: endpoint,
+		token:    token,
+		log:      log,
+		cache:    make(map[string]string),
+	}
+}
+
+// shorten returns the short link for long, or long itself if it can't be
+// shortened. Failures aren't cached, so they're retried the next time.
+func (s *shortener) shorten(long string) string {
+	if s == nil {
+		return long
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if short, ok := s.cache[long]; ok {
+		return short
+	}
+
+	var short, err = s.request(long)
+	if err != nil {
+		s.log.warn("shortening", long+":", err)
+		return long
+	}
+	s.cache[long] = short
+	return short
+}
+
+func (s *shortener) request(long string) (string, error) {
+	var b, err = json.Marshal(map[string]string{"long_url": long})
+	if err != nil {
+		return "", err
+	}
+
+	var req *http.Request
+	req, err = http.NewRequest(http.MethodPost, s.endpoint, bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", JSONMimeType)
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	var r *http.Response
+	r, err = s.client.Do(req)
+	if r != nil {
+		defer drainAndClose(r.Body)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if r.StatusCode >= http.StatusBadRequest {
+		return "", errors.New("unexpected status " + r.Status)
+	}
+
+	var out struct {
+		Link string `json:"link"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&out)
+	if err != nil {
+		return "", err
+	}
+	if out.Link == "" {
+		return "", errors.New("no link in response")
+	}
+
+	return out.Link, nil
+}
@@ -0,0 +1,52 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package alerts
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSignalCancelsSearch(t *testing.T) {
+	var release = make(chan struct{})
+	var api = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer api.Close()
+	defer close(release)
+
+	var cfg = DefaultConfig()
+	cfg.APIURLs = []string{api.URL}
+	cfg.Coordinates = &Location{Lat: 37.7725, Long: -122.4147}
+	cfg.derive()
+
+	var ctx = SignalContext(context.Background())
+	var done = make(chan error)
+	go func() { done <- searchPoint(ctx, cfg, ioutil.Discard) }()
+	time.Sleep(50 * time.Millisecond)
+	var err = syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err = <-done:
+		if err == nil {
+			t.Error("search succeeded")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("search still running after SIGTERM")
+	}
+	if ctx.Err() == nil {
+		t.Error("SIGTERM didn't cancel the signal context")
+	}
+}
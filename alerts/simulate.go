@@ -0,0 +1,56 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// SimulatedLabel starts the name of every simulated site, so the messages
+// they end up in can't be mistaken for real availability.
+const SimulatedLabel = "[SIMULATED] "
+
+// search runs pd, the search of the zip d, which is the n-th zip of the
+// scan. When simulating availability nothing is sent to the API: the first
+// cfg.SimulateAvailability zips get a made up site, and the rest nothing.
+func (r *runner) search(ctx context.Context, d *ZipToLatLong, pd *PostData, n int) (*Response, error) {
+	if r.cfg.SimulateAvailability == 0 {
+		return searchLocations(ctx, r.cfg, r.httpClient, pd)
+	}
+	if n > r.cfg.SimulateAvailability {
+		return &Response{Eligible: true}, nil
+	}
+	return simulateResponse(d, pd), nil
+}
+
+// simulateResponse makes up the response a search for pd near the zip d
+// could get, with a single site in the zip open on weekdays. The site is
+// built from the same structs the API decodes into, so everything after
+// the search treats it like a real one.
+func simulateResponse(d *ZipToLatLong, pd *PostData) *Response {
+	var city = d.Fields.City
+	if city == "" {
+		city = d.Fields.Zip
+	}
+
+	var loc = &VaccineLocation{
+		DisplayAddress: "1 Example St\n" + city + ", CA " + d.Fields.Zip,
+		ExtID:          "simulated-" + d.Fields.Zip,
+		Location:       &Location{Lat: d.Fields.Latitude, Long: d.Fields.Longitude},
+		Name:           SiteName(SimulatedLabel + city + " Vaccination Site " + d.Fields.Zip),
+		OpenHours: []Hours{{
+			Days:       weekdays[1:6],
+			LocalStart: "09:00:00",
+			LocalEnd:   "17:00:00",
+		}},
+		Type:        "Simulated",
+		VaccineData: pd.VaccineData,
+	}
+
+	var resp = &Response{
+		Eligible:    true,
+		VaccineData: pd.VaccineData,
+		Locations:   []*VaccineLocation{loc},
+	}
+	resp.raw, _ = json.Marshal(resp)
+	return resp
+}
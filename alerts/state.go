@@ -0,0 +1,226 @@
+package alerts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// State records the sites that have already been notified, keyed by siteKey,
+// so that scheduled runs don't announce the same site over and over.
+type State struct {
+	Sites map[string]*SiteState `json:"sites"`
+	// Areas are the number of sites open in each threshold alert area,
+	// by zip, at the last scan.
+	Areas map[string]int `json:"areas,omitempty"`
+	// Seen is when each site was first found, by siteKey, notified or not.
+	// It's only kept with -mark-new.
+	Seen map[string]time.Time `json:"seen,omitempty"`
+}
+
+// SiteState is what we remember about a single notified site.
+type SiteState struct {
+	LastNotified time.Time `json:"lastNotified"`
+	// HoursHash identifies the OpenHours we last announced, so schedule
+	// changes can be detected.
+	HoursHash string `json:"hoursHash"`
+	// Name is the site's name when it was last notified.
+	Name SiteName `json:"name,omitempty"`
+	// TweetID is the site's last tweet, with -reply-closed, until it's
+	// been replied to as closed.
+	TweetID string `json:"tweetId,omitempty"`
+}
+
+func newState() *State {
+	return &State{
+		Sites: make(map[string]*SiteState),
+		Areas: make(map[string]int),
+		Seen:  make(map[string]time.Time),
+	}
+}
+
+// defaultStateFile is where state is kept unless -state-file says
+// otherwise: state.json in this program's directory of the user's cache,
+// or nowhere if the user has none.
+func defaultStateFile() string {
+	var dir, err = os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, Program, "state.json")
+}
+
+// loadState reads the state file at path. A missing file is an empty state.
+func loadState(path string) (*State, error) {
+	var b, err = ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return newState(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var s = newState()
+	err = json.Unmarshal(b, s)
+	if err != nil {
+		return nil, err
+	}
+	if s.Sites == nil {
+		s.Sites = make(map[string]*SiteState)
+	}
+	if s.Areas == nil {
+		s.Areas = make(map[string]int)
+	}
+	if s.Seen == nil {
+		s.Seen = make(map[string]time.Time)
+	}
+
+	return s, nil
+}
+
+// save atomically writes the state to path.
+func (s *State) save(path string) error {
+	var b, err = json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// The default path is in a directory of its own, which may not exist
+	// yet.
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	var f *os.File
+	f, err = ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(b)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// compact forgets the sites last notified longer than maxAge before now,
+// then the oldest, until at most maxSites are left, and returns how many
+// it forgot. A zero maxAge or maxSites doesn't limit. Sites first found
+// longer than maxAge ago are forgotten from Seen too, uncounted.
+func (s *State) compact(now time.Time, maxAge time.Duration, maxSites int) int {
+	var before = len(s.Sites)
+	if maxAge > 0 {
+		for id, seen := range s.Sites {
+			if now.Sub(seen.LastNotified) > maxAge {
+				delete(s.Sites, id)
+			}
+		}
+		for id, first := range s.Seen {
+			if now.Sub(first) > maxAge {
+				delete(s.Seen, id)
+			}
+		}
+	}
+
+	if maxSites > 0 && len(s.Sites) > maxSites {
+		var ids = make([]string, 0, len(s.Sites))
+		for id := range s.Sites {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool {
+			return s.Sites[ids[i]].LastNotified.Before(s.Sites[ids[j]].LastNotified)
+		})
+		for _, id := range ids[:len(ids)-maxSites] {
+			delete(s.Sites, id)
+		}
+	}
+
+	return before - len(s.Sites)
+}
+
+// check reports whether loc should be notified at now. A site is notified
+// if it hasn't been within window, or, when hoursChanges is set, if its
+// hours differ from the ones last announced; changed reports the latter.
+// Either way, a site is never notified twice within minInterval.
+func (s *State) check(loc *VaccineLocation, now time.Time, window, minInterval time.Duration, hoursChanges bool) (notify bool, changed bool) {
+	var seen, ok = s.Sites[siteKey(loc)]
+	if !ok {
+		return true, false
+	}
+	var since = now.Sub(seen.LastNotified)
+	if since < minInterval {
+		return false, false
+	}
+	if since >= window {
+		return true, false
+	}
+
+	if hoursChanges && seen.HoursHash != hoursHash(loc.OpenHours) {
+		return true, true
+	}
+
+	return false, false
+}
+
+// markNew sets NewToday on each of locs that was first found on the same
+// day as now, in the site's timezone, recording now as the first time for
+// the ones never found before.
+func (s *State) markNew(locs []*VaccineLocation, now time.Time) {
+	for _, v := range locs {
+		var first, ok = s.Seen[siteKey(v)]
+		if !ok {
+			first = now
+			s.Seen[siteKey(v)] = now
+		}
+		v.NewToday = v.Zone.in(first).Format(DateFormat) == v.Zone.in(now).Format(DateFormat)
+	}
+}
+
+// record marks loc as notified at now.
+func (s *State) record(loc *VaccineLocation, now time.Time) {
+	s.Sites[siteKey(loc)] = &SiteState{
+		LastNotified: now,
+		HoursHash:    hoursHash(loc.OpenHours),
+		Name:         loc.Name,
+	}
+}
+
+// closed returns the sites with a tweet to reply to that aren't in found,
+// sorted by key.
+func (s *State) closed(found []*VaccineLocation) []string {
+	var open = make(map[string]bool, len(found))
+	for _, v := range found {
+		open[siteKey(v)] = true
+	}
+
+	var ids []string
+	for id, seen := range s.Sites {
+		if seen.TweetID != "" && !open[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// hoursHash returns a short, stable fingerprint of hours.
+func hoursHash(hours []Hours) string {
+	var b, _ = json.Marshal(hours)
+	var sum = sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,60 @@
+package alerts
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStateKeysSitesWithoutExtID(t *testing.T) {
+	var now = time.Date(2021, 4, 15, 10, 0, 0, 0, time.UTC)
+	var a = &VaccineLocation{Name: "Site A"}
+	var b = &VaccineLocation{Name: "Site B"}
+	var c = &VaccineLocation{ExtID: "c", Name: "Site A"}
+
+	var s = newState()
+	s.record(a, now)
+
+	var cases = []struct {
+		loc  *VaccineLocation
+		want bool
+	}{
+		{a, false},
+		{b, true},
+		{c, true},
+	}
+	for _, tc := range cases {
+		var notify, _ = s.check(tc.loc, now.Add(time.Minute), 6*time.Hour, 0, false)
+		if notify != tc.want {
+			t.Errorf("check(%s %q) = %v, want %v", tc.loc.ExtID, tc.loc.Name, notify, tc.want)
+		}
+	}
+
+	var closed = s.closed([]*VaccineLocation{b})
+	if len(closed) != 0 {
+		t.Errorf("closed = %v, want none as no tweet was kept", closed)
+	}
+	s.Sites[siteKey(a)].TweetID = "1"
+	closed = s.closed([]*VaccineLocation{a, b})
+	if len(closed) != 0 {
+		t.Errorf("closed = %v with Site A still open", closed)
+	}
+	closed = s.closed([]*VaccineLocation{b})
+	if len(closed) != 1 || closed[0] != siteKey(a) {
+		t.Errorf("closed = %v, want [%s]", closed, siteKey(a))
+	}
+}
+
+func TestMarkNewKeysSitesWithoutExtID(t *testing.T) {
+	var day1 = time.Date(2021, 4, 15, 18, 0, 0, 0, time.UTC)
+	var s = newState()
+	s.markNew([]*VaccineLocation{{Name: "Site A"}}, day1)
+
+	var a, b = &VaccineLocation{Name: "Site A"}, &VaccineLocation{Name: "Site B"}
+	s.markNew([]*VaccineLocation{a, b}, day1.Add(48*time.Hour))
+	if a.NewToday {
+		t.Error("Site A, first found two days before, marked new")
+	}
+	if !b.NewToday {
+		t.Error("Site B, first found today, not marked new")
+	}
+}
@@ -0,0 +1,36 @@
+package alerts
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// readCoordinates reads "lat,long" pairs from r, one per line, as records
+// to search in place of the data file. Blank lines and lines starting with
+// # are skipped, and so are lines that don't parse, with a warning, so one
+// typo doesn't abort a whole pipeline.
+func readCoordinates(log *logger, r io.Reader) ([]*ZipToLatLong, error) {
+	var out []*ZipToLatLong
+	var s = bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		var text = strings.TrimSpace(s.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		var loc, err = parseCoordinates(text)
+		if err != nil {
+			log.warn("skipping line", line, "of stdin:", err)
+			continue
+		}
+
+		// The coordinates stand in for the zip in logs and file names.
+		var d = &ZipToLatLong{}
+		d.Fields.Zip = text
+		d.Fields.Latitude = loc.Lat
+		d.Fields.Longitude = loc.Long
+		out = append(out, d)
+	}
+	return out, s.Err()
+}
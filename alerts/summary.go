@@ -0,0 +1,81 @@
+package alerts
+
+import (
+	"fmt"
+	"time"
+)
+
+// Summary describes what a run did.
+type Summary struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+
+	// DataUpdated is the newest record timestamp in the zip data.
+	DataUpdated time.Time `json:"dataUpdated"`
+
+	ZipsSearched int `json:"zipsSearched"`
+	// Searches counts the searches made, one per zip and profile, of which
+	// SearchErrors failed.
+	Searches     int `json:"searches"`
+	SearchErrors int `json:"searchErrors"`
+	// DecodeErrors counts the failed searches whose response wasn't JSON or
+	// didn't decode. The rest failed to get a response, or got an error
+	// status.
+	DecodeErrors int `json:"decodeErrors"`
+	// IneligibleResponses counts the responses the API marked as not
+	// eligible that still listed sites, skipped unless NotifyIneligible.
+	IneligibleResponses int `json:"ineligibleResponses"`
+	// SitesFound counts the distinct sites found.
+	SitesFound int `json:"sitesFound"`
+	// DeadlineExceeded is set if the scan ran out of time before searching
+	// every zip.
+	DeadlineExceeded bool `json:"deadlineExceeded"`
+	// Notifications and NotifyErrors count messages sent, across every
+	// notifier.
+	Notifications int `json:"notifications"`
+	NotifyErrors  int `json:"notifyErrors"`
+	// Suppressed counts the sites held back by MaxTweets, to be announced
+	// by a later scan.
+	Suppressed int `json:"suppressed"`
+	// Unsent names the sites each failed message was about, as
+	// "notifier: site", so none go unannounced unnoticed.
+	Unsent []string `json:"unsent,omitempty"`
+	// NotificationsHeld counts messages not sent because they were due in
+	// their notifier's quiet hours.
+	NotificationsHeld int `json:"notificationsHeld"`
+	// HoursWarnings counts open hours times that didn't parse, a sign the
+	// API's hours format changed. HoursWarningExamples are the first few.
+	HoursWarnings        int      `json:"hoursWarnings"`
+	HoursWarningExamples []string `json:"hoursWarningExamples,omitempty"`
+}
+
+// errorRate is the fraction of searches that failed, 0 if none were made.
+func (s *Summary) errorRate() float64 {
+	if s.Searches == 0 {
+		return 0
+	}
+	return float64(s.SearchErrors) / float64(s.Searches)
+}
+
+// String sums s up on a line, for the log.
+func (s *Summary) String() string {
+	return fmt.Sprintf("%d zips, %d searches (%d failed, %d of them undecodable, %d not eligible), %d sites found, %d notifications sent (%d failed, %d held) in %v",
+		s.ZipsSearched, s.Searches, s.SearchErrors, s.DecodeErrors, s.IneligibleResponses, s.SitesFound,
+		s.Notifications, s.NotifyErrors, s.NotificationsHeld, s.End.Sub(s.Start).Round(time.Second))
+}
+
+// maxHoursWarningExamples bounds how many hours warnings a summary keeps.
+const maxHoursWarningExamples = 5
+
+// checkHours records a warning for every time in v's open hours that
+// doesn't parse.
+func (s *Summary) checkHours(v *VaccineLocation) {
+	for _, h := range v.OpenHours {
+		for _, w := range h.hoursWarnings() {
+			s.HoursWarnings++
+			if len(s.HoursWarningExamples) < maxHoursWarningExamples {
+				s.HoursWarningExamples = append(s.HoursWarningExamples, string(v.Name)+": "+w)
+			}
+		}
+	}
+}
@@ -0,0 +1,52 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package alerts
+
+import (
+	"errors"
+	"log/syslog"
+)
+
+// syslogFacilities maps the facility names -syslog-facility takes to
+// their priorities.
+var syslogFacilities = map[string]syslog.Priority{
+	"kern":   syslog.LOG_KERN,
+	"user":   syslog.LOG_USER,
+	"daemon": syslog.LOG_DAEMON,
+	"local0": syslog.LOG_LOCAL0,
+	"local1": syslog.LOG_LOCAL1,
+	"local2": syslog.LOG_LOCAL2,
+	"local3": syslog.LOG_LOCAL3,
+	"local4": syslog.LOG_LOCAL4,
+	"local5": syslog.LOG_LOCAL5,
+	"local6": syslog.LOG_LOCAL6,
+	"local7": syslog.LOG_LOCAL7,
+}
+
+// syslogSink returns a logger sink sending each message to the local
+// syslog daemon, under facility and tag, at the syslog severity matching
+// its level.
+func syslogSink(facility, tag string) (func(l Level, msg string), error) {
+	var p, ok = syslogFacilities[facility]
+	if !ok {
+		return nil, errors.New("unknown syslog facility " + facility)
+	}
+	var w, err = syslog.New(p|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(l Level, msg string) {
+		switch l {
+		case LevelDebug:
+			w.Debug(msg)
+		case LevelInfo:
+			w.Info(msg)
+		case LevelWarn:
+			w.Warning(msg)
+		default:
+			w.Err(msg)
+		}
+	}, nil
+}
@@ -0,0 +1,12 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package alerts
+
+import "errors"
+
+// syslogSink fails, as there's no syslog here: log messages keep going to
+// stderr.
+func syslogSink(facility, tag string) (func(l Level, msg string), error) {
+	return nil, errors.New("syslog isn't supported on this platform")
+}
@@ -0,0 +1,164 @@
+package alerts
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dghubble/go-twitter/twitter"
+)
+
+// Twitter's error codes for replying to a tweet that's gone: deleted, or
+// not visible to the account.
+const (
+	twitterNoStatus    = 144
+	twitterReplyToGone = 385
+)
+
+// loadThreadID reads the tweet ID kept in the thread file at path. A
+// missing or empty file has none, which is zero.
+func loadThreadID(path string) (int64, error) {
+	var b, err = ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var s = strings.TrimSpace(string(b))
+	if s == "" {
+		return 0, nil
+	}
+	var id int64
+	id, err = strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, errors.New("invalid tweet ID " + s + " in " + path)
+	}
+	return id, nil
+}
+
+// saveThreadID keeps id in the thread file at path.
+func saveThreadID(path string, id int64) error {
+	return ioutil.WriteFile(path, []byte(strconv.FormatInt(id, 10)+"\n"), 0644)
+}
+
+// replyTargetGone reports whether err is Twitter refusing a reply because
+// the tweet replied to no longer exists.
+func replyTargetGone(err error) bool {
+	var apiErr twitter.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	for _, e := range apiErr.Errors {
+		switch e.Code {
+		case twitterNoStatus, twitterReplyToGone:
+			return true
+		}
+	}
+	return false
+}
+
+// PostDigest tweets a digest. With a thread file, it replies to the last
+// digest tweet, starting a new thread if there isn't one or it's gone, and
+// keeps its own ID for the next digest to reply to.
+func (t *TwitterNotifier) PostDigest(text string) error {
+	if t.cfg.ThreadFile == "" {
+		return t.Post(text)
+	}
+
+	var prev, err = loadThreadID(t.cfg.ThreadFile)
+	if err != nil {
+		t.cfg.log.warn("starting a new digest thread:", err)
+	}
+
+	var tweet *twitter.Tweet
+	tweet, err = t.update(text, &twitter.StatusUpdateParams{InReplyToStatusID: prev})
+	if prev != 0 && replyTargetGone(err) {
+		t.cfg.log.warn("last digest tweet", prev, "is gone, starting a new thread")
+		tweet, err = t.update(text, nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The digest is out either way, so failing to keep its ID only costs
+	// the thread, and isn't worth a retry that would post it twice.
+	err = saveThreadID(t.cfg.ThreadFile, tweet.ID)
+	if err != nil {
+		t.cfg.log.error("saving digest tweet ID:", err)
+	}
+	return nil
+}
+
+// threadNotifier is a notifier that can post a scan's sites as a thread,
+// for -thread.
+type threadNotifier interface {
+	Notifier
+	// StartThread posts lead, which the messages sent until EndThread then
+	// reply to, each to the one before.
+	StartThread(lead string) error
+	EndThread()
+}
+
+// startThread starts a thread on t for the single site messages in pending
+// it's to send, if there's more than one. Should the lead fail, they're
+// sent on their own.
+func startThread(log *logger, t threadNotifier, pending []*notification) {
+	var sites int
+	for _, p := range pending {
+		if p.loc != nil && !p.digest && (p.only == "" || p.only == t.Name()) {
+			sites++
+		}
+	}
+	if sites < 2 {
+		return
+	}
+	var err = t.StartThread(strconv.Itoa(sites) + " vaccine sites just opened:")
+	if err != nil {
+		log.error("starting thread, posting sites on their own:", field("notifier", t.Name()), field("error", err))
+	}
+}
+
+func (t *TwitterNotifier) StartThread(lead string) error {
+	var tweet, err = t.update(lead, nil)
+	if err != nil {
+		return err
+	}
+	t.threadMu.Lock()
+	t.thread = tweet.ID
+	t.threadMu.Unlock()
+	return nil
+}
+
+func (t *TwitterNotifier) EndThread() {
+	t.threadMu.Lock()
+	t.thread = 0
+	t.threadMu.Unlock()
+}
+
+// postInThread tweets text with params, which may be nil, as a reply to
+// the last tweet of the thread if one's being posted, which it then
+// becomes. A reply that fails leaves the thread as it was, so the next one
+// continues the chain from the last tweet that made it. Tweets are posted
+// one at a time while a thread is open, to keep it in order.
+func (t *TwitterNotifier) postInThread(text string, params *twitter.StatusUpdateParams) (*twitter.Tweet, error) {
+	t.threadMu.Lock()
+	if t.thread == 0 {
+		t.threadMu.Unlock()
+		return t.update(text, params)
+	}
+	defer t.threadMu.Unlock()
+
+	if params == nil {
+		params = &twitter.StatusUpdateParams{}
+	}
+	params.InReplyToStatusID = t.thread
+	var tweet, err = t.update(text, params)
+	if err != nil {
+		return nil, err
+	}
+	t.thread = tweet.ID
+	return tweet, nil
+}
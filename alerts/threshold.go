@@ -0,0 +1,65 @@
+package alerts
+
+import (
+	"errors"
+	"strconv"
+)
+
+// alertArea is an area sites are counted in for threshold alerts: every
+// site within the alert radius of its zip.
+type alertArea struct {
+	zip string
+	loc Location
+}
+
+// resolveAreas looks up the coordinates of each of zips in data.
+func resolveAreas(data []*ZipToLatLong, zips []string) ([]*alertArea, error) {
+	var areas = make([]*alertArea, 0, len(zips))
+	for _, zip := range zips {
+		var area *alertArea
+		for _, d := range data {
+			if d.Fields.Zip == zip {
+				area = &alertArea{zip: zip, loc: Location{Lat: d.Fields.Latitude, Long: d.Fields.Longitude}}
+				break
+			}
+		}
+		if area == nil {
+			return nil, errors.New("zip " + zip + " not found in data")
+		}
+		areas = append(areas, area)
+	}
+	return areas, nil
+}
+
+// thresholdAlerts returns a summary notification for each area where the
+// number of sites found has reached cfg.AlertThreshold. An area is only
+// alerted again after it has dropped back below the threshold, which state
+// remembers by each area's count at the last scan.
+func (r *runner) thresholdAlerts(found []*VaccineLocation, state *State) []*notification {
+	var cfg = r.cfg
+	var pending []*notification
+	for _, a := range r.areas {
+		var near []*VaccineLocation
+		for _, v := range found {
+			if v.Location != nil && haversine(a.loc, *v.Location) <= cfg.AlertRadius*MetersPerMile {
+				near = append(near, v)
+			}
+		}
+
+		var prev = state.Areas[a.zip]
+		state.Areas[a.zip] = len(near)
+		if len(near) < cfg.AlertThreshold || prev >= cfg.AlertThreshold {
+			continue
+		}
+
+		r.cfg.log.info(len(near), "sites are open near", a.zip+", alerting")
+		pending = append(pending, &notification{text: formatAreaTweet(cfg, a.zip, cfg.AlertRadius, near), sites: near})
+	}
+	return pending
+}
+
+// formatAreaTweet renders a single tweet summarizing the sites open within
+// miles of a zip.
+func formatAreaTweet(cfg *Config, zip string, miles float64, locs []*VaccineLocation) string {
+	return formatSiteList(cfg, sitesCount(len(locs))+" open within "+strconv.FormatFloat(miles, 'f', -1, 64)+" miles of "+zip+":", locs)
+}
@@ -0,0 +1,54 @@
+package alerts
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThresholdAlertsOnceAboveThreshold(t *testing.T) {
+	var cfg = &Config{Now: time.Now, AlertThreshold: 2, AlertRadius: 10}
+	var sf = Location{Lat: 37.7725, Long: -122.4147}
+	var r = &runner{cfg: cfg, areas: []*alertArea{{zip: "94103", loc: sf}}}
+
+	var sites = func(near, far int) []*VaccineLocation {
+		var out []*VaccineLocation
+		for i := 0; i < near; i++ {
+			out = append(out, &VaccineLocation{ExtID: "near" + strconv.Itoa(i), Name: SiteName("Near " + strconv.Itoa(i)), Location: &Location{Lat: sf.Lat + 0.01, Long: sf.Long}})
+		}
+		for i := 0; i < far; i++ {
+			// Los Angeles, well out of the radius.
+			out = append(out, &VaccineLocation{ExtID: "far" + strconv.Itoa(i), Location: &Location{Lat: 34.05, Long: -118.24}})
+		}
+		// Sites without coordinates can't be placed in an area.
+		return append(out, &VaccineLocation{ExtID: "nowhere"})
+	}
+
+	var state = newState()
+	var cases = []struct {
+		near, far int
+		alert     bool
+	}{
+		{1, 5, false},
+		{2, 0, true},
+		{3, 0, false},
+		{1, 0, false},
+		{4, 1, true},
+	}
+	for i, c := range cases {
+		var pending = r.thresholdAlerts(sites(c.near, c.far), state)
+		if (len(pending) == 1) != c.alert || len(pending) > 1 {
+			t.Fatalf("scan %d with %d sites near: %d alerts, want alert %v", i+1, c.near, len(pending), c.alert)
+		}
+		if state.Areas["94103"] != c.near {
+			t.Errorf("scan %d: state counts %d sites near, want %d", i+1, state.Areas["94103"], c.near)
+		}
+		if c.alert {
+			var want = sitesCount(c.near) + " open within 10 miles of 94103:"
+			if !strings.HasPrefix(pending[0].text, want) || len(pending[0].sites) != c.near {
+				t.Errorf("scan %d: alert %q about %d sites", i+1, pending[0].text, len(pending[0].sites))
+			}
+		}
+	}
+}
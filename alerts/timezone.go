@@ -0,0 +1,123 @@
+package alerts
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	// Embed the timezone database, so zones resolve the same on hosts
+	// without one, e.g. minimal containers.
+	_ "time/tzdata"
+)
+
+// SiteZone is the timezone a site's hours are in, taken from the zip it
+// was found near.
+type SiteZone struct {
+	// Name is the IANA name of the zone, e.g. America/Los_Angeles.
+	Name string `json:"name"`
+	// UTCOffset is the zone's standard offset from UTC, in hours.
+	UTCOffset int `json:"utcOffset"`
+	// DST is whether the zone observes daylight saving time.
+	DST bool `json:"dst"`
+}
+
+// usZones maps a standard UTC offset, and whether daylight saving time is
+// observed, to the IANA zone US zips with them are in.
+var usZones = map[[2]int]string{
+	{-5, 1}:  "America/New_York",
+	{-6, 1}:  "America/Chicago",
+	{-7, 1}:  "America/Denver",
+	{-7, 0}:  "America/Phoenix",
+	{-8, 1}:  "America/Los_Angeles",
+	{-9, 1}:  "America/Anchorage",
+	{-10, 0}: "Pacific/Honolulu",
+}
+
+// zipZone returns the timezone of the zip d, from its opendatasoft UTC
+// offset and DST flag. Offsets with no US zone get a fixed Etc/GMT zone,
+// which ignores daylight saving time. Records with neither an offset nor
+// DST most likely lack both, so they have no zone.
+func zipZone(d *ZipToLatLong) *SiteZone {
+	if d.Fields.Timezone == 0 && d.Fields.DST == 0 {
+		return nil
+	}
+	var z = &SiteZone{UTCOffset: d.Fields.Timezone, DST: d.Fields.DST != 0}
+
+	var name, ok = usZones[[2]int{d.Fields.Timezone, d.Fields.DST}]
+	if !ok {
+		// Etc/GMT zones are named with the sign of the offset inverted.
+		name = "Etc/GMT"
+		if d.Fields.Timezone < 0 {
+			name += "+" + strconv.Itoa(-d.Fields.Timezone)
+		} else if d.Fields.Timezone > 0 {
+			name += "-" + strconv.Itoa(d.Fields.Timezone)
+		}
+	}
+	z.Name = name
+
+	return z
+}
+
+// location returns z as a time.Location, or nil if z is nil or unknown.
+func (z *SiteZone) location() *time.Location {
+	if z == nil {
+		return nil
+	}
+	var loc, err = time.LoadLocation(z.Name)
+	if err != nil {
+		return nil
+	}
+	return loc
+}
+
+// in returns t in z, or t as it is if z is nil or unknown.
+func (z *SiteZone) in(t time.Time) time.Time {
+	if loc := z.location(); loc != nil {
+		return t.In(loc)
+	}
+	return t
+}
+
+// label returns the abbreviation of z in effect at t, e.g. PST or PDT, or
+// "" if z is nil or unknown.
+func (z *SiteZone) label(t time.Time) string {
+	if loc := z.location(); loc != nil {
+		return t.In(loc).Format("MST")
+	}
+	return ""
+}
+
+// hoursString returns h, one of v's open hours, as shown in messages: with
+// its times rounded to cfg.RoundMinutes, and labelled with v's zone when
+// it's known, e.g. "Mon - 9:00AM-5:00PM PDT". The label is the one in
+// effect when h next opens, which across a DST change isn't today's.
+func (v *VaccineLocation) hoursString(cfg *Config, h Hours) string {
+	var s = h.format(cfg.RoundMinutes)
+	var at = cfg.Now()
+	if loc := v.Zone.location(); loc != nil {
+		at = h.next(at.In(loc))
+	}
+	if label := v.Zone.label(at); label != "" {
+		s += " " + label
+	}
+	return s
+}
+
+// next returns when h next opens on or after now's date, in now's
+// location: on the first of its days from then, at its start. Hours with
+// no days it knows, or no start, return now.
+func (h *Hours) next(now time.Time) time.Time {
+	var start, err = time.Parse("15:04:05", h.LocalStart)
+	if err != nil {
+		return now
+	}
+	for ahead := 0; ahead < 7; ahead++ {
+		var day = now.AddDate(0, 0, ahead)
+		for _, d := range h.Days {
+			if strings.EqualFold(d, day.Weekday().String()) {
+				return time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), start.Second(), 0, now.Location())
+			}
+		}
+	}
+	return now
+}
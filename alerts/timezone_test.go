@@ -0,0 +1,64 @@
+package alerts
+
+import (
+	"testing"
+	"time"
+)
+
+func TestZipZone(t *testing.T) {
+	var cases = []struct {
+		offset, dst int
+		want        string
+	}{
+		{-8, 1, "America/Los_Angeles"},
+		{-7, 0, "America/Phoenix"},
+		{-8, 0, "Etc/GMT+8"},
+		{0, 0, ""},
+	}
+	for _, c := range cases {
+		var d = &ZipToLatLong{}
+		d.Fields.Timezone, d.Fields.DST = c.offset, c.dst
+		var z = zipZone(d)
+		if c.want == "" {
+			if z != nil {
+				t.Errorf("offset %d, dst %d: got zone %+v, want none", c.offset, c.dst, z)
+			}
+			continue
+		}
+		if z == nil || z.Name != c.want || z.location() == nil {
+			t.Errorf("offset %d, dst %d: got zone %+v, want %s", c.offset, c.dst, z, c.want)
+		}
+	}
+}
+
+func TestHoursLabelledForTheirDay(t *testing.T) {
+	var la, _ = time.LoadLocation("America/Los_Angeles")
+	var zone = &SiteZone{Name: "America/Los_Angeles", UTCOffset: -8, DST: true}
+	var cases = []struct {
+		name string
+		// now is when the message is sent.
+		now  time.Time
+		days []string
+		zone *SiteZone
+		want string
+	}{
+		{"today, before spring forward", time.Date(2021, 3, 13, 12, 0, 0, 0, la), []string{"saturday"}, zone, "Saturday - 9:00AM-5:00PM PST"},
+		{"after spring forward", time.Date(2021, 3, 13, 12, 0, 0, 0, la), []string{"monday"}, zone, "Monday - 9:00AM-5:00PM PDT"},
+		{"soonest of its days", time.Date(2021, 3, 13, 12, 0, 0, 0, la), []string{"monday", "saturday"}, zone, "Monday,Saturday - 9:00AM-5:00PM PST"},
+		{"after fall back", time.Date(2021, 11, 6, 12, 0, 0, 0, la), []string{"monday"}, zone, "Monday - 9:00AM-5:00PM PST"},
+		{"in utc, before spring forward there", time.Date(2021, 3, 14, 2, 0, 0, 0, time.UTC), []string{"saturday"}, zone, "Saturday - 9:00AM-5:00PM PST"},
+		{"no days", time.Date(2021, 3, 13, 12, 0, 0, 0, la), nil, zone, "9:00AM-5:00PM PST"},
+		{"no zone", time.Date(2021, 3, 13, 12, 0, 0, 0, la), []string{"monday"}, nil, "Monday - 9:00AM-5:00PM"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var now = c.now
+			var cfg = &Config{Now: func() time.Time { return now }}
+			var v = &VaccineLocation{Zone: c.zone}
+			var got = v.hoursString(cfg, Hours{Days: c.days, LocalStart: "09:00:00", LocalEnd: "17:00:00"})
+			if got != c.want {
+				t.Errorf("got %q, want %q", got, c.want)
+			}
+		})
+	}
+}
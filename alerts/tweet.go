@@ -0,0 +1,200 @@
+package alerts
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// TweetLimit is the maximum length of a tweet.
+	TweetLimit = 280
+	// TCOLength is the length Twitter counts for any link, since every URL
+	// gets wrapped by t.co regardless of its real length.
+	TCOLength = 23
+	// MaxMessageExtra caps the length of the configured message prefix and
+	// suffix together, so there's always room left for the site.
+	MaxMessageExtra = 100
+	// NewMarker leads the names of sites first found today, with -mark-new.
+	NewMarker = "🆕"
+
+	SignupURL = "https://myturn.ca.gov/"
+	MapsURL   = "https://www.google.com/maps/search/?api=1&query="
+)
+
+// formatTweet renders loc as a tweet.
+func formatTweet(cfg *Config, loc *VaccineLocation) string {
+	return formatMessage(cfg, loc, TweetLimit, tweetLength)
+}
+
+// formatMessage renders loc as a message of at most limit characters, as
+// counted by length. If the full text doesn't fit, trailing hours are
+// dropped so the name, address, links and configured prefix, suffix and
+// timestamp always make it in.
+func formatMessage(cfg *Config, loc *VaccineLocation, limit int, length func(string) int) string {
+	var lead string
+	if cfg.MessagePrefix != "" {
+		lead = cfg.MessagePrefix + "\n"
+	}
+	var name = string(loc.Name)
+	if loc.hoursChanged {
+		name = "Updated hours: " + name
+	} else if loc.NewToday {
+		name = NewMarker + " " + name
+	}
+	var tail = "\nSign up at: " + signupLink(cfg)
+	if cfg.MessageSuffix != "" {
+		tail += "\n" + cfg.MessageSuffix
+	}
+	tail += timestampSuffix(cfg, loc.Zone)
+	if link := mapsLink(loc); cfg.MapsLink && link != "" {
+		tail = "\nDirections: " + link + tail
+	}
+	if loc.NearCity != "" {
+		tail = "\nNear " + loc.NearCity + tail
+	}
+	if t, err := time.Parse(DateFormat, loc.AvailableFrom); err == nil {
+		tail = "\nAvailable from " + t.Format("Mon Jan 2") + tail
+	}
+	if len(cfg.Profiles) > 1 && len(loc.Profiles) > 0 {
+		tail = "\nEligible: " + strings.Join(loc.Profiles, ", ") + tail
+	}
+	if cfg.MessageTimestamp {
+		tail = "\nAs of " + loc.Zone.in(cfg.Now()).Format("3:04PM MST") + tail
+	}
+
+	// Dropped hours are marked with an ellipsis, which needs room too.
+	var open = loc.displayHours()
+	var more string
+	if len(open) > 0 {
+		more = "\n…"
+	}
+
+	// The links always have to fit, so an overly long address, and failing
+	// that the name, gets cut short.
+	var address = normalizeAddress(loc.DisplayAddress)
+	var over = length(lead+name+"\n"+address+more+tail) - limit
+	if over > 0 {
+		address = ellipsize(address, utf8.RuneCountInString(address)-over)
+		over = length(lead+name+"\n"+address+more+tail) - limit
+		if over > 0 {
+			name = ellipsize(name, utf8.RuneCountInString(name)-over)
+		}
+	}
+	var head = lead + name + "\n" + address
+
+	var hours string
+	for i, h := range open {
+		var line = "\n" + loc.hoursString(cfg, h)
+		if i == len(open)-1 {
+			more = ""
+		}
+		if length(head+hours+line+more+tail) > limit {
+			hours += "\n…"
+			break
+		}
+		hours += line
+	}
+
+	return head + hours + tail
+}
+
+// formatCountyTweet renders a single tweet summarizing the sites open in a
+// county.
+func formatCountyTweet(cfg *Config, county string, locs []*VaccineLocation) string {
+	return formatSiteList(cfg, sitesCount(len(locs))+" open in "+county+" County:", locs)
+}
+
+// formatDigestTweet renders the daily digest of every site seen in a day.
+func formatDigestTweet(cfg *Config, locs []*VaccineLocation) string {
+	return formatSiteList(cfg, "Daily digest: "+sitesCount(len(locs))+" had availability today:", locs)
+}
+
+// signupLink returns the link to the signup page, shortened if a shortener
+// is configured.
+func signupLink(cfg *Config) string {
+	return cfg.shortener.shorten(SignupURL)
+}
+
+// timestampSuffix returns the time to end messages with when
+// cfg.AppendTimestamp is set, e.g. " · 3:42PM", in zone if it's known. It
+// makes messages about the same sites differ between runs, which Twitter
+// would otherwise reject as duplicates.
+func timestampSuffix(cfg *Config, zone *SiteZone) string {
+	if !cfg.AppendTimestamp {
+		return ""
+	}
+	return " · " + zone.in(cfg.Now()).Format("3:04PM")
+}
+
+// sitesCount renders n as "1 site" or "n sites".
+func sitesCount(n int) string {
+	if n == 1 {
+		return "1 site"
+	}
+	return strconv.Itoa(n) + " sites"
+}
+
+// formatSiteList renders head followed by the name of each site. Sites that
+// don't fit in TweetLimit are summed up at the end.
+func formatSiteList(cfg *Config, head string, locs []*VaccineLocation) string {
+	var tail = "\nSign up at: " + signupLink(cfg)
+	if len(locs) > 0 {
+		tail += timestampSuffix(cfg, locs[0].Zone)
+	}
+
+	var names string
+	for i, l := range locs {
+		var line = "\n- " + string(l.Name)
+		var more = "\n…and " + strconv.Itoa(len(locs)-i) + " more"
+		if tweetLength(head+names+line+tail) > TweetLimit ||
+			(i < len(locs)-1 && tweetLength(head+names+line+more+tail) > TweetLimit) {
+			names += more
+			break
+		}
+		names += line
+	}
+
+	return head + names + tail
+}
+
+// ellipsize shortens s to at most n runes, marking the cut with an ellipsis.
+func ellipsize(s string, n int) string {
+	var r = []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	if n <= 0 {
+		return ""
+	}
+	return string(r[:n-1]) + "…"
+}
+
+// mapsLink returns a Google Maps search link for v's coordinates, or for
+// its address if they aren't known, or "" if neither is.
+func mapsLink(v *VaccineLocation) string {
+	if v.Location == nil {
+		var address = normalizeAddress(v.DisplayAddress)
+		if address == "" {
+			return ""
+		}
+		return MapsURL + url.QueryEscape(address)
+	}
+	return MapsURL +
+		strconv.FormatFloat(v.Location.Lat, 'f', -1, 64) + "," +
+		strconv.FormatFloat(v.Location.Long, 'f', -1, 64)
+}
+
+// tweetLength returns the length Twitter counts for s, with every link
+// counted as TCOLength. Mastodon counts links the same way.
+func tweetLength(s string) int {
+	var n = utf8.RuneCountInString(s)
+	for _, w := range strings.Fields(s) {
+		if strings.HasPrefix(w, "http://") || strings.HasPrefix(w, "https://") {
+			n += TCOLength - utf8.RuneCountInString(w)
+		}
+	}
+	return n
+}
@@ -0,0 +1,94 @@
+package alerts
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatTweet(t *testing.T) {
+	var now = time.Date(2021, 4, 15, 17, 42, 0, 0, time.UTC)
+	var week = []Hours{
+		{Days: []string{"monday"}, LocalStart: "08:00:00", LocalEnd: "17:00:00"},
+		{Days: []string{"tuesday"}, LocalStart: "08:00:00", LocalEnd: "17:00:00"},
+		{Days: []string{"wednesday"}, LocalStart: "09:00:00", LocalEnd: "18:00:00"},
+		{Days: []string{"thursday"}, LocalStart: "09:00:00", LocalEnd: "18:00:00"},
+		{Days: []string{"friday"}, LocalStart: "10:00:00", LocalEnd: "19:00:00"},
+		{Days: []string{"saturday"}, LocalStart: "10:00:00", LocalEnd: "16:00:00"},
+		{Days: []string{"sunday"}, LocalStart: "11:00:00", LocalEnd: "15:00:00"},
+	}
+	var at = &Location{Lat: 37.7749, Long: -122.4194}
+
+	var cases = []struct {
+		name string
+		cfg  Config
+		loc  VaccineLocation
+		// want are pieces of text the tweet must contain.
+		want []string
+	}{
+		{"no hours", Config{},
+			VaccineLocation{Name: "Moscone Center", DisplayAddress: "747 Howard St, San Francisco, CA 94103"},
+			[]string{"Moscone Center\n747 Howard St, San Francisco, CA 94103\n"}},
+		{"one hour", Config{},
+			VaccineLocation{Name: "Moscone Center", DisplayAddress: "747 Howard St", OpenHours: week[:1]},
+			[]string{"Moscone Center\n747 Howard St\n", "Monday"}},
+		{"many hours", Config{},
+			VaccineLocation{Name: "Moscone Center", DisplayAddress: strings.Repeat("Long Street ", 8), OpenHours: append(append([]Hours{}, week...), week...)},
+			[]string{"Moscone Center", "Monday", "\n…"}},
+		{"overlong address", Config{},
+			VaccineLocation{Name: "Moscone Center", DisplayAddress: strings.Repeat("747 Howard St ", 40)},
+			[]string{"Moscone Center\n747 Howard St", "…"}},
+		{"overlong name", Config{},
+			VaccineLocation{Name: SiteName(strings.Repeat("Moscone Center ", 40)), DisplayAddress: strings.Repeat("747 Howard St ", 40)},
+			[]string{"Moscone Center", "…"}},
+		{"non-ASCII name", Config{},
+			VaccineLocation{Name: SiteName(strings.Repeat("Clínica de Vacunación 診所 ", 20)), DisplayAddress: "Calle Señor 1", OpenHours: week},
+			[]string{"Clínica de Vacunación", "…"}},
+		{"prefix, suffix and timestamp", Config{MessagePrefix: "Vaccines!", MessageSuffix: "#vaccine", AppendTimestamp: true},
+			VaccineLocation{Name: SiteName(strings.Repeat("Moscone Center ", 30)), DisplayAddress: "747 Howard St", OpenHours: week},
+			[]string{"Vaccines!\nMoscone Center", "\n#vaccine", " · 5:42PM"}},
+		{"maps link from coordinates", Config{MapsLink: true},
+			VaccineLocation{Name: "Moscone Center", DisplayAddress: strings.Repeat("747 Howard St ", 40), Location: at, OpenHours: week},
+			[]string{"\nDirections: " + MapsURL + "37.7749,-122.4194"}},
+		{"maps link from address", Config{MapsLink: true},
+			VaccineLocation{Name: "Moscone Center", DisplayAddress: "747 Howard St"},
+			[]string{"\nDirections: " + MapsURL + "747+Howard+St"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var cfg, loc = c.cfg, c.loc
+			cfg.Now = func() time.Time { return now }
+			var out = formatTweet(&cfg, &loc)
+
+			if n := tweetLength(out); n > TweetLimit {
+				t.Errorf("tweet is %d long, over %d:\n%s", n, TweetLimit, out)
+			}
+			if !strings.Contains(out, "\nSign up at: "+SignupURL) {
+				t.Errorf("tweet has no signup link:\n%s", out)
+			}
+			for _, w := range c.want {
+				if !strings.Contains(out, w) {
+					t.Errorf("tweet doesn't contain %q:\n%s", w, out)
+				}
+			}
+		})
+	}
+}
+
+func TestTweetLength(t *testing.T) {
+	var cases = []struct {
+		s    string
+		want int
+	}{
+		{"", 0},
+		{"Clínica 診所", 10},
+		{"Sign up at: " + SignupURL, 12 + TCOLength},
+		{MapsURL + "1,2 and http://x.co", 2*TCOLength + 5},
+	}
+	for _, c := range cases {
+		if got := tweetLength(c.s); got != c.want {
+			t.Errorf("tweetLength(%q) = %d, want %d", c.s, got, c.want)
+		}
+	}
+}
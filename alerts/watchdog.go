@@ -0,0 +1,47 @@
+package alerts
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// watchdog alerts the maintainers once a daemon has gone cfg.WatchdogRuns
+// scans in a row without finding a single site, which may mean scarcity
+// but may as well mean the scraper broke.
+type watchdog struct {
+	cfg    *Config
+	client *http.Client
+	empty  int
+}
+
+func newWatchdog(cfg *Config) *watchdog {
+	return &watchdog{cfg: cfg, client: &http.Client{Transport: baseTransport(cfg)}}
+}
+
+// observe records the outcome of a scan, alerting when the streak of empty
+// scans reaches the limit. It alerts once per streak.
+func (w *watchdog) observe(s *Summary) {
+	if w.cfg.WatchdogRuns <= 0 || w.cfg.WatchdogWebhook == "" {
+		return
+	}
+
+	if s.SitesFound > 0 {
+		w.empty = 0
+		return
+	}
+
+	w.empty++
+	if w.empty != w.cfg.WatchdogRuns {
+		return
+	}
+
+	var text = "Possible breakage: ca-vaccine-alerts found no sites in the last " +
+		strconv.Itoa(w.empty) + " scans (" + strconv.Itoa(s.SearchErrors) + " of " +
+		strconv.Itoa(s.ZipsSearched) + " searches failed in the latest one)."
+	w.cfg.log.warn(text)
+
+	var err = postWebhook(w.cfg, w.client, w.cfg.WatchdogWebhook, text, "")
+	if err != nil {
+		w.cfg.log.error("sending watchdog alert:", err)
+	}
+}
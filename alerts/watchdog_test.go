@@ -0,0 +1,45 @@
+package alerts
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchdogAlertsOncePerStreak(t *testing.T) {
+	var alerts []string
+	var hook = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		json.NewDecoder(r.Body).Decode(&payload)
+		alerts = append(alerts, payload["text"])
+	}))
+	defer hook.Close()
+
+	var cfg = &Config{Now: time.Now, WatchdogRuns: 3, WatchdogWebhook: hook.URL}
+	var w = newWatchdog(cfg)
+
+	// found is the sites each scan finds, and alerted the alerts sent
+	// after each.
+	var found = []int{0, 0, 2, 0, 0, 0, 0, 0, 1, 0, 0, 0}
+	var alerted = []int{0, 0, 0, 0, 0, 1, 1, 1, 1, 1, 1, 2}
+	for i, n := range found {
+		w.observe(&Summary{SitesFound: n, ZipsSearched: 10, SearchErrors: 4})
+		if len(alerts) != alerted[i] {
+			t.Fatalf("after scan %d, %d alerts sent, want %d", i+1, len(alerts), alerted[i])
+		}
+	}
+	if !strings.Contains(alerts[0], "no sites in the last 3 scans (4 of 10 searches failed") {
+		t.Errorf("alert = %q", alerts[0])
+	}
+
+	cfg.WatchdogWebhook = ""
+	for i := 0; i < 5; i++ {
+		w.observe(&Summary{})
+	}
+	if len(alerts) != 2 {
+		t.Error("alerted without a webhook")
+	}
+}
@@ -0,0 +1,136 @@
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	EnvWebhookURL = "WEBHOOK_URL"
+
+	// WebhookLimit is the length messages to the webhook are kept to,
+	// Discord's limit, which is the strictest of the usual receivers.
+	WebhookLimit = 2000
+	// IdempotencyKeyHeader carries a message's idempotency key, which is
+	// also in the payload.
+	IdempotencyKeyHeader = "Idempotency-Key"
+)
+
+func init() {
+	registerNotifier("webhook", newWebhookNotifier)
+}
+
+// WebhookNotifier posts sites to a generic chat webhook.
+type WebhookNotifier struct {
+	cfg    *Config
+	client *http.Client
+	url    string
+}
+
+// newWebhookNotifier returns a notifier for the webhook configured in the
+// environment, or nil if there isn't one.
+func newWebhookNotifier(cfg *Config) (Notifier, error) {
+	var url, ok = os.LookupEnv(EnvWebhookURL)
+	if !ok {
+		return nil, nil
+	}
+	return &WebhookNotifier{
+		cfg:    cfg,
+		client: &http.Client{Transport: baseTransport(cfg)},
+		url:    url,
+	}, nil
+}
+
+func (w *WebhookNotifier) Name() string {
+	return "webhook"
+}
+
+func (w *WebhookNotifier) Format(loc *VaccineLocation) string {
+	return formatMessage(w.cfg, loc, WebhookLimit, utf8.RuneCountInString)
+}
+
+func (w *WebhookNotifier) Post(text string) error {
+	return postWebhook(w.cfg, w.client, w.url, text, "")
+}
+
+// PostKeyed posts text with an idempotency key, so the receiver can drop
+// the copies our retries may send.
+func (w *WebhookNotifier) PostKeyed(text, key string) error {
+	return postWebhook(w.cfg, w.client, w.url, text, key)
+}
+
+// webhookBlock is a Slack Block Kit block. Only sections are sent.
+type webhookBlock struct {
+	Type string       `json:"type"`
+	Text *webhookText `json:"text,omitempty"`
+}
+
+type webhookText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// slackEscaper escapes what Slack's mrkdwn reads as markup.
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// webhookBlocks lays text out as Block Kit sections: its first line, the
+// site's name, in bold, and the rest of it below.
+func webhookBlocks(text string) []webhookBlock {
+	var section = func(s string) webhookBlock {
+		return webhookBlock{Type: "section", Text: &webhookText{Type: "mrkdwn", Text: s}}
+	}
+	var lines = strings.SplitN(text, "\n", 2)
+	var blocks = []webhookBlock{section("*" + slackEscaper.Replace(lines[0]) + "*")}
+	if len(lines) == 2 && strings.TrimSpace(lines[1]) != "" {
+		blocks = append(blocks, section(slackEscaper.Replace(lines[1])))
+	}
+	return blocks
+}
+
+// postWebhook POSTs text to a chat webhook as {"text": text}, the payload
+// Slack, Mattermost and most generic webhooks accept, along with Block Kit
+// blocks Slack shows instead of it. A non-empty key is sent along as
+// "idempotency_key", and in the Idempotency-Key header. Retries are taken
+// from cfg's budget.
+func postWebhook(cfg *Config, client *http.Client, url, text, key string) error {
+	// Slack style receivers read text and Discord's read content. Slack
+	// keeps text for notifications when there are blocks.
+	var payload = map[string]interface{}{"text": text, "content": text, "blocks": webhookBlocks(text)}
+	if key != "" {
+		payload["idempotency_key"] = key
+	}
+	var b, err = json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	var req *http.Request
+	req, err = http.NewRequest(http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", JSONMimeType)
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+
+	var r *http.Response
+	r, err = doWithRetry(cfg, client, req, NotifyAttempts)
+	if r != nil {
+		defer drainAndClose(r.Body)
+	}
+	if err != nil {
+		return err
+	}
+
+	if r.StatusCode >= http.StatusBadRequest {
+		return errors.New("unexpected status " + r.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package alerts
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookSendsBlocks(t *testing.T) {
+	var body struct {
+		Text    string         `json:"text"`
+		Content string         `json:"content"`
+		Blocks  []webhookBlock `json:"blocks"`
+		Key     string         `json:"idempotency_key"`
+	}
+	var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err = json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			t.Error(err)
+		}
+	}))
+	defer srv.Close()
+
+	var cfg = &Config{Now: time.Now}
+	var w = &WebhookNotifier{cfg: cfg, client: srv.Client(), url: srv.URL}
+	var loc = &VaccineLocation{Name: "Moscone Center <Mass Site>", DisplayAddress: "747 Howard St & 4th St"}
+	var text = w.Format(loc)
+	var err = w.PostKeyed(text, "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body.Text != text || body.Content != text || body.Key != "abc" {
+		t.Errorf("got text %q, content %q and key %q, want the message and its key", body.Text, body.Content, body.Key)
+	}
+	if len(body.Blocks) != 2 {
+		t.Fatalf("got %d blocks, want the name's and the rest's: %+v", len(body.Blocks), body.Blocks)
+	}
+	for _, b := range body.Blocks {
+		if b.Type != "section" || b.Text == nil || b.Text.Type != "mrkdwn" {
+			t.Fatalf("got block %+v, want a mrkdwn section", b)
+		}
+	}
+	if got, want := body.Blocks[0].Text.Text, "*Moscone Center &lt;Mass Site&gt;*"; got != want {
+		t.Errorf("got name block %q, want %q", got, want)
+	}
+	if got := body.Blocks[1].Text.Text; !strings.HasPrefix(got, "747 Howard St &amp; 4th St\n") {
+		t.Errorf("got rest of the message %q, want it to start with the escaped address", got)
+	}
+}